@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newAgentCmd() *cobra.Command {
+	var dir string
+
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Run dutis watch or apply at login as a LaunchAgent",
+		Long: `Manage launchd agents that run dutis in the background: 'watch' keeps
+'dutis watch' running, 'apply' runs 'dutis apply' at login and whenever the
+config file changes. The agents are written to ~/Library/LaunchAgents (or
+--dir) and log to ~/.dutis/logs.`,
+	}
+	cmd.PersistentFlags().StringVar(&dir, "dir", "", "LaunchAgents directory (default ~/Library/LaunchAgents)")
+	agentDir := func() (string, error) {
+		if dir != "" {
+			return dir, nil
+		}
+		return util.DefaultAgentDir()
+	}
+	modes := cobra.FixedCompletions(util.AgentModes, cobra.ShellCompDirectiveNoFileComp)
+
+	var (
+		interval time.Duration
+		noLoad   bool
+		dryRun   bool
+	)
+	install := &cobra.Command{
+		Use:   "install [watch|apply]",
+		Short: "Install and load an agent (default watch)",
+		Long: `Generate the agent's launchd property list, check it, write it and load
+it with launchctl. --interval sets the check interval of 'watch' and
+re-runs 'apply' periodically on top of config changes. --dry-run prints
+the property list instead; --no-load only writes it.`,
+		Example: `  dutis agent install
+  dutis agent install apply --interval 1h
+  dutis agent install watch --dry-run`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: modes,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mode := util.AgentWatch
+			if len(args) == 1 {
+				mode = args[0]
+			}
+			program, err := dutisExecutable()
+			if err != nil {
+				return err
+			}
+			configPath := ""
+			if globals.configPath != "" {
+				if configPath, err = filepath.Abs(globals.configPath); err != nil {
+					return err
+				}
+			}
+			spec, err := util.NewAgentSpec(mode, program, configPath, int(interval/time.Second))
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				data, err := spec.Render()
+				if err != nil {
+					return err
+				}
+				out.Printf("%s", data)
+				return nil
+			}
+
+			d, err := agentDir()
+			if err != nil {
+				return err
+			}
+			path, loaded, err := util.InstallAgent(cmd.Context(), spec, d, !noLoad)
+			if err != nil {
+				return err
+			}
+			report := agentInstallReport{Mode: mode, Label: spec.Label(), Path: path, Loaded: loaded, Log: spec.LogPath()}
+			return emit(report, func() {
+				out.Successf("Installed %s agent: %s", mode, path)
+				if loaded {
+					out.Successf("Loaded %s", report.Label)
+				} else {
+					out.Pendingf("Not loaded; run 'launchctl bootstrap gui/%d %s' or log in again", os.Getuid(), path)
+				}
+				out.Printf("Logs go to %s\n", report.Log)
+			})
+		},
+	}
+	install.Flags().DurationVar(&interval, "interval", 0, "watch: check interval; apply: also re-run this often (default none)")
+	install.Flags().BoolVar(&noLoad, "no-load", false, "only write the property list, don't load it")
+	install.Flags().BoolVar(&dryRun, "dry-run", false, "print the property list instead of installing it")
+
+	uninstall := &cobra.Command{
+		Use:               "uninstall [watch|apply]",
+		Short:             "Unload and remove an agent (default both)",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: modes,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selected := util.AgentModes
+			if len(args) == 1 {
+				if !isAgentMode(args[0]) {
+					return fmt.Errorf("unknown agent %q: want %s", args[0], strings.Join(util.AgentModes, " or "))
+				}
+				selected = args
+			}
+			d, err := agentDir()
+			if err != nil {
+				return err
+			}
+			report := agentUninstallReport{Removed: []string{}}
+			for _, mode := range selected {
+				removed, err := util.UninstallAgent(cmd.Context(), d, mode)
+				if err != nil {
+					return err
+				}
+				if removed {
+					report.Removed = append(report.Removed, mode)
+				}
+			}
+			return emit(report, func() {
+				if len(report.Removed) == 0 {
+					out.Println("No agent installed.")
+				}
+				for _, mode := range report.Removed {
+					out.Successf("Removed %s agent", mode)
+				}
+			})
+		},
+	}
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Show which agents are installed and running",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, err := agentDir()
+			if err != nil {
+				return err
+			}
+			report := agentStatusReport{}
+			for _, mode := range util.AgentModes {
+				report.Agents = append(report.Agents, util.AgentStatusOf(cmd.Context(), d, mode))
+			}
+			return emit(report, func() { printAgentStatus(report) })
+		},
+	}
+
+	cmd.AddCommand(install, uninstall, status)
+	return cmd
+}
+
+func printAgentStatus(report agentStatusReport) {
+	for _, a := range report.Agents {
+		switch {
+		case !a.Installed:
+			out.Pendingf("%s: not installed", a.Mode)
+			continue
+		case a.Error != "":
+			out.Failuref("%s: %s: %s", a.Mode, a.Path, a.Error)
+			continue
+		case a.Loaded && a.State != "":
+			out.Successf("%s: loaded, %s", a.Mode, a.State)
+		case a.Loaded:
+			out.Successf("%s: loaded", a.Mode)
+		default:
+			out.Pendingf("%s: installed but not loaded", a.Mode)
+		}
+		out.Printf("    %s\n", a.Path)
+		if a.Log != "" {
+			out.Printf("    log: %s\n", a.Log)
+		}
+	}
+}
+
+func isAgentMode(mode string) bool {
+	for _, m := range util.AgentModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// dutisExecutable returns the absolute path of the running dutis, which
+// the agents run. It is not resolved further, so an upgrade that replaces
+// the binary behind a symlink keeps the agents working.
+func dutisExecutable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locating the dutis executable: %w", err)
+	}
+	return util.AgentProgram(path), nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newListCmd() *cobra.Command {
+	var app string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all configured associations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := util.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+			match := func(util.Association) bool { return true }
+			if app != "" {
+				if match, err = appFilter(cmd.Context(), app); err != nil {
+					return err
+				}
+			}
+			var associations []util.Association
+			for _, assoc := range config.ListAssociations() {
+				if match(assoc) {
+					associations = append(associations, assoc)
+				}
+			}
+
+			if associations == nil {
+				associations = []util.Association{}
+			}
+			return emit(associationList{associations}, func() {
+				if len(associations) == 0 {
+					out.Println("No associations configured yet.")
+					out.Println("Run 'dutis' to set file associations interactively.")
+					return
+				}
+				out.Printf("Configured associations (%d):\n\n", len(associations))
+				out.Printf("%-15s %-30s %s\n", "SUFFIX", "APPLICATION", "BUNDLE ID")
+				out.Println(strings.Repeat("-", 80))
+				for _, assoc := range associations {
+					out.Printf("%-15s %-30s %s\n", assoc.Suffix, assoc.Application, assoc.BundleID)
+				}
+			})
+		},
+	}
+	cmd.Flags().StringVar(&app, "app", "", "only list associations of this app (bundle ID, name, path or part of a name)")
+	_ = cmd.RegisterFlagCompletionFunc("app", completeBundleIDs)
+	return cmd
+}
+
+// appFilter matches the associations of the installed app query resolves
+// to. A query no installed app matches, e.g. one since uninstalled, is
+// compared with the configured bundle IDs and names as given.
+func appFilter(ctx context.Context, query string) (func(util.Association) bool, error) {
+	apps, err := getUtiMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := util.ResolveApp(ctx, query, apps)
+	switch {
+	case err == nil:
+		return func(a util.Association) bool { return strings.EqualFold(a.BundleID, resolved.Identifier) }, nil
+	case !errors.Is(err, util.ErrAppNotFound):
+		return nil, err
+	}
+	name := strings.TrimSuffix(strings.ToLower(query), ".app")
+	return func(a util.Association) bool {
+		return strings.EqualFold(a.BundleID, query) || strings.TrimSuffix(strings.ToLower(a.Application), ".app") == name
+	}, nil
+}
+
+func newApplyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "apply",
+		Short: "Apply all configured associations from the config",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := util.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+			if len(config.Associations) > 0 {
+				out.Printf("Applying %d file associations...\n\n", len(config.Associations))
+			}
+			results, applyErr := config.ApplyAll(cmd.Context())
+			if results == nil && applyErr != nil {
+				return applyErr
+			}
+			report := newApplyReport(results)
+			if err := emit(report, func() { printApplyReport(report) }); err != nil {
+				return err
+			}
+			return applyErr
+		},
+	}
+}
+
+func printApplyReport(report applyReport) {
+	for _, r := range report.Results {
+		out.Printf("  %s → %s (%s)\n", r.Suffix, r.Application, r.BundleID)
+		if r.Status == util.ApplyStatusApplied {
+			out.Indent("    ").Successf("Applied")
+		} else {
+			out.Indent("    ").Failuref("Error: %s", r.Error)
+		}
+	}
+	out.Printf("\n%d succeeded, %d failed\n", report.Succeeded, report.Failed)
+}
+
+func newRemoveCmd() *cobra.Command {
+	var (
+		restore    bool
+		fallback   string
+		systemOnly bool
+		configOnly bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "remove <suffix>",
+		Short: "Remove the association for a suffix from the config",
+		Long: `Remove the association for a suffix from the config. The system default
+is left alone unless --restore is given: then the handler goes back to the
+one the suffix had before dutis first changed it, as recorded in the
+journal, or to the --fallback app when that is not known. --system-only
+restores the handler and keeps the config entry; --config-only only edits
+the config, which is the default.`,
+		Example: `  dutis remove .txt
+  dutis remove .md --restore
+  dutis remove .md --restore --fallback TextEdit
+  dutis remove .md --system-only`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConfiguredSuffixes,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configOnly && (restore || systemOnly || fallback != "") {
+				return fmt.Errorf("--config-only cannot be combined with --restore, --fallback or --system-only")
+			}
+			restore = restore || systemOnly || fallback != ""
+
+			suffix, err := util.ParseSuffix(args[0])
+			if err != nil {
+				return err
+			}
+			config, err := util.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+			assoc, ok := config.GetAssociation(suffix)
+			if !ok && !systemOnly {
+				return fmt.Errorf("no association found for suffix: %s", suffix)
+			}
+
+			ctx := cmd.Context()
+			report := removeReport{Removed: suffix}
+			change := util.JournalEntry{Suffix: suffix, Role: util.RoleAll}
+			if ok {
+				change.Role = assoc.EffectiveRole()
+			}
+			if restore {
+				target, source, err := restoreTarget(ctx, suffix, fallback)
+				if err != nil {
+					return err
+				}
+				change.New = target
+				if previous, err := util.CurrentHandler(ctx, suffix, change.Role); err == nil {
+					change.Previous = &previous
+				}
+				if err := util.SetDefaultApplication(ctx, target.BundleID, suffix.String(), change.Role); err != nil {
+					return fmt.Errorf("restoring the handler of %s: %w", suffix, err)
+				}
+				report.Restored, report.Source = target, source
+			}
+			if !systemOnly {
+				if err := config.RemoveAssociation(suffix); err != nil {
+					if report.Restored != nil {
+						return fmt.Errorf("restored the handler of %s, but removing the association failed: %w", suffix, err)
+					}
+					return fmt.Errorf("removing association: %w", err)
+				}
+				report.Config = true
+				change.Config, change.PreviousConfig = true, &assoc
+			}
+			if _, err := util.AppendJournal(change); err != nil {
+				util.Log.Warn("writing journal", "error", err)
+			}
+
+			return emit(report, func() {
+				if report.Config {
+					out.Successf("Removed association for: %s", suffix)
+				}
+				if report.Restored != nil {
+					how := "the handler before dutis"
+					if report.Source == restoreSourceFallback {
+						how = "fallback"
+					}
+					out.Successf("Restored %s → %s (%s)", suffix, handlerName(report.Restored), how)
+				}
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&restore, "restore", false, "also reset the system default to the handler before dutis")
+	cmd.Flags().StringVar(&fallback, "fallback", "", "app to restore when the handler before dutis is not known (implies --restore)")
+	cmd.Flags().BoolVar(&systemOnly, "system-only", false, "restore the system default but keep the config entry")
+	cmd.Flags().BoolVar(&configOnly, "config-only", false, "only remove the config entry (the default)")
+	_ = cmd.RegisterFlagCompletionFunc("fallback", completeBundleIDs)
+	return cmd
+}
+
+// Sources of a handler restored by `dutis remove`.
+const (
+	restoreSourceJournal  = "journal"
+	restoreSourceFallback = "fallback"
+)
+
+// restoreTarget picks the handler `dutis remove --restore` resets suffix
+// to: the one from before dutis first changed it, or else the fallback app.
+func restoreTarget(ctx context.Context, suffix util.Suffix, fallback string) (*util.Handler, string, error) {
+	entries, err := util.ReadJournal()
+	if err != nil {
+		return nil, "", fmt.Errorf("reading journal: %w", err)
+	}
+	original, touched := util.OriginalHandler(entries, suffix)
+	if original != nil && original.BundleID != "" {
+		return original, restoreSourceJournal, nil
+	}
+	if fallback != "" {
+		apps, err := getUtiMap(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		app, err := util.ResolveApp(ctx, fallback, apps)
+		if err != nil {
+			return nil, "", err
+		}
+		return &util.Handler{BundleID: app.Identifier, Name: app.Name}, restoreSourceFallback, nil
+	}
+	var why string
+	switch {
+	case !touched:
+		why = "dutis never changed it"
+	case original == nil:
+		why = "the handler before dutis is unknown"
+	default:
+		why = "it had no handler before dutis"
+	}
+	return nil, "", fmt.Errorf("no handler to restore for %s: %s; name one with --fallback <app>", suffix, why)
+}
+
+func newVersionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Show version information",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return emit(currentVersionInfo(), func() {
+				out.Printf("%s\n", Version)
+				out.Printf("Repository: %s\n", Repository)
+			})
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the application cache",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "refresh",
+			Short: "Rescan applications and rebuild the cache",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runCacheRefresh(cmd.Context())
+			},
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "Show whether the application cache is ready",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				info := util.UtiCacheInfo()
+				return emit(cacheReport{info}, func() {
+					if info.Ready {
+						out.Successf("Cache ready (%d applications, updated %s)",
+							info.Applications, info.UpdatedAt.Format("2006-01-02 15:04"))
+					} else {
+						out.Pendingf("Will build cache on first use")
+					}
+				})
+			},
+		},
+	)
+	return cmd
+}
+
+func runCacheRefresh(ctx context.Context) error {
+	out.Println("Refreshing application cache...")
+	utiMap, err := util.ListApplicationsUti(ctx)
+	if err != nil {
+		return fmt.Errorf("scanning applications: %w", err)
+	}
+	if err := util.SaveUtiCache(utiMap); err != nil {
+		return fmt.Errorf("saving cache: %w", err)
+	}
+	out.Successf("Cache refreshed with %d applications", len(utiMap))
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the config file",
+	}
+	cmd.AddCommand(newConfigMigrateCmd(), newConfigValidateCmd(), newConfigRestoreCmd())
+	return cmd
+}
+
+func newConfigMigrateCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the config to the current schema",
+		Long: `Upgrade the config to the current schema version, showing the changes.
+The previous config is kept as backup 1.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			result, err := util.MigrateConfig(dryRun)
+			if err != nil {
+				return fmt.Errorf("migrating config: %w", err)
+			}
+			report := migrateReport{
+				Path:   result.Path,
+				From:   result.From,
+				To:     result.To,
+				Steps:  []string{},
+				DryRun: dryRun,
+				Backup: result.BackupPath,
+			}
+			for _, m := range result.Applied {
+				report.Steps = append(report.Steps, m.Description)
+			}
+			return emit(report, func() {
+				if len(result.Applied) == 0 {
+					out.Printf("Config is already at version %s\n", result.To)
+					return
+				}
+				for _, m := range result.Applied {
+					out.Printf("  %q → %q: %s\n", m.From, m.To, m.Description)
+				}
+				out.Println()
+				printDiff(string(result.Before), string(result.After))
+				if dryRun {
+					out.Println("\nDry run, no changes written.")
+					return
+				}
+				out.Println()
+				out.Successf("Migrated %s to version %s", result.Path, result.To)
+				out.Printf("  Backup: %s\n", result.BackupPath)
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show the changes without writing them")
+	return cmd
+}
+
+func newConfigValidateCmd() *cobra.Command {
+	var strict bool
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config for problems",
+		Long: `Check the config for problems, reporting each with its file:line, a
+severity and a suggested fix. Exits non-zero when errors are found, or
+on warnings too with --strict.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			installed, err := installedBundleIDs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			diags, err := util.ValidateConfig(installed)
+			if err != nil {
+				return fmt.Errorf("validating config: %w", err)
+			}
+			err = emit(newValidateReport(diags), func() {
+				for _, d := range diags {
+					style := ui.Pending
+					if d.Severity == util.SeverityError {
+						style = ui.Failure
+					}
+					out.Styledf(style, "%s", d)
+				}
+				if len(diags) == 0 {
+					out.Successf("Config is valid")
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if util.HasErrors(diags) || (strict && len(diags) > 0) {
+				return fmt.Errorf("%d problem(s) found", len(diags))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&strict, "strict", false, "fail on warnings as well as errors")
+	return cmd
+}
+
+func newConfigRestoreCmd() *cobra.Command {
+	var list bool
+
+	cmd := &cobra.Command{
+		Use:   "restore [n]",
+		Short: "Roll the config back to backup n (default 1)",
+		Long: `Roll the config back to backup n, where 1 is the newest. The replaced
+config becomes backup 1, so a restore can itself be rolled back.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if list {
+				backups, err := util.ListConfigBackups()
+				if err != nil {
+					return fmt.Errorf("listing backups: %w", err)
+				}
+				if backups == nil {
+					backups = []util.ConfigBackup{}
+				}
+				return emit(backupList{backups}, func() {
+					if len(backups) == 0 {
+						out.Println("No config backups yet.")
+						return
+					}
+					for _, b := range backups {
+						out.Printf("  %d  %s  %s\n", b.Index, b.ModTime.Format("2006-01-02 15:04:05"), b.Path)
+					}
+				})
+			}
+
+			n := 1
+			if len(args) > 0 {
+				var err error
+				if n, err = strconv.Atoi(args[0]); err != nil {
+					return fmt.Errorf("invalid backup number: %s", args[0])
+				}
+			}
+			backupPath, err := util.RestoreConfigBackup(n)
+			if err != nil {
+				return fmt.Errorf("restoring config: %w", err)
+			}
+			return emit(restoreReport{backupPath}, func() {
+				out.Successf("Restored config from %s", backupPath)
+				out.Println("  The previous config is now backup 1.")
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&list, "list", false, "list the available backups")
+	return cmd
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newDoctorCmd() *cobra.Command {
+	var (
+		fix bool
+		yes bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check duti, swift, mdls, brew, the config, cache and scan roots",
+		Long: `Check everything dutis depends on and report versions, problems and
+how to fix them. Nothing is changed unless --fix is given, and then each
+fix (such as 'brew install duti') is confirmed first unless --yes is given.
+Exits non-zero while any check reports an error.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			checks := util.RunChecks(ctx)
+
+			if fix {
+				fixed, err := runFixes(cmd, checks, yes)
+				if err != nil {
+					return err
+				}
+				if fixed {
+					out.Println()
+					checks = util.RunChecks(ctx)
+				}
+			}
+
+			report := doctorReport{Checks: checks}
+			if err := emit(report, func() { printDoctorReport(report, fix) }); err != nil {
+				return err
+			}
+			if n := report.errors(); n > 0 {
+				return fmt.Errorf("%d check(s) failed", n)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "offer to install or repair what is missing")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "apply fixes without asking")
+	return cmd
+}
+
+// runFixes offers each available fix and runs the confirmed ones. It
+// reports whether anything was attempted.
+func runFixes(cmd *cobra.Command, checks []util.Check, yes bool) (bool, error) {
+	in := bufio.NewReader(cmd.InOrStdin())
+	if !yes && !ui.IsTerminal(os.Stdin) {
+		return false, fmt.Errorf("--fix needs a terminal to confirm each fix; pass --yes to apply them unattended")
+	}
+
+	attempted := false
+	for _, c := range checks {
+		if c.Status == util.CheckOK || !c.CanFix() {
+			continue
+		}
+		if !yes {
+			ok, err := confirm(in, fmt.Sprintf("%s: run '%s'?", c.Name, c.FixAction))
+			if err != nil {
+				return attempted, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		attempted = true
+		out.Printf("Running %s...\n", c.FixAction)
+		if err := c.Fix(cmd.Context()); err != nil {
+			if cmd.Context().Err() != nil {
+				return attempted, err
+			}
+			out.Failuref("%s: %v", c.Name, err)
+			continue
+		}
+		out.Successf("%s fixed", c.Name)
+	}
+	return attempted, nil
+}
+
+// confirm asks a yes/no question on out; anything but y or yes is no.
+func confirm(in *bufio.Reader, question string) (bool, error) {
+	out.Printf("%s [y/N] ", question)
+	answer, err := in.ReadString('\n')
+	if err == io.EOF {
+		out.Println()
+	} else if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+func printDoctorReport(report doctorReport, fixing bool) {
+	fixable := 0
+	for _, c := range report.Checks {
+		line := c.Name
+		if c.Version != "" {
+			line += " " + out.Paint(ui.Muted, c.Version)
+		}
+		if c.Path != "" && c.Name != "config" && c.Name != "cache" {
+			line += " (" + c.Path + ")"
+		} else if c.Path != "" {
+			line += ": " + c.Path
+		}
+		switch c.Status {
+		case util.CheckOK:
+			out.Successf("%s", line)
+		case util.CheckWarning:
+			out.Pendingf("%s", line)
+		default:
+			out.Failuref("%s", line)
+		}
+		if c.Detail != "" {
+			out.Styledf(ui.Muted, "    %s", c.Detail)
+		}
+		if c.Status != util.CheckOK && c.Hint != "" {
+			out.Printf("    → %s\n", c.Hint)
+		}
+		if c.Status != util.CheckOK && c.CanFix() {
+			fixable++
+		}
+	}
+	if fixable > 0 && !fixing {
+		out.Printf("\n%d problem(s) can be fixed with 'dutis doctor --fix'.\n", fixable)
+	}
+}
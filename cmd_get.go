@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+// getResult is the result of `dutis get`.
+type getResult struct {
+	Query         string      `json:"query" yaml:"query"`
+	File          string      `json:"file,omitempty" yaml:"file,omitempty"`
+	Suffix        util.Suffix `json:"suffix,omitempty" yaml:"suffix,omitempty"`
+	util.Handlers `yaml:",inline"`
+	Config        configStatus `json:"config" yaml:"config"`
+}
+
+type configStatus struct {
+	Configured  bool              `json:"configured" yaml:"configured"`
+	Matches     bool              `json:"matches" yaml:"matches"`
+	Association *util.Association `json:"association,omitempty" yaml:"association,omitempty"`
+}
+
+func newGetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <suffix|file>",
+		Short: "Show the current handler and all candidates for a suffix or file",
+		Long: `Show the content type (UTI) of a suffix or file, the current default
+application for each role, every registered candidate, and whether the
+current default matches the config.`,
+		Example: `  dutis get .md
+  dutis get ./README.md --json`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeConfiguredSuffixes,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := util.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			result := getResult{Query: args[0]}
+			var contentType string
+			if isFileArg(args[0]) {
+				result.File = args[0]
+				result.Suffix = fileSuffix(config, args[0])
+				contentType, err = util.ContentTypeForFile(cmd.Context(), args[0])
+			} else {
+				if result.Suffix, err = util.ParseSuffix(args[0]); err != nil {
+					return err
+				}
+				contentType, err = util.ContentTypeForSuffix(cmd.Context(), result.Suffix.String())
+			}
+			if err != nil {
+				return fmt.Errorf("determining content type: %w", err)
+			}
+
+			handlers, err := util.LookupHandlers(cmd.Context(), contentType)
+			if err != nil {
+				return err
+			}
+			result.Handlers = *handlers
+			if assoc, ok := config.GetAssociation(result.Suffix); ok {
+				result.Config = configStatus{
+					Configured:  true,
+					Matches:     result.Handlers.Matches(assoc),
+					Association: &assoc,
+				}
+			}
+
+			return emit(result, func() { printGetResult(result) })
+		},
+	}
+}
+
+// isFileArg reports whether arg names a file rather than a suffix.
+func isFileArg(arg string) bool {
+	if strings.ContainsRune(arg, filepath.Separator) {
+		return true
+	}
+	info, err := os.Stat(arg)
+	return err == nil && !info.IsDir()
+}
+
+// fileSuffix returns the longest configured suffix the file name ends
+// with, falling back to its last extension.
+func fileSuffix(config *util.Config, path string) util.Suffix {
+	name := strings.ToLower(filepath.Base(path))
+	var best util.Suffix
+	for suffix := range config.Associations {
+		if strings.HasSuffix(name, suffix.String()) && len(suffix) > len(best) {
+			best = suffix
+		}
+	}
+	if best != "" {
+		return best
+	}
+	suffix, _ := util.ParseSuffix(filepath.Ext(name))
+	return suffix
+}
+
+func printGetResult(r getResult) {
+	title := r.Suffix.String()
+	if r.File != "" {
+		title = r.File
+	}
+	out.Styledf(ui.Heading, "%s", title)
+	out.Printf("  Content type: %s\n\n", r.ContentType)
+
+	declared := r.Source == util.HandlerSourceInfoPlist
+	out.Println("  Default handlers:")
+	switch {
+	case declared:
+		out.Styledf(ui.Pending, "    unknown without LaunchServices")
+	case len(r.Defaults) == 0:
+		out.Styledf(ui.Pending, "    none")
+	}
+	for _, role := range util.DefaultRoles {
+		if h, ok := r.Defaults[role]; ok {
+			out.Printf("    %-8s %-30s %s\n", role, h.Name, h.BundleID)
+		}
+	}
+
+	if declared {
+		out.Printf("\n  Candidates declared in Info.plist (%d):\n", len(r.Candidates))
+	} else {
+		out.Printf("\n  Candidates (%d):\n", len(r.Candidates))
+	}
+	current := r.Defaults[util.RoleAll]
+	for _, h := range r.Candidates {
+		marker := ""
+		if strings.EqualFold(h.BundleID, current.BundleID) {
+			marker = "  " + out.Paint(ui.Success, "← default")
+		}
+		out.Printf("    • %-30s %s%s\n", h.Name, h.BundleID, marker)
+	}
+
+	out.Println()
+	status := out.Indent("  Config: ")
+	switch {
+	case !r.Config.Configured:
+		status.Pendingf("%s is not in the config", r.Suffix)
+	case declared:
+		status.Pendingf("wants %s (%s); the current default is unknown",
+			r.Config.Association.Application, r.Config.Association.BundleID)
+	case r.Config.Matches:
+		status.Successf("matches (%s)", r.Config.Association.Application)
+	default:
+		status.Failuref("config wants %s (%s) for role %s",
+			r.Config.Association.Application, r.Config.Association.BundleID, r.Config.Association.EffectiveRole())
+	}
+}
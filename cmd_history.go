@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newHistoryCmd() *cobra.Command {
+	var (
+		limit     int
+		suffixArg string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the journal of association changes, newest first",
+		Long: `List the changes dutis made to default handlers and config.yaml, newest
+first, from the journal in ~/.dutis/journal.jsonl. Each entry shows the
+handler before and after the change and the command that made it; the
+ones 'dutis undo' reverted are marked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var suffix util.Suffix
+			if suffixArg != "" {
+				var err error
+				if suffix, err = util.ParseSuffix(suffixArg); err != nil {
+					return err
+				}
+			}
+			entries, err := util.ReadJournal()
+			if err != nil {
+				return fmt.Errorf("reading journal: %w", err)
+			}
+
+			undone := make(map[int]int)
+			for _, e := range entries {
+				if e.Undoes != 0 {
+					undone[e.Undoes] = e.ID
+				}
+			}
+			report := historyReport{Entries: []historyEntry{}}
+			for i := len(entries) - 1; i >= 0 && (limit <= 0 || len(report.Entries) < limit); i-- {
+				if suffix == "" || entries[i].Suffix == suffix {
+					report.Entries = append(report.Entries, historyEntry{entries[i], undone[entries[i].ID]})
+				}
+			}
+
+			return emit(report, func() {
+				if len(report.Entries) == 0 {
+					out.Println("No changes recorded yet.")
+					return
+				}
+				out.Printf("%-5s %-20s %-10s %-18s %s\n", "ID", "TIME", "TARGET", "COMMAND", "CHANGE")
+				for _, e := range report.Entries {
+					line := fmt.Sprintf("%-5d %-20s %-10s %-18s %s", e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), e.Target(), e.Command, describeChange(e.JournalEntry))
+					if e.UndoneBy != 0 {
+						line = out.Paint(ui.Muted, fmt.Sprintf("%s (undone by %d)", line, e.UndoneBy))
+					}
+					out.Println(line)
+				}
+			})
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "show at most this many entries (0 for all)")
+	cmd.Flags().StringVar(&suffixArg, "suffix", "", "only show changes of this suffix")
+	return cmd
+}
+
+func newUndoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "undo [n]",
+		Short: "Revert the last n association changes (default 1)",
+		Long: `Revert the last n changes recorded in the journal, newest first: the
+default handler goes back to the one it replaced and config.yaml to the
+entry it had. Changes an earlier undo reverted are skipped, and every
+revert is journaled itself, so 'dutis history' shows it.`,
+		Example: `  dutis undo
+  dutis undo 3`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n := 1
+			if len(args) == 1 {
+				var err error
+				if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+					return fmt.Errorf("invalid count %q: want a positive number", args[0])
+				}
+			}
+			entries, err := util.ReadJournal()
+			if err != nil {
+				return fmt.Errorf("reading journal: %w", err)
+			}
+			undoable := util.Undoable(entries)
+			if len(undoable) == 0 {
+				return fmt.Errorf("nothing to undo")
+			}
+			undoable = undoable[:min(n, len(undoable))]
+
+			config, err := util.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+			ctx := cmd.Context()
+			results := util.Undo(ctx, config, undoable)
+			report := undoReport{Results: results}
+			if report.Results == nil {
+				report.Results = []util.UndoResult{}
+			}
+			if err := emit(report, func() { printUndoResults(results) }); err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			failed := 0
+			for _, r := range results {
+				if r.Status == util.UndoStatusFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d changes could not be undone", failed, len(undoable))
+			}
+			return nil
+		},
+	}
+}
+
+func printUndoResults(results []util.UndoResult) {
+	for _, r := range results {
+		switch {
+		case r.Status == util.UndoStatusFailed:
+			out.Indent("  ").Failuref("%s: %s", r.Suffix, r.Error)
+		case r.Error != "" && r.Restored != nil:
+			out.Indent("  ").Failuref("%s: handler restored to %s, but %s", r.Suffix, handlerName(r.Restored), r.Error)
+		case r.Error != "":
+			out.Indent("  ").Pendingf("%s: config entry restored, but %s (undid %d)", r.Suffix, r.Error, r.ID)
+		case r.Restored != nil:
+			out.Indent("  ").Successf("%s → %s (undid %d)", r.Suffix, handlerName(r.Restored), r.ID)
+		default:
+			out.Indent("  ").Successf("%s: config entry restored (undid %d)", r.Suffix, r.ID)
+		}
+	}
+}
+
+// describeChange summarizes a journal entry as "before → after".
+func describeChange(e util.JournalEntry) string {
+	var s string
+	if e.New != nil {
+		s = handlerName(e.Previous) + " → " + handlerName(e.New)
+	}
+	if e.Config {
+		config := "config " + associationName(e.PreviousConfig) + " → " + associationName(e.NewConfig)
+		if s == "" {
+			return config
+		}
+		s += ", " + config
+	}
+	return s
+}
+
+// handlerName names h for display: nil is an unknown handler and a zero
+// Handler none at all.
+func handlerName(h *util.Handler) string {
+	switch {
+	case h == nil:
+		return "unknown"
+	case h.BundleID == "":
+		return "none"
+	case h.Name != "":
+		return h.Name
+	}
+	return h.BundleID
+}
+
+func associationName(a *util.Association) string {
+	if a == nil {
+		return "none"
+	}
+	return a.Application
+}
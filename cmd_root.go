@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+type globalOptions struct {
+	configPath string
+	output     outputFormat
+	json       bool
+	quiet      bool
+	noColor    bool
+	theme      string
+	verbose    int
+	logFile    string
+	timeout    time.Duration
+}
+
+var (
+	globals globalOptions
+
+	// out prints human-readable output and errOut prints errors; see
+	// setupOutput.
+	out    = ui.New(os.Stdout, false, nil)
+	errOut = ui.New(os.Stderr, false, nil)
+
+	// stopTimeout releases the --timeout context; main calls it on exit.
+	stopTimeout context.CancelFunc = func() {}
+)
+
+func newRootCmd() *cobra.Command {
+	var refreshCache, classic bool
+
+	root := &cobra.Command{
+		Use:   "dutis",
+		Short: "Select default applications for file suffixes",
+		Long: `dutis selects default applications for file suffixes. It is a wrapper
+around duti (https://github.com/moretension/duti).
+
+Without a command, dutis starts the interactive mode: a full-screen list
+of suffixes with their current and configured handlers, or line-based
+prompts with --classic or when not running in a terminal. Every
+association set through dutis is recorded in the config file so it can be
+listed, removed and re-applied later.`,
+		Version:       Version,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			util.JournalCommand = cmd.CommandPath()
+			if globals.timeout > 0 {
+				ctx, cancel := context.WithTimeout(cmd.Context(), globals.timeout)
+				cmd.SetContext(ctx)
+				stopTimeout = cancel
+			}
+			return setupOutput()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if refreshCache {
+				return runCacheRefresh(cmd.Context())
+			}
+			if useTUI(classic) {
+				return runTUI(cmd.Context())
+			}
+			return runInteractive(cmd.Context())
+		},
+	}
+	root.SetVersionTemplate("{{.Version}}\nRepository: " + Repository + "\n")
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&globals.configPath, "config", "", "config file (default ~/.dutis/config.yaml)")
+	flags.StringVarP((*string)(&globals.output), "output", "o", string(formatTable), "output format: table, json, yaml or tsv")
+	flags.BoolVar(&globals.json, "json", false, "shorthand for --output json")
+	flags.BoolVarP(&globals.quiet, "quiet", "q", false, "only print errors")
+	flags.BoolVar(&globals.noColor, "no-color", false, "disable colored output (also NO_COLOR)")
+	flags.CountVarP(&globals.verbose, "verbose", "v", "log more detail to stderr (-vv traces every command run)")
+	flags.StringVar(&globals.logFile, "log-file", "", "append the log to this file as JSON lines")
+	flags.DurationVar(&globals.timeout, "timeout", 0, "give up after this long, e.g. 2m (default no limit)")
+	flags.DurationVar(&util.CommandTimeout, "command-timeout", util.CommandTimeout, "limit for each duti, mdls or swift run (0 for none)")
+	flags.StringVar(&globals.theme, "theme", os.Getenv("DUTIS_THEME"), "color theme: "+strings.Join(ui.ThemeNames(), ", "))
+
+	root.Flags().BoolVar(&classic, "classic", false, "use line-based prompts instead of the full-screen interface")
+	root.Flags().BoolVar(&refreshCache, "refresh-cache", false, "refresh the application cache")
+	_ = root.Flags().MarkDeprecated("refresh-cache", "use 'dutis cache refresh' instead")
+	_ = root.RegisterFlagCompletionFunc("output", cobra.FixedCompletions(
+		[]string{"table", "json", "yaml", "tsv"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = root.RegisterFlagCompletionFunc("theme", cobra.FixedCompletions(ui.ThemeNames(), cobra.ShellCompDirectiveNoFileComp))
+
+	root.AddCommand(
+		newSetCmd(),
+		newGetCmd(),
+		newListCmd(),
+		newApplyCmd(),
+		newRemoveCmd(),
+		newHistoryCmd(),
+		newUndoCmd(),
+		newSyncCmd(),
+		newWatchCmd(),
+		newAgentCmd(),
+		newConfigCmd(),
+		newCacheCmd(),
+		newDoctorCmd(),
+		newVersionCmd(),
+	)
+	return root
+}
+
+// setupOutput applies the global flags once they have been parsed.
+func setupOutput() error {
+	if globals.configPath != "" {
+		util.SetConfigPath(globals.configPath)
+	}
+	if globals.json {
+		globals.output = formatJSON
+	}
+	format, err := parseOutputFormat(string(globals.output))
+	if err != nil {
+		return err
+	}
+	globals.output = format
+	if err := setupLogging(); err != nil {
+		return err
+	}
+	theme, err := ui.LoadTheme(globals.theme, os.Getenv("DUTIS_COLORS"))
+	if err != nil {
+		return err
+	}
+
+	errOut = ui.New(os.Stderr, ui.ColorEnabled(os.Stderr, globals.noColor), theme)
+	switch {
+	case globals.quiet:
+		out = ui.New(io.Discard, false, theme)
+	case globals.output != formatTable:
+		// Keep stdout parseable: progress messages go to stderr instead.
+		out = errOut
+	default:
+		out = ui.New(os.Stdout, ui.ColorEnabled(os.Stdout, globals.noColor), theme)
+	}
+	return nil
+}
+
+// completeConfiguredSuffixes completes suffixes that have an association.
+func completeConfiguredSuffixes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	_ = setupOutput()
+	config, err := util.LoadConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var suffixes []string
+	for _, assoc := range config.ListAssociations() {
+		suffixes = append(suffixes, fmt.Sprintf("%s\t%s", assoc.Suffix, assoc.Application))
+	}
+	return suffixes, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBundleIDs completes bundle IDs of installed applications. It only
+// reads the application cache, so completion never triggers a scan.
+func completeBundleIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	_ = setupOutput()
+	descriptions := make(map[string]string)
+	if cached, ok := util.LoadUtiCache(); ok {
+		for _, uti := range cached {
+			descriptions[uti.Identifier] = uti.Name
+		}
+	}
+	if config, err := util.LoadConfig(); err == nil {
+		for _, assoc := range config.Associations {
+			descriptions[assoc.BundleID] = assoc.Application
+		}
+	}
+
+	var ids []string
+	for id, name := range descriptions {
+		if id != "" {
+			ids = append(ids, fmt.Sprintf("%s\t%s", id, name))
+		}
+	}
+	sort.Strings(ids)
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
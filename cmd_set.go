@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newSetCmd() *cobra.Command {
+	var (
+		roleName string
+		noSave   bool
+		dryRun   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "set <suffix>... <app>",
+		Short: "Set the default application for one or more suffixes",
+		Long: `Set the default application for one or more suffixes without the
+interactive prompt. The application may be given as a bundle ID, an
+application name with or without ".app", a path to an .app bundle, or a
+part of exactly one application's name or bundle ID ("studio").
+Each association is recorded in the config unless --no-save is given.`,
+		Example: `  dutis set .md "Visual Studio Code"
+  dutis set .md com.microsoft.VSCode
+  dutis set .go .rs .py /Applications/Zed.app --role editor`,
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: completeSetArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			role, err := util.ParseRole(roleName)
+			if err != nil {
+				return err
+			}
+
+			var suffixes []util.Suffix
+			for _, arg := range args[:len(args)-1] {
+				suffix, err := util.ParseSuffix(arg)
+				if err != nil {
+					return err
+				}
+				suffixes = append(suffixes, suffix)
+			}
+
+			ctx := cmd.Context()
+			apps, err := getUtiMap(ctx)
+			if err != nil {
+				return err
+			}
+			app, err := util.ResolveApp(ctx, args[len(args)-1], apps)
+			if err != nil {
+				return err
+			}
+
+			report := setReport{}
+			var config *util.Config
+			if !noSave && !dryRun {
+				if config, err = util.LoadConfig(); err != nil {
+					return fmt.Errorf("loading config: %w", err)
+				}
+			}
+
+			if dryRun {
+				for _, suffix := range suffixes {
+					report.Results = append(report.Results, setResult{Suffix: suffix, Application: app.Name, BundleID: app.Identifier, Role: role, Status: "dry-run"})
+				}
+			} else {
+				report.Results = applyAssociations(ctx, config, suffixes, app, role)
+			}
+			failed := 0
+			for _, res := range report.Results {
+				if res.Error != "" {
+					failed++
+				}
+			}
+
+			err = emit(report, func() { printSetResults(report.Results) })
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d suffixes failed", failed, len(suffixes))
+			}
+			return nil
+		},
+	}
+
+	roles := make([]string, len(util.Roles))
+	for i, r := range util.Roles {
+		roles[i] = string(r)
+	}
+	cmd.Flags().StringVar(&roleName, "role", string(util.RoleAll), "handler role: "+strings.Join(roles, ", "))
+	cmd.Flags().BoolVar(&noSave, "no-save", false, "don't record the association in the config")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be set without changing anything")
+	_ = cmd.RegisterFlagCompletionFunc("role", cobra.FixedCompletions(roles, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+// applyAssociations sets app as the handler of each suffix and records
+// the ones that were set in config with a single write, unless config is
+// nil. Each change is journaled with the handler it replaced. It stops at
+// the first suffix the context cancels.
+func applyAssociations(ctx context.Context, config *util.Config, suffixes []util.Suffix, app util.Uti, role util.Role) []setResult {
+	batch := make([]assignment, len(suffixes))
+	for i, suffix := range suffixes {
+		batch[i] = assignment{suffix, app}
+	}
+	return applyAssignments(ctx, config, batch, role)
+}
+
+// assignment is an application chosen for a suffix.
+type assignment struct {
+	Suffix util.Suffix
+	App    util.Uti
+}
+
+// applyAssignments is applyAssociations for a batch that may name several
+// applications: every handler is set first, then all of them are recorded
+// in config with a single write. Results are in the order of batch.
+func applyAssignments(ctx context.Context, config *util.Config, batch []assignment, role util.Role) []setResult {
+	var results []setResult
+	var set []util.Association
+	for _, a := range batch {
+		if ctx.Err() != nil {
+			break
+		}
+		res := setResult{Suffix: a.Suffix, Application: a.App.Name, BundleID: a.App.Identifier, Role: role, Status: "set"}
+		res.change = &util.JournalEntry{Suffix: a.Suffix, Role: role, New: &util.Handler{BundleID: a.App.Identifier, Name: a.App.Name}}
+		if previous, err := util.CurrentHandler(ctx, a.Suffix, role); err == nil {
+			res.change.Previous = &previous
+		}
+		if err := util.SetDefaultApplication(ctx, a.App.Identifier, a.Suffix.String(), role); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			res.Status, res.Error, res.change = "failed", err.Error(), nil
+		} else {
+			set = append(set, util.Association{Suffix: a.Suffix, Application: a.App.Name, BundleID: a.App.Identifier, Role: role})
+		}
+		results = append(results, res)
+	}
+
+	if config != nil && len(set) > 0 {
+		previous := make(map[util.Suffix]*util.Association)
+		for _, assoc := range set {
+			if old, ok := config.GetAssociation(assoc.Suffix); ok {
+				previous[assoc.Suffix] = &old
+			}
+		}
+		err := config.SetAssociations(set)
+		for i := range results {
+			res := &results[i]
+			switch {
+			case res.Status != "set":
+			case err != nil:
+				res.Error = fmt.Sprintf("could not save to config: %v", err)
+			default:
+				res.Saved = true
+				assoc, _ := config.GetAssociation(res.Suffix)
+				res.change.Config, res.change.PreviousConfig, res.change.NewConfig = true, previous[res.Suffix], &assoc
+			}
+		}
+	}
+
+	var changes []util.JournalEntry
+	for _, res := range results {
+		if res.change != nil {
+			changes = append(changes, *res.change)
+		}
+	}
+	written, err := util.AppendJournal(changes...)
+	if err != nil {
+		util.Log.Warn("writing journal", "error", err)
+	}
+	for i, j := 0, 0; i < len(results) && j < len(written); i++ {
+		if results[i].change != nil {
+			results[i].change = &written[j]
+			j++
+		}
+	}
+	return results
+}
+
+// printSetResults prints one line per suffix of `dutis set`.
+func printSetResults(results []setResult) {
+	for _, res := range results {
+		switch {
+		case res.Status == "dry-run":
+			out.Printf("Would set %s → %s (%s) [%s]\n", res.Suffix, res.Application, res.BundleID, res.Role)
+		case res.Status == "failed":
+			out.Indent("  ").Failuref("%s: %s", res.Suffix, res.Error)
+		case res.Error != "":
+			out.Indent("  ").Failuref("%s: set, but %s", res.Suffix, res.Error)
+		default:
+			out.Indent("  ").Successf("%s → %s (%s)", res.Suffix, res.Application, res.BundleID)
+		}
+	}
+}
+
+// completeSetArgs completes suffixes for words starting with a dot and
+// installed bundle IDs otherwise.
+func completeSetArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 || strings.HasPrefix(toComplete, ".") {
+		var suffixes []string
+		for _, s := range util.KnownSuffixes() {
+			suffixes = append(suffixes, s.Text+"\t"+s.Description)
+		}
+		return suffixes, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeBundleIDs(cmd, args, toComplete)
+}
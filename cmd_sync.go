@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newSyncCmd() *cobra.Command {
+	var (
+		dryRun bool
+		yes    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Make the system handlers match the config exactly",
+		Long: `Treat config.yaml as the source of truth for the handlers of its
+suffixes, UTIs (utis:) and URL schemes (schemes:): set the missing ones and
+fix the ones that drifted. Entries marked 'managed: true' are remembered,
+and once deleted from the config they are reverted to their 'fallback'
+bundle ID. The plan is printed first and confirmed unless --yes is given;
+--dry-run only prints it.`,
+		Example: `  dutis sync --dry-run
+  dutis sync --yes`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := util.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+			state, err := util.LoadSyncState()
+			if err != nil {
+				return fmt.Errorf("reading sync state: %w", err)
+			}
+
+			ctx := cmd.Context()
+			sys := util.SystemHandlers{}
+			items := util.PlanSync(ctx, sys, config, state)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pending := 0
+			for _, item := range items {
+				if item.Pending() {
+					pending++
+				}
+			}
+
+			report := syncReport{Items: items, DryRun: dryRun}
+			if report.Items == nil {
+				report.Items = []util.SyncItem{}
+			}
+			if dryRun {
+				return emit(report, func() { printSyncPlan(items, pending) })
+			}
+			if pending > 0 && !yes && !ui.IsTerminal(os.Stdin) {
+				return fmt.Errorf("sync needs a terminal to confirm the plan; pass --yes to apply it unattended or --dry-run to only print it")
+			}
+			// The plan is shown before anything changes, with --yes too; only
+			// the confirmation is skipped.
+			if pending > 0 && (!yes || globals.output == formatTable) {
+				printSyncPlan(items, pending)
+				if !yes {
+					ok, err := confirm(bufio.NewReader(cmd.InOrStdin()), fmt.Sprintf("Apply %d change(s)?", pending))
+					if err != nil {
+						return err
+					}
+					if !ok {
+						out.Println("Nothing changed.")
+						return nil
+					}
+				}
+				out.Println()
+			}
+
+			// Applying even without pending changes records new managed
+			// entries, so removing them later is noticed.
+			items, applyErr := util.ApplySync(ctx, sys, config, state, items)
+			report.Items = items
+			failed := 0
+			for _, item := range items {
+				if item.Status == util.SyncStatusFailed {
+					failed++
+				}
+			}
+			if err := emit(report, func() { printSyncResults(items, pending) }); err != nil {
+				return err
+			}
+			if applyErr != nil {
+				return applyErr
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d changes failed", failed, pending)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the plan without changing anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "apply the plan without asking")
+	return cmd
+}
+
+// printSyncPlan prints what sync would change, then the entries that are
+// already in sync or skipped.
+func printSyncPlan(items []util.SyncItem, pending int) {
+	if pending == 0 {
+		out.Successf("Everything is in sync (%d entries).", len(items))
+	} else {
+		out.Styledf(ui.Title, "Plan: %d change(s)", pending)
+	}
+	inSync := 0
+	for _, item := range items {
+		switch {
+		case item.Pending():
+			out.Printf("  %-7s %-20s %s → %s%s\n", item.Action, item.Target, handlerName(item.Current), handlerName(item.Want), roleSuffix(item))
+		case item.Action == util.SyncSkip:
+			out.Indent("  ").Pendingf("%s: %s", item.Target, item.Reason)
+		default:
+			inSync++
+		}
+	}
+	if pending > 0 && inSync > 0 {
+		out.Styledf(ui.Muted, "  %d already in sync", inSync)
+	}
+}
+
+// printSyncResults prints the outcome of each change sync made.
+func printSyncResults(items []util.SyncItem, pending int) {
+	if pending == 0 {
+		printSyncPlan(items, pending)
+		return
+	}
+	for _, item := range items {
+		switch item.Status {
+		case util.SyncStatusDone:
+			out.Indent("  ").Successf("%s → %s (%s)", item.Target, handlerName(item.Want), item.Action)
+		case util.SyncStatusFailed:
+			out.Indent("  ").Failuref("%s: %s", item.Target, item.Error)
+		default:
+			if item.Action == util.SyncSkip {
+				out.Indent("  ").Pendingf("%s: %s", item.Target, item.Reason)
+			}
+		}
+	}
+}
+
+// roleSuffix shows the role of an item unless it applies to all roles.
+func roleSuffix(item util.SyncItem) string {
+	if item.Role == util.RoleAll || item.Kind == util.TargetScheme {
+		return ""
+	}
+	return " [" + string(item.Role) + "]"
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func newWatchCmd() *cobra.Command {
+	opts := util.WatchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Keep re-applying configured handlers when they drift",
+		Long: `Run until stopped, re-asserting the handlers of config.yaml whenever
+something else (an installer, an app update, macOS) changes them. Every
+entry is checked each --interval, and sooner when the application folders,
+the LaunchServices preferences or the config file change. A handler that
+keeps drifting is corrected at most --max-corrections times per --window.
+Every correction is printed, logged and journaled, so 'dutis undo' can
+revert it. Needs LaunchServices (macOS with swift) to read the handlers.`,
+		Example: `  dutis watch
+  dutis watch --interval 1m --log-file ~/.dutis/watch.log`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			if !util.HasCapability(ctx, util.CapLaunchServices) {
+				return fmt.Errorf("watch needs LaunchServices to read the current handlers: %s", launchServicesReason(ctx))
+			}
+			if _, err := util.LoadConfig(); err != nil {
+				return fmt.Errorf("loading config: %w", err)
+			}
+
+			opts.Paths = util.DefaultWatchPaths()
+			w := util.NewWatcher(opts)
+			out.Printf("Watching the handlers in %s: every %s and on changes to %d paths. Press Ctrl+C to stop.\n",
+				util.ConfigPath(), opts.Interval, len(opts.Paths))
+
+			// Corrections are written as they happen, in every format.
+			corrections := newStream(os.Stdout, globals.output)
+			var writeErr error
+			err := w.Run(ctx, func(c util.Correction) {
+				if globals.output == formatTable {
+					printCorrection(c)
+				} else if err := corrections.write(watchCorrection(c)); err != nil && writeErr == nil {
+					writeErr = err
+					util.Log.Warn("writing correction", "error", err)
+				}
+			})
+			// Stopping, by signal or --timeout, is how watch ends.
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				err = nil
+			}
+			if closeErr := corrections.close(); writeErr == nil {
+				writeErr = closeErr
+			}
+			return errors.Join(err, writeErr)
+		},
+	}
+	cmd.Flags().DurationVar(&opts.Interval, "interval", util.DefaultWatchInterval, "check every entry this often")
+	cmd.Flags().DurationVar(&opts.Poll, "poll", util.DefaultWatchPoll, "look for changes to the watched paths this often")
+	cmd.Flags().DurationVar(&opts.Cooldown, "cooldown", util.DefaultWatchCooldown, "least time between checks triggered by changes")
+	cmd.Flags().IntVar(&opts.MaxFixes, "max-corrections", util.DefaultWatchMaxFixes, "correct a drifting handler at most this often per window")
+	cmd.Flags().DurationVar(&opts.FixesSpan, "window", util.DefaultWatchFixesSpan, "window of --max-corrections")
+	return cmd
+}
+
+func printCorrection(c util.Correction) {
+	at := c.Time.Local().Format("2006-01-02 15:04:05")
+	switch c.Status {
+	case util.CorrectionDone:
+		out.Successf("%s %s: %s → %s (%s)", at, c.Target, handlerName(c.From), handlerName(c.To), c.Trigger)
+	case util.CorrectionRateLimited:
+		out.Pendingf("%s %s keeps drifting to %s; left alone for now", at, c.Target, handlerName(c.From))
+	default:
+		out.Failuref("%s %s: %s", at, c.Target, c.Error)
+	}
+}
+
+// launchServicesReason explains why LaunchServices is unavailable.
+func launchServicesReason(ctx context.Context) string {
+	for _, c := range util.ProbeCapabilities(ctx) {
+		if c.Name == util.CapLaunchServices && c.Reason != "" {
+			return c.Reason
+		}
+	}
+	return "not available"
+}
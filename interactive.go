@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/tobiashochguertel/dutis/tui"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+// useTUI reports whether interactive mode can be full-screen: both ends
+// are terminals that understand cursor movement and --classic is not set.
+func useTUI(classic bool) bool {
+	return !classic && os.Getenv("TERM") != "dumb" && ui.IsTerminal(os.Stdin) && ui.IsTerminal(os.Stdout)
+}
+
+// runTUI runs the full-screen interactive mode and prints what it applied.
+func runTUI(ctx context.Context) error {
+	config, err := util.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+
+	// Anything printed to the terminal while the TUI owns it would garble
+	// the screen: progress is dropped and the log only goes to --log-file.
+	screen, savedOut, savedLog := out, out, util.Log
+	out = ui.New(io.Discard, false, nil)
+	if logFile == nil {
+		util.Log = slog.New(slog.DiscardHandler)
+	}
+	s := newSession(config)
+	results, err := tui.Run(ctx, &tuiBackend{session: s, lookups: make(chan struct{}, tuiLookups)}, screen)
+	out, util.Log = savedOut, savedLog
+
+	printTUIResults(results)
+	s.close(ctx)
+	return err
+}
+
+func printTUIResults(results []tui.Result) {
+	if len(results) == 0 {
+		out.Styledf(ui.Muted, "No changes applied")
+		return
+	}
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			out.Failuref("%s: %v", r.Suffix, r.Err)
+		case !r.Saved:
+			out.Pendingf("%s → %s (%s), not saved to config", r.Suffix, r.App.Name, r.App.Identifier)
+		default:
+			out.Successf("%s → %s (%s)", r.Suffix, r.App.Name, r.App.Identifier)
+		}
+	}
+}
+
+// tuiLookups bounds the handler lookups the TUI runs at once; each one
+// starts a swift process.
+const tuiLookups = 4
+
+// tuiBackend gives the TUI the functions the commands use and records
+// the changes in the session.
+type tuiBackend struct {
+	session *session
+	lookups chan struct{}
+}
+
+// Entries lists the configured suffixes first, then the rest of the
+// catalogue.
+func (b *tuiBackend) Entries() []tui.Entry {
+	var entries []tui.Entry
+	seen := make(map[util.Suffix]bool)
+	for _, assoc := range b.session.config.ListAssociations() {
+		entries = append(entries, tui.Entry{Suffix: assoc.Suffix, Configured: &assoc})
+		seen[assoc.Suffix] = true
+	}
+	for _, s := range util.KnownSuffixes() {
+		suffix, err := util.ParseSuffix(s.Text)
+		if err != nil || seen[suffix] {
+			continue
+		}
+		entries = append(entries, tui.Entry{Suffix: suffix, Description: s.Description})
+		seen[suffix] = true
+	}
+	return entries
+}
+
+func (b *tuiBackend) Current(ctx context.Context, suffix util.Suffix) (util.Handler, error) {
+	select {
+	case b.lookups <- struct{}{}:
+		defer func() { <-b.lookups }()
+	case <-ctx.Done():
+		return util.Handler{}, ctx.Err()
+	}
+	return util.CurrentHandler(ctx, suffix, util.RoleAll)
+}
+
+func (b *tuiBackend) Apps(ctx context.Context) ([]util.Uti, error) {
+	apps, err := getUtiMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]util.Uti, 0, len(apps))
+	for _, app := range apps {
+		list = append(list, app)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (b *tuiBackend) Recommended(ctx context.Context, suffix util.Suffix) []string {
+	return util.LSCopyAllRoleHandlersForContentType(ctx, suffix.String())
+}
+
+func (b *tuiBackend) Recent() []util.RecentApp {
+	return b.session.history.Apps
+}
+
+// Apply sets each change like `dutis set` and records all of them in the
+// config with a single write.
+func (b *tuiBackend) Apply(ctx context.Context, changes []tui.Change) []tui.Result {
+	batch := make([]assignment, len(changes))
+	for i, c := range changes {
+		batch[i] = assignment{c.Suffix, c.App}
+	}
+	var results []tui.Result
+	// applyBatch returns results in the order of changes, stopping early
+	// only when ctx is done.
+	for i, res := range b.session.applyBatch(ctx, batch) {
+		r := tui.Result{Change: changes[i], Saved: res.Saved}
+		if res.Status == "failed" {
+			r.Err = errors.New(res.Error)
+		}
+		results = append(results, r)
+	}
+	return results
+}
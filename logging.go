@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+// logFile is the open --log-file, closed by main on exit.
+var logFile *os.File
+
+// logLevel maps the number of -v flags to a level: warnings by default,
+// info (timings, cache hits and misses, failed commands) with -v and a
+// trace of every subprocess with -vv.
+func logLevel(verbosity int) slog.Level {
+	switch {
+	case verbosity >= 2:
+		return slog.LevelDebug
+	case verbosity == 1:
+		return slog.LevelInfo
+	}
+	return slog.LevelWarn
+}
+
+// setupLogging points util.Log at stderr, or at --log-file, which is
+// appended to as JSON lines. Without -v a log file records at debug level,
+// since nobody asks for a log file to find it empty.
+func setupLogging() error {
+	if logFile != nil {
+		return nil
+	}
+	level := logLevel(globals.verbose)
+	var handler slog.Handler
+	if globals.logFile != "" {
+		f, err := os.OpenFile(globals.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("opening log file: %w", err)
+		}
+		logFile = f
+		if globals.verbose == 0 {
+			level = slog.LevelDebug
+		}
+		handler = slog.NewJSONHandler(f, &slog.HandlerOptions{Level: level})
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	}
+	util.Log = slog.New(handler)
+	return nil
+}
+
+func closeLogging() {
+	if logFile != nil {
+		logFile.Close()
+	}
+}
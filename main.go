@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/c-bata/go-prompt"
+	"github.com/tobiashochguertel/dutis/ui"
 	"github.com/tobiashochguertel/dutis/util"
 	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 )
 
 const (
@@ -16,276 +24,402 @@ const (
 
 var (
 	utiMap               map[string]util.Uti
-	utiMapOnce           sync.Once
+	utiMapMu             sync.Mutex
 	consecutiveInterrupts = 0
 )
 
-func getUtiMap() map[string]util.Uti {
-	utiMapOnce.Do(func() {
-		if cached, ok := util.LoadUtiCache(); ok {
-			fmt.Println("\033[2;37m(using cached application data)\033[0m")
-			utiMap = cached
-		} else {
-			fmt.Println("\033[2;37m(scanning applications...)\033[0m")
-			utiMap = util.ListApplicationsUti()
-			_ = util.SaveUtiCache(utiMap)
-		}
-	})
-	return utiMap
+// getUtiMap returns the installed applications, from the cache or a scan.
+// A successful scan is kept for the rest of the run.
+func getUtiMap(ctx context.Context) (map[string]util.Uti, error) {
+	utiMapMu.Lock()
+	defer utiMapMu.Unlock()
+	if utiMap != nil {
+		return utiMap, nil
+	}
+	if cached, ok := util.LoadUtiCache(); ok {
+		out.Styledf(ui.Muted, "(using cached application data)")
+		utiMap = cached
+		return utiMap, nil
+	}
+	out.Styledf(ui.Muted, "(scanning applications...)")
+	scanned, err := util.ListApplicationsUti(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scanning applications: %w", err)
+	}
+	_ = util.SaveUtiCache(scanned)
+	utiMap = scanned
+	return utiMap, nil
 }
 
 const YouSelectPrompt = "You selected "
 
-func chooseUti() string {
-	fmt.Println("Please input uti.(Tab for auto complement)")
+// chooseUti asks for an application, suggesting the best fuzzy matches
+// first, raised by boosts. The answer may be anything util.ResolveApp
+// accepts; ok is false when it is empty or resolves to no single app.
+func chooseUti(ctx context.Context, s *session, apps map[string]util.Uti, boosts util.Boosts) (app util.Uti, ok bool) {
+	out.Println("Please input uti.(Tab for auto complement)")
 
+	list := make([]util.Uti, 0, len(apps))
+	for _, v := range apps {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
 	promptHandler := func(d prompt.Document) []prompt.Suggest {
 		var p []prompt.Suggest
-		for _, v := range getUtiMap() {
+		for _, r := range util.RankApps(d.TextBeforeCursor(), list, boosts) {
+			v := list[r.Index]
 			p = append(p, prompt.Suggest{Text: v.Name, Description: "uti: " + v.Identifier})
 		}
-		return prompt.FilterHasPrefix(p, d.GetWordBeforeCursor(), true)
+		return p
 	}
 
-	t := inputWithDoubleCtrlC("> ", promptHandler)
+	t := s.input("app", promptHandler)
 	if t == "" {
-		return ""
+		return util.Uti{}, false
+	}
+	app, err := util.ResolveApp(ctx, t, apps)
+	if err != nil {
+		out.Printf("%v\n", err)
+		return util.Uti{}, false
 	}
-	fmt.Println(YouSelectPrompt + t)
-	return t
+	out.Println(YouSelectPrompt + app.Name)
+	return app, true
 }
 
-func chooseSuffix() string {
-	fmt.Println("Please input suffix.(Tab for auto complement)")
-	t := inputWithDoubleCtrlC("> ", util.SuffixCompleter)
+// chooseSuffixes asks for one or more suffixes, categories or globs and
+// returns the suffixes they expand to.
+func chooseSuffixes(s *session) []util.Suffix {
+	out.Println("Please input suffixes, a category (code, web, ...) or a glob (*script*).(Tab for auto complement)")
+	t := s.input("suffix", util.RecentSuffixCompleter(s.history.Suffixes))
 	if t == "" {
-		return ""
+		return nil
+	}
+	suffixes, err := util.ExpandSuffixes(t)
+	if err != nil {
+		out.Printf("Invalid suffix: %v\n", err)
+		return nil
+	}
+	out.Println(YouSelectPrompt + joinSuffixes(suffixes))
+	return suffixes
+}
+
+func joinSuffixes(suffixes []util.Suffix) string {
+	names := make([]string, len(suffixes))
+	for i, s := range suffixes {
+		names[i] = s.String()
 	}
-	fmt.Println(YouSelectPrompt + t)
-	return t
+	return strings.Join(names, " ")
 }
 
 func choosePreset() {
-	fmt.Println("Please input preset.(Tab for auto complement)")
-	t := inputWithDoubleCtrlC("> ", util.PresetCompleter)
+	out.Println("Please input preset.(Tab for auto complement)")
+	t, _ := inputWithDoubleCtrlC("> ", util.PresetCompleter, nil)
 	if t != "" {
-		fmt.Println(YouSelectPrompt + t)
+		out.Println(YouSelectPrompt + t)
 	}
 }
 
-func inputWithDoubleCtrlC(prefix string, completer prompt.Completer) string {
+// inputWithDoubleCtrlC reads a line, offering history with the arrow keys.
+// Ctrl+C clears the line; pressed twice in a row it ends the prompt with
+// quit set, so the caller can wind the session down.
+func inputWithDoubleCtrlC(prefix string, completer prompt.Completer, history []string) (line string, quit bool) {
 	p := prompt.New(
-		func(s string) {
-			consecutiveInterrupts = 0
-		},
+		func(s string) {},
 		completer,
 		prompt.OptionPrefix(prefix),
-		prompt.OptionAddASCIICodeBind(
-			prompt.ASCIICodeBind{
-				ASCIICode: []byte{3},
+		prompt.OptionHistory(history),
+		prompt.OptionAddKeyBind(
+			prompt.KeyBind{
+				Key: prompt.ControlC,
 				Fn: func(buf *prompt.Buffer) {
 					consecutiveInterrupts++
 					if consecutiveInterrupts >= 2 {
-						fmt.Println("\nExiting...")
-						os.Exit(0)
+						out.Println("\nExiting...")
+						quit = true
 					} else {
-						buf.DeleteBeforeCursor(len(buf.Document().TextBeforeCursor()))
-						fmt.Println("\nPress Ctrl+C again to exit")
+						out.Println("\nPress Ctrl+C again to exit")
 					}
 				},
 			},
 		),
+		prompt.OptionSetExitCheckerOnInput(func(string, bool) bool { return quit }),
 	)
 
-	return p.Input()
+	line = p.Input()
+	consecutiveInterrupts = 0
+	if quit {
+		return "", true
+	}
+	return line, false
 }
 
-func printRecommend(suf string) {
-	fmt.Printf("\n\033[1;35m%s Recommended Applications %s\033[0m\n", 
+// printRecommend prints the applications recommended for every one of
+// sufs and returns their names.
+func printRecommend(ctx context.Context, sufs []util.Suffix) []string {
+	out.Println()
+	out.Styledf(ui.Title, "%s Recommended Applications %s",
 		strings.Repeat("─", 10), strings.Repeat("─", 10))
 	
-	recommendApplications := util.LSCopyAllRoleHandlersForContentType(suf)
+	recommendApplications := util.LSCopyAllRoleHandlersForContentType(ctx, sufs[0].String())
+	for _, suf := range sufs[1:] {
+		recommendApplications = intersect(recommendApplications, util.LSCopyAllRoleHandlersForContentType(ctx, suf.String()))
+	}
 	if len(recommendApplications) > 0 {
-		fmt.Printf("\033[2;37mFound %d application(s) for %s files:\033[0m\n\n", 
-			len(recommendApplications), suf)
+		if len(sufs) == 1 {
+			out.Styledf(ui.Muted, "Found %d application(s) for %s files:",
+				len(recommendApplications), sufs[0])
+		} else {
+			out.Styledf(ui.Muted, "Found %d application(s) for all %d suffixes:",
+				len(recommendApplications), len(sufs))
+		}
+		out.Println()
 		
 		for i, app := range recommendApplications {
 			if app == "" {
 				continue
 			}
 			// Use different colors for variety
-			color := "\033[0;36m" // Cyan
+			style := ui.Accent
 			if i%2 == 1 {
-				color = "\033[0;34m" // Blue
+				style = ui.Accent2
 			}
-			fmt.Printf("  %s• %s\033[0m\n", color, app)
+			out.Styledf(style, "  • %s", app)
 		}
 	} else {
-		fmt.Println("\033[2;33m  No recommended applications found\033[0m")
+		out.Indent("  ").Styledf(ui.Pending, "No recommended applications found")
 	}
 	
-	fmt.Printf("\033[1;35m%s\033[0m\n\n", strings.Repeat("─", 46))
+	out.Styledf(ui.Title, "%s", strings.Repeat("─", 46))
+	out.Println()
+	return recommendApplications
+}
+
+// intersect returns the elements of a that are also in b, in a's order.
+func intersect(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var both []string
+	for _, s := range a {
+		if in[s] {
+			both = append(both, s)
+		}
+	}
+	return both
 }
 
 func printVersion() {
-	fmt.Printf("\033[1;36m%s (%s)\033[0m\n", Version, Repository)
+	out.Styledf(ui.Heading, "%s (%s)", Version, Repository)
 	
 	// Show cache status
 	if _, ok := util.LoadUtiCache(); ok {
-		fmt.Printf("\033[2;32m✓ Cache ready\033[0m\n")
+		out.Successf("Cache ready")
 	} else {
-		fmt.Printf("\033[2;33m○ Will build cache on first use\033[0m\n")
+		out.Pendingf("Will build cache on first use")
 	}
-	fmt.Println()
-}
-
-func showHelp() {
-	fmt.Println("Usage: dutis [command]")
-	fmt.Println()
-	fmt.Println("Commands:")
-	fmt.Println("  (none)              Interactive mode to set file associations")
-	fmt.Println("  apply               Apply all configured associations from config")
-	fmt.Println("  list                List all configured associations")
-	fmt.Println("  remove <suffix>     Remove association for a suffix")
-	fmt.Println("  version, -v         Show version information")
-	fmt.Println("  --refresh-cache     Refresh the application cache")
-	fmt.Println("  help, --help, -h    Show this help message")
-	fmt.Println()
-	fmt.Println("Config file: ~/.dutis/config.yaml")
+	out.Println()
 }
 
-func handleCommands() bool {
-	if len(os.Args) < 2 {
-		return false
+// installedBundleIDs returns the bundle IDs of scanned applications, or nil
+// when not running on macOS and there is nothing to check against.
+func installedBundleIDs(ctx context.Context) (map[string]bool, error) {
+	if runtime.GOOS != "darwin" {
+		return nil, nil
 	}
+	apps, err := getUtiMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]bool)
+	for _, v := range apps {
+		installed[v.Identifier] = true
+	}
+	return installed, nil
+}
 
-	command := os.Args[1]
-
-	switch command {
-	case "--refresh-cache":
-		fmt.Println("Refreshing application cache...")
-		utiMap := util.ListApplicationsUti()
-		if err := util.SaveUtiCache(utiMap); err != nil {
-			fmt.Printf("Error saving cache: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("✓ Cache refreshed with %d applications\n", len(utiMap))
-		return true
-
-	case "apply":
-		config, err := util.LoadConfig()
-		if err != nil {
-			fmt.Printf("Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-		if err := config.ApplyAll(); err != nil {
-			os.Exit(1)
-		}
-		return true
-
-	case "list":
-		config, err := util.LoadConfig()
-		if err != nil {
-			fmt.Printf("Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-		associations := config.ListAssociations()
-		if len(associations) == 0 {
-			fmt.Println("No associations configured yet.")
-			fmt.Println("Run 'dutis' to set file associations interactively.")
-		} else {
-			fmt.Printf("Configured associations (%d):\n\n", len(associations))
-			fmt.Printf("%-15s %-30s %s\n", "SUFFIX", "APPLICATION", "BUNDLE ID")
-			fmt.Println(strings.Repeat("-", 80))
-			for _, assoc := range associations {
-				fmt.Printf("%-15s %-30s %s\n", assoc.Suffix, assoc.Application, assoc.BundleID)
-			}
-		}
-		return true
-
-	case "remove":
-		if len(os.Args) < 3 {
-			fmt.Println("Error: suffix required")
-			fmt.Println("Usage: dutis remove <suffix>")
-			os.Exit(1)
-		}
-		suffix := os.Args[2]
-		config, err := util.LoadConfig()
-		if err != nil {
-			fmt.Printf("Error loading config: %v\n", err)
-			os.Exit(1)
-		}
-		if _, ok := config.GetAssociation(suffix); !ok {
-			fmt.Printf("No association found for suffix: %s\n", suffix)
-			os.Exit(1)
-		}
-		if err := config.RemoveAssociation(suffix); err != nil {
-			fmt.Printf("Error removing association: %v\n", err)
-			os.Exit(1)
+func printDiff(before, after string) {
+	for _, line := range util.LineDiff(before, after) {
+		switch line.Op {
+		case util.DiffDelete:
+			out.Styledf(ui.Removed, "- %s", line.Text)
+		case util.DiffInsert:
+			out.Styledf(ui.Added, "+ %s", line.Text)
+		default:
+			out.Printf("  %s\n", line.Text)
 		}
-		fmt.Printf("✓ Removed association for: %s\n", suffix)
-		return true
-
-	case "version", "--version", "-v":
-		fmt.Printf("%s\n", Version)
-		fmt.Printf("Repository: %s\n", Repository)
-		return true
-
-	case "help", "--help", "-h":
-		showHelp()
-		return true
 	}
+}
 
-	return false
+// printDegradations prints one notice for all features that fell back to
+// a reduced form during the command.
+func printDegradations() {
+	degraded := util.Degradations()
+	if len(degraded) == 0 || globals.quiet {
+		return
+	}
+	errOut.Println()
+	errOut.Pendingf("Some features ran in a reduced form (run 'dutis doctor' for details):")
+	for _, d := range degraded {
+		errOut.Styledf(ui.Muted, "    %s: %s (%s)", d.Feature, d.Fallback, d.Reason)
+	}
 }
 
 func main() {
-	if handleCommands() {
-		return
+	// Ctrl+C or SIGTERM cancels the context, which kills running
+	// subprocesses; a second signal exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := newRootCmd().ExecuteContext(ctx)
+	stop()
+	printDegradations()
+	stopTimeout()
+	closeLogging()
+	switch {
+	case errors.Is(err, context.Canceled):
+		errOut.Styledf(ui.Failure, "Interrupted")
+		os.Exit(130)
+	case err != nil:
+		errOut.Styledf(ui.Failure, "Error: %v", err)
+		os.Exit(1)
 	}
+}
 
+// runInteractive is the go-prompt flow used when dutis runs without a command.
+func runInteractive(ctx context.Context) error {
 	printVersion()
-	util.InstallDeps()
+	if _, err := exec.LookPath("duti"); err != nil {
+		out.Failuref("duti is not installed; run 'dutis doctor' to see how to fix it")
+		out.Println()
+	}
 	//fmt.Println("Please select mode by number.(Tab for auto complement)\n(1). change default application by suffix\n(2).
 	// change default application by preset")
 	//t := prompt.Input("> ", mainCompleter)
 	//fmt.Println("You selected " + t)
 	t := "1"
-	var suf string
-	switch t {
-	case "1":
-		suf = chooseSuffix()
-	case "2":
+	if t == "2" {
 		choosePreset()
+		return nil
 	}
 
-	if suf == "" {
-		return
+	config, err := util.LoadConfig()
+	if err != nil {
+		out.Printf("Warning: Could not load config: %v\n", err)
+		config = nil
 	}
-	printRecommend(suf)
+	s := newSession(config)
+	defer s.close(ctx)
 
-	utiName := chooseUti()
-	if utiName == "" {
+	var apps map[string]util.Uti
+	var pending []pendingChange
+	for action := "set"; ctx.Err() == nil; action = chooseAction(s, len(pending)) {
+		switch action {
+		case "set":
+			sufs := chooseSuffixes(s)
+			if len(sufs) == 0 {
+				continue
+			}
+			recommended := printRecommend(ctx, sufs)
+			if apps == nil {
+				if apps, err = getUtiMap(ctx); err != nil {
+					return err
+				}
+			}
+			utiItem, ok := chooseUti(ctx, s, apps, s.boosts(recommended))
+			if !ok {
+				continue
+			}
+			pending = append(pending, pendingChange{sufs, utiItem})
+			out.Pendingf("%s → %s pending; apply to make the change", joinSuffixes(sufs), utiItem.Name)
+		case "review":
+			printPending(pending)
+		case "apply":
+			for _, p := range pending {
+				results := s.apply(ctx, p.Suffixes, p.App)
+				printSetResults(results)
+				printBatchSummary(results, p.App)
+			}
+			pending = nil
+		case "quit":
+			if len(pending) > 0 {
+				out.Pendingf("Discarded %d pending change(s)", len(pending))
+			}
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// pendingChange is an app chosen for suffixes in interactive mode, not
+// applied yet.
+type pendingChange struct {
+	Suffixes []util.Suffix
+	App      util.Uti
+}
+
+// sessionActions are the choices after each step of interactive mode.
+var sessionActions = []prompt.Suggest{
+	{Text: "set", Description: "set another application"},
+	{Text: "review", Description: "show the pending changes"},
+	{Text: "apply", Description: "apply the pending changes"},
+	{Text: "quit", Description: "quit, discarding pending changes"},
+}
+
+// chooseAction asks what to do next until one of sessionActions, or its
+// first letter, is entered. It returns "quit" once s was interrupted.
+func chooseAction(s *session, pending int) string {
+	for !s.quit {
+		out.Println()
+		out.Printf("%d change(s) pending. Set another, review, apply or quit?\n", pending)
+		line, quit := inputWithDoubleCtrlC("> ", func(d prompt.Document) []prompt.Suggest {
+			return util.FuzzyFilter(sessionActions, d.GetWordBeforeCursor(), nil)
+		}, nil)
+		s.quit = quit
+		t := strings.ToLower(strings.TrimSpace(line))
+		for _, a := range sessionActions {
+			if t != "" && strings.HasPrefix(a.Text, t) {
+				return a.Text
+			}
+		}
+	}
+	return "quit"
+}
+
+func printPending(pending []pendingChange) {
+	if len(pending) == 0 {
+		out.Styledf(ui.Muted, "No pending changes")
 		return
 	}
-	if utiItem, ok := getUtiMap()[utiName]; ok {
-		if err := util.SetDefaultApplication(utiItem.Identifier, suf); err != nil {
-			fmt.Printf("Error setting default application: %v\n", err)
-			return
+	for _, p := range pending {
+		out.Printf("  %s → %s (%s)\n", joinSuffixes(p.Suffixes), p.App.Name, p.App.Identifier)
+	}
+}
+
+// printBatchSummary sums up an interactive run: how many suffixes were
+// set and whether they were saved.
+func printBatchSummary(results []setResult, app util.Uti) {
+	set, saved := 0, 0
+	for _, res := range results {
+		if res.Status == "set" {
+			set++
 		}
-		
-		// Save to config
-		config, err := util.LoadConfig()
-		if err != nil {
-			fmt.Printf("Warning: Could not load config: %v\n", err)
-		} else {
-			if err := config.AddAssociation(suf, utiItem.Name, utiItem.Identifier); err != nil {
-				fmt.Printf("Warning: Could not save to config: %v\n", err)
-			} else {
-				fmt.Printf("\033[2;32m✓ Saved to config (~/.dutis/config.yaml)\033[0m\n")
-			}
+		if res.Saved {
+			saved++
 		}
-	} else {
-		fmt.Printf("uti %s not found\n", utiName)
+	}
+	out.Println()
+	switch {
+	case set == len(results):
+		out.Successf("Set default application for %d suffix(es) to %s", set, app.Identifier)
+	case set == 0:
+		out.Failuref("Could not set %s for any suffix", app.Identifier)
+	default:
+		out.Pendingf("Set default application for %d of %d suffixes to %s", set, len(results), app.Identifier)
+	}
+	if saved > 0 {
+		out.Successf("Saved to config (%s)", util.ConfigPath())
 	}
 }
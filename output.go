@@ -0,0 +1,582 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobiashochguertel/dutis/util"
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormat is the value of --output. table is the human-readable
+// default; the other formats emit the documented result structures below.
+type outputFormat string
+
+const (
+	formatTable outputFormat = "table"
+	formatJSON  outputFormat = "json"
+	formatYAML  outputFormat = "yaml"
+	formatTSV   outputFormat = "tsv"
+)
+
+var outputFormats = []outputFormat{formatTable, formatJSON, formatYAML, formatTSV}
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	for _, f := range outputFormats {
+		if outputFormat(s) == f {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q (want table, json, yaml or tsv)", s)
+}
+
+// tabular is implemented by every result so it can be printed as TSV: one
+// header line followed by one line per row.
+type tabular interface {
+	header() []string
+	rows() [][]string
+}
+
+// emit prints v in the selected output format. printTable renders the
+// human-readable form.
+func emit(v tabular, printTable func()) error {
+	if globals.output == formatTable {
+		printTable()
+		return nil
+	}
+	return writeOutput(os.Stdout, globals.output, v)
+}
+
+func writeOutput(w io.Writer, format outputFormat, v tabular) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case formatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	case formatTSV:
+		return writeTSV(w, append([][]string{v.header()}, v.rows()...))
+	}
+	return fmt.Errorf("output format %q is not machine-readable", format)
+}
+
+func writeTSV(w io.Writer, lines [][]string) error {
+	for _, line := range lines {
+		for i := range line {
+			line[i] = tsvEscaper.Replace(line[i])
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(line, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stream writes results one at a time as they happen, for commands that
+// run until stopped: a JSON object per line, a YAML document each, or TSV
+// rows under a single header.
+type stream struct {
+	w      io.Writer
+	format outputFormat
+	yaml   *yaml.Encoder
+	header bool
+}
+
+func newStream(w io.Writer, format outputFormat) *stream {
+	return &stream{w: w, format: format}
+}
+
+func (s *stream) write(v tabular) error {
+	switch s.format {
+	case formatJSON:
+		return json.NewEncoder(s.w).Encode(v)
+	case formatYAML:
+		if s.yaml == nil {
+			s.yaml = yaml.NewEncoder(s.w)
+			s.yaml.SetIndent(2)
+		}
+		return s.yaml.Encode(v)
+	case formatTSV:
+		rows := v.rows()
+		if !s.header {
+			rows = append([][]string{v.header()}, rows...)
+			s.header = true
+		}
+		return writeTSV(s.w, rows)
+	}
+	return fmt.Errorf("output format %q is not machine-readable", s.format)
+}
+
+func (s *stream) close() error {
+	if s.yaml != nil {
+		return s.yaml.Close()
+	}
+	return nil
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// associationList is the result of `dutis list`.
+type associationList struct {
+	Associations []util.Association `json:"associations" yaml:"associations"`
+}
+
+func (l associationList) header() []string {
+	return []string{"suffix", "application", "bundle_id", "role", "set_at"}
+}
+
+func (l associationList) rows() [][]string {
+	var rows [][]string
+	for _, a := range l.Associations {
+		rows = append(rows, []string{a.Suffix.String(), a.Application, a.BundleID, string(a.EffectiveRole()), formatTime(a.SetAt)})
+	}
+	return rows
+}
+
+// applyReport is the result of `dutis apply`.
+type applyReport struct {
+	Results   []util.ApplyResult `json:"results" yaml:"results"`
+	Succeeded int                `json:"succeeded" yaml:"succeeded"`
+	Failed    int                `json:"failed" yaml:"failed"`
+}
+
+func newApplyReport(results []util.ApplyResult) applyReport {
+	report := applyReport{Results: results}
+	if report.Results == nil {
+		report.Results = []util.ApplyResult{}
+	}
+	for _, r := range results {
+		if r.Status == util.ApplyStatusApplied {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+func (r applyReport) header() []string {
+	return []string{"suffix", "application", "bundle_id", "role", "status", "error"}
+}
+
+func (r applyReport) rows() [][]string {
+	var rows [][]string
+	for _, res := range r.Results {
+		rows = append(rows, []string{res.Suffix.String(), res.Application, res.BundleID, string(res.Role), res.Status, res.Error})
+	}
+	return rows
+}
+
+// removeReport is the result of `dutis remove`: whether the config entry
+// was removed and the handler restored, if any, with where it came from.
+type removeReport struct {
+	Removed  util.Suffix   `json:"removed" yaml:"removed"`
+	Config   bool          `json:"config" yaml:"config"`
+	Restored *util.Handler `json:"restored,omitempty" yaml:"restored,omitempty"`
+	Source   string        `json:"source,omitempty" yaml:"source,omitempty"` // "journal" or "fallback"
+}
+
+func (r removeReport) header() []string {
+	return []string{"removed", "config", "restored", "source"}
+}
+
+func (r removeReport) rows() [][]string {
+	var restored string
+	if r.Restored != nil {
+		restored = r.Restored.BundleID
+	}
+	return [][]string{{r.Removed.String(), strconv.FormatBool(r.Config), restored, r.Source}}
+}
+
+// setResult is the outcome for one suffix of `dutis set`.
+type setResult struct {
+	Suffix      util.Suffix `json:"suffix" yaml:"suffix"`
+	Application string      `json:"application" yaml:"application"`
+	BundleID    string      `json:"bundle_id" yaml:"bundle_id"`
+	Role        util.Role   `json:"role" yaml:"role"`
+	Status      string      `json:"status" yaml:"status"` // "set", "failed" or "dry-run"
+	Saved       bool        `json:"saved" yaml:"saved"`
+	Error       string      `json:"error,omitempty" yaml:"error,omitempty"`
+
+	// change is the journal entry of a suffix that was set.
+	change *util.JournalEntry
+}
+
+// setReport is the result of `dutis set`.
+type setReport struct {
+	Results []setResult `json:"results" yaml:"results"`
+}
+
+func (r setReport) header() []string {
+	return []string{"suffix", "application", "bundle_id", "role", "status", "saved", "error"}
+}
+
+func (r setReport) rows() [][]string {
+	var rows [][]string
+	for _, res := range r.Results {
+		rows = append(rows, []string{res.Suffix.String(), res.Application, res.BundleID, string(res.Role),
+			res.Status, strconv.FormatBool(res.Saved), res.Error})
+	}
+	return rows
+}
+
+func (r getResult) header() []string {
+	return []string{"kind", "role", "bundle_id", "name", "path"}
+}
+
+// rows lists the defaults per role, then the candidates.
+func (r getResult) rows() [][]string {
+	rows := [][]string{{"content_type", "", r.ContentType, "", ""}}
+	for _, role := range util.DefaultRoles {
+		if h, ok := r.Defaults[role]; ok {
+			rows = append(rows, []string{"default", string(role), h.BundleID, h.Name, h.Path})
+		}
+	}
+	for _, h := range r.Candidates {
+		rows = append(rows, []string{"candidate", "", h.BundleID, h.Name, h.Path})
+	}
+	if a := r.Config.Association; a != nil {
+		kind := "config_drifted"
+		if r.Config.Matches {
+			kind = "config_matches"
+		}
+		rows = append(rows, []string{kind, string(a.EffectiveRole()), a.BundleID, a.Application, ""})
+	}
+	return rows
+}
+
+// validateReport is the result of `dutis config validate`.
+type validateReport struct {
+	Diagnostics []util.Diagnostic `json:"diagnostics" yaml:"diagnostics"`
+	Errors      int               `json:"errors" yaml:"errors"`
+	Warnings    int               `json:"warnings" yaml:"warnings"`
+}
+
+func newValidateReport(diags []util.Diagnostic) validateReport {
+	report := validateReport{Diagnostics: diags}
+	if report.Diagnostics == nil {
+		report.Diagnostics = []util.Diagnostic{}
+	}
+	for _, d := range diags {
+		if d.Severity == util.SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	return report
+}
+
+func (r validateReport) header() []string {
+	return []string{"path", "line", "column", "severity", "message", "fix"}
+}
+
+func (r validateReport) rows() [][]string {
+	var rows [][]string
+	for _, d := range r.Diagnostics {
+		rows = append(rows, []string{d.Path, strconv.Itoa(d.Line), strconv.Itoa(d.Column), d.Severity.String(), d.Message, d.Fix})
+	}
+	return rows
+}
+
+// migrateReport is the result of `dutis config migrate`.
+type migrateReport struct {
+	Path   string   `json:"path" yaml:"path"`
+	From   string   `json:"from" yaml:"from"`
+	To     string   `json:"to" yaml:"to"`
+	Steps  []string `json:"steps" yaml:"steps"`
+	DryRun bool     `json:"dry_run" yaml:"dry_run"`
+	Backup string   `json:"backup,omitempty" yaml:"backup,omitempty"`
+}
+
+func (r migrateReport) header() []string {
+	return []string{"from", "to", "step"}
+}
+
+func (r migrateReport) rows() [][]string {
+	var rows [][]string
+	for _, step := range r.Steps {
+		rows = append(rows, []string{r.From, r.To, step})
+	}
+	return rows
+}
+
+// backupList is the result of `dutis config restore --list`.
+type backupList struct {
+	Backups []util.ConfigBackup `json:"backups" yaml:"backups"`
+}
+
+func (l backupList) header() []string { return []string{"index", "path", "mod_time"} }
+
+func (l backupList) rows() [][]string {
+	var rows [][]string
+	for _, b := range l.Backups {
+		rows = append(rows, []string{strconv.Itoa(b.Index), b.Path, formatTime(b.ModTime)})
+	}
+	return rows
+}
+
+// restoreReport is the result of `dutis config restore`.
+type restoreReport struct {
+	RestoredFrom string `json:"restored_from" yaml:"restored_from"`
+}
+
+func (r restoreReport) header() []string { return []string{"restored_from"} }
+func (r restoreReport) rows() [][]string { return [][]string{{r.RestoredFrom}} }
+
+// historyReport is the result of `dutis history`, newest first.
+type historyReport struct {
+	Entries []historyEntry `json:"entries" yaml:"entries"`
+}
+
+// historyEntry is a journal entry and the ID of the undo that reverted it.
+type historyEntry struct {
+	util.JournalEntry `yaml:",inline"`
+	UndoneBy          int `json:"undone_by,omitempty" yaml:"undone_by,omitempty"`
+}
+
+func (r historyReport) header() []string {
+	return []string{"id", "time", "command", "suffix", "kind", "role", "previous", "new", "config", "previous_config", "new_config", "undoes", "undone_by"}
+}
+
+func (r historyReport) rows() [][]string {
+	handler := func(h *util.Handler) string {
+		if h == nil {
+			return ""
+		}
+		return h.BundleID
+	}
+	assoc := func(a *util.Association) string {
+		if a == nil {
+			return ""
+		}
+		return a.BundleID
+	}
+	var rows [][]string
+	for _, e := range r.Entries {
+		rows = append(rows, []string{strconv.Itoa(e.ID), formatTime(e.Time), e.Command, e.Suffix.String(), string(e.Kind), string(e.Role),
+			handler(e.Previous), handler(e.New), strconv.FormatBool(e.Config), assoc(e.PreviousConfig), assoc(e.NewConfig),
+			strconv.Itoa(e.Undoes), strconv.Itoa(e.UndoneBy)})
+	}
+	return rows
+}
+
+// undoReport is the result of `dutis undo`.
+type undoReport struct {
+	Results []util.UndoResult `json:"results" yaml:"results"`
+}
+
+func (r undoReport) header() []string {
+	return []string{"id", "suffix", "kind", "role", "restored", "config", "status", "error"}
+}
+
+func (r undoReport) rows() [][]string {
+	var rows [][]string
+	for _, res := range r.Results {
+		restored := ""
+		if res.Restored != nil {
+			restored = res.Restored.BundleID
+		}
+		rows = append(rows, []string{strconv.Itoa(res.ID), res.Suffix.String(), string(res.Kind), string(res.Role), restored,
+			strconv.FormatBool(res.Config), res.Status, res.Error})
+	}
+	return rows
+}
+
+// syncReport is the plan of `dutis sync`, with the status of each change
+// once applied.
+type syncReport struct {
+	Items  []util.SyncItem `json:"items" yaml:"items"`
+	DryRun bool            `json:"dry_run" yaml:"dry_run"`
+}
+
+func (r syncReport) header() []string {
+	return []string{"kind", "name", "role", "action", "current", "want", "reason", "status", "error"}
+}
+
+func (r syncReport) rows() [][]string {
+	handler := func(h *util.Handler) string {
+		if h == nil {
+			return ""
+		}
+		return h.BundleID
+	}
+	var rows [][]string
+	for _, item := range r.Items {
+		rows = append(rows, []string{string(item.Kind), item.Name, string(item.Role), item.Action,
+			handler(item.Current), handler(item.Want), item.Reason, item.Status, item.Error})
+	}
+	return rows
+}
+
+// watchCorrection is one correction of `dutis watch`, streamed as it
+// happens.
+type watchCorrection util.Correction
+
+func (c watchCorrection) header() []string {
+	return []string{"time", "kind", "name", "role", "from", "to", "trigger", "status", "error"}
+}
+
+func (c watchCorrection) rows() [][]string {
+	handler := func(h *util.Handler) string {
+		if h == nil {
+			return ""
+		}
+		return h.BundleID
+	}
+	return [][]string{{formatTime(c.Time), string(c.Kind), c.Name, string(c.Role),
+		handler(c.From), handler(c.To), c.Trigger, c.Status, c.Error}}
+}
+
+// agentInstallReport is the result of `dutis agent install`.
+type agentInstallReport struct {
+	Mode   string `json:"mode" yaml:"mode"`
+	Label  string `json:"label" yaml:"label"`
+	Path   string `json:"path" yaml:"path"`
+	Loaded bool   `json:"loaded" yaml:"loaded"`
+	Log    string `json:"log" yaml:"log"`
+}
+
+func (r agentInstallReport) header() []string {
+	return []string{"mode", "label", "path", "loaded", "log"}
+}
+
+func (r agentInstallReport) rows() [][]string {
+	return [][]string{{r.Mode, r.Label, r.Path, strconv.FormatBool(r.Loaded), r.Log}}
+}
+
+// agentUninstallReport is the result of `dutis agent uninstall`.
+type agentUninstallReport struct {
+	Removed []string `json:"removed" yaml:"removed"`
+}
+
+func (r agentUninstallReport) header() []string { return []string{"removed"} }
+
+func (r agentUninstallReport) rows() [][]string {
+	var rows [][]string
+	for _, mode := range r.Removed {
+		rows = append(rows, []string{mode})
+	}
+	return rows
+}
+
+// agentStatusReport is the result of `dutis agent status`.
+type agentStatusReport struct {
+	Agents []util.AgentStatus `json:"agents" yaml:"agents"`
+}
+
+func (r agentStatusReport) header() []string {
+	return []string{"mode", "label", "path", "installed", "loaded", "state", "log", "error"}
+}
+
+func (r agentStatusReport) rows() [][]string {
+	var rows [][]string
+	for _, a := range r.Agents {
+		rows = append(rows, []string{a.Mode, a.Label, a.Path, strconv.FormatBool(a.Installed),
+			strconv.FormatBool(a.Loaded), a.State, a.Log, a.Error})
+	}
+	return rows
+}
+
+// cacheReport is the result of `dutis cache status`.
+type cacheReport struct {
+	util.CacheInfo `yaml:",inline"`
+}
+
+func (r cacheReport) header() []string {
+	return []string{"path", "ready", "applications", "updated_at"}
+}
+
+func (r cacheReport) rows() [][]string {
+	return [][]string{{r.Path, strconv.FormatBool(r.Ready), strconv.Itoa(r.Applications), formatTime(r.UpdatedAt)}}
+}
+
+// versionInfo is the result of `dutis version`.
+type versionInfo struct {
+	Version    string `json:"version" yaml:"version"`
+	Repository string `json:"repository" yaml:"repository"`
+	Commit     string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	BuildTime  string `json:"build_time,omitempty" yaml:"build_time,omitempty"`
+	GoVersion  string `json:"go_version" yaml:"go_version"`
+	Platform   string `json:"platform" yaml:"platform"`
+}
+
+func currentVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:    Version,
+		Repository: Repository,
+		GoVersion:  runtime.Version(),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+	return info
+}
+
+func (v versionInfo) header() []string { return []string{"key", "value"} }
+
+func (v versionInfo) rows() [][]string {
+	return [][]string{
+		{"version", v.Version},
+		{"repository", v.Repository},
+		{"commit", v.Commit},
+		{"build_time", v.BuildTime},
+		{"go_version", v.GoVersion},
+		{"platform", v.Platform},
+	}
+}
+
+// doctorReport is the result of `dutis doctor`.
+type doctorReport struct {
+	Checks []util.Check `json:"checks" yaml:"checks"`
+}
+
+func (r doctorReport) errors() int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Status == util.CheckError {
+			n++
+		}
+	}
+	return n
+}
+
+func (r doctorReport) header() []string {
+	return []string{"name", "status", "version", "path", "detail", "hint", "fix"}
+}
+
+func (r doctorReport) rows() [][]string {
+	var rows [][]string
+	for _, c := range r.Checks {
+		rows = append(rows, []string{c.Name, string(c.Status), c.Version, c.Path, c.Detail, c.Hint, c.FixAction})
+	}
+	return rows
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var sampleTime = time.Date(2025, 3, 14, 9, 26, 53, 0, time.UTC)
+
+// goldenResults are fixed samples of every documented result structure.
+var goldenResults = map[string]tabular{
+	"list": associationList{[]util.Association{
+		{Suffix: ".md", Application: "Visual Studio Code", BundleID: "com.microsoft.VSCode", SetAt: sampleTime},
+		{Suffix: ".txt", Application: "TextEdit", BundleID: "com.apple.TextEdit", SetAt: sampleTime, Role: util.RoleEditor},
+	}},
+	"list_empty": associationList{[]util.Association{}},
+	"apply": newApplyReport([]util.ApplyResult{
+		{Suffix: ".md", Application: "Visual Studio Code", BundleID: "com.microsoft.VSCode", Role: util.RoleAll, Status: util.ApplyStatusApplied},
+		{Suffix: ".txt", Application: "Gone", BundleID: "com.example.gone", Role: util.RoleEditor, Status: util.ApplyStatusFailed,
+			Error: "no application\twith bundle ID"},
+	}),
+	"remove":         removeReport{Removed: ".md", Config: true},
+	"remove_restore": removeReport{Removed: ".md", Config: true, Restored: &util.Handler{BundleID: "abnerworks.Typora", Name: "Typora.app"}, Source: "journal"},
+	"set": setReport{[]setResult{
+		{Suffix: ".go", Application: "Zed", BundleID: "dev.zed.Zed", Role: util.RoleAll, Status: "set", Saved: true},
+	}},
+	"sync": syncReport{Items: []util.SyncItem{
+		{Target: util.Target{Kind: util.TargetSuffix, Name: ".go"}, Role: util.RoleEditor, Action: util.SyncFix, Reason: "drifted",
+			Current: &util.Handler{BundleID: "com.microsoft.VSCode"}, Want: &util.Handler{BundleID: "dev.zed.Zed", Name: "Zed.app"}, Status: util.SyncStatusDone},
+		{Target: util.Target{Kind: util.TargetScheme, Name: "mailto"}, Role: util.RoleAll, Action: util.SyncOK,
+			Current: &util.Handler{BundleID: "com.apple.mail"}, Want: &util.Handler{BundleID: "com.apple.mail", Name: "Mail.app"}},
+		{Target: util.Target{Kind: util.TargetSuffix, Name: ".py"}, Role: util.RoleAll, Action: util.SyncSkip,
+			Reason: "managed entry removed from the config without a fallback"},
+	}},
+	"agent_install": agentInstallReport{Mode: util.AgentWatch, Label: "com.github.tobiashochguertel.dutis.watch",
+		Path: "/Users/me/Library/LaunchAgents/com.github.tobiashochguertel.dutis.watch.plist", Loaded: true, Log: "/Users/me/.dutis/logs/watch.log"},
+	"agent_status": agentStatusReport{[]util.AgentStatus{
+		{Mode: util.AgentWatch, Label: "com.github.tobiashochguertel.dutis.watch", Path: "/Users/me/Library/LaunchAgents/com.github.tobiashochguertel.dutis.watch.plist",
+			Installed: true, Loaded: true, State: "running", Log: "/Users/me/.dutis/logs/watch.log"},
+		{Mode: util.AgentApply, Label: "com.github.tobiashochguertel.dutis.apply", Path: "/Users/me/Library/LaunchAgents/com.github.tobiashochguertel.dutis.apply.plist"},
+	}},
+	"cache": cacheReport{util.CacheInfo{Path: "/home/user/.config/dutis/uti_cache.json", Ready: true, Applications: 42, UpdatedAt: sampleTime}},
+	"version": versionInfo{Version: "v1.2.3", Repository: "https://example.com/dutis", Commit: "abc123",
+		BuildTime: "2025-03-14T09:26:53Z", GoVersion: "go1.24.0", Platform: "darwin/arm64"},
+	"get": getResult{Query: "./README.md", File: "./README.md", Suffix: ".md",
+		Handlers: util.Handlers{ContentType: "net.daringfireball.markdown", Source: util.HandlerSourceLaunchServices,
+			Defaults: map[util.Role]util.Handler{
+				util.RoleAll:    {BundleID: "dev.zed.Zed", Name: "Zed.app", Path: "/Applications/Zed.app"},
+				util.RoleEditor: {BundleID: "com.microsoft.VSCode", Name: "Visual Studio Code.app", Path: "/Applications/Visual Studio Code.app"},
+			},
+			Candidates: []util.Handler{
+				{BundleID: "dev.zed.Zed", Name: "Zed.app", Path: "/Applications/Zed.app"},
+				{BundleID: "com.apple.TextEdit", Name: "TextEdit.app", Path: "/System/Applications/TextEdit.app"},
+			}},
+		Config: configStatus{Configured: true, Matches: true,
+			Association: &util.Association{Suffix: ".md", Application: "Zed.app", BundleID: "dev.zed.Zed", SetAt: sampleTime}}},
+	"get_fallback": getResult{Query: ".rs", Suffix: ".rs",
+		Handlers: util.Handlers{ContentType: "dyn.ah62d4rv4ge81e7dwqz2g", Source: util.HandlerSourceInfoPlist,
+			Defaults:   map[util.Role]util.Handler{},
+			Candidates: []util.Handler{{BundleID: "dev.zed.Zed", Name: "Zed.app", Path: "/Applications/Zed.app"}}}},
+	"doctor": doctorReport{[]util.Check{
+		{Name: "duti", Status: util.CheckOK, Version: "1.5.5", Path: "/opt/homebrew/bin/duti"},
+		{Name: "swift", Status: util.CheckWarning, Detail: "not found", Hint: "install the Xcode command line tools",
+			FixAction: "xcode-select --install"},
+		{Name: "config", Status: util.CheckError, Path: "/Users/me/.dutis/config.yaml", Detail: "yaml: line 3: did not find expected key",
+			Hint: "run dutis config validate"},
+	}},
+	"validate": newValidateReport([]util.Diagnostic{
+		{Path: "config.yaml", Line: 4, Column: 5, Severity: util.SeverityError, Message: "bundle_id is empty", Fix: "set a bundle ID"},
+	}),
+	"history": historyReport{[]historyEntry{
+		{util.JournalEntry{ID: 2, Time: sampleTime, Command: "dutis undo", Suffix: ".md", Role: util.RoleAll,
+			Previous: &util.Handler{BundleID: "dev.zed.Zed"}, New: &util.Handler{BundleID: "abnerworks.Typora", Name: "Typora.app"}, Undoes: 1}, 0},
+		{util.JournalEntry{ID: 1, Time: sampleTime, Command: "dutis set", Suffix: ".md", Role: util.RoleAll,
+			Previous: &util.Handler{BundleID: "abnerworks.Typora", Name: "Typora.app"}, New: &util.Handler{BundleID: "dev.zed.Zed"},
+			Config: true, NewConfig: &util.Association{Suffix: ".md", Application: "Zed.app", BundleID: "dev.zed.Zed", SetAt: sampleTime}}, 2},
+	}},
+	"undo": undoReport{[]util.UndoResult{
+		{ID: 1, Suffix: ".md", Role: util.RoleAll, Restored: &util.Handler{BundleID: "abnerworks.Typora", Name: "Typora.app"}, Config: true, Status: util.UndoStatusUndone},
+		{ID: 3, Suffix: ".go", Role: util.RoleAll, Status: util.UndoStatusFailed, Error: "the previous handler is unknown"},
+	}},
+	"restore_list": backupList{[]util.ConfigBackup{{Index: 1, Path: "/home/user/.config/dutis/config.yaml.1", ModTime: sampleTime}}},
+}
+
+// goldenStreams are fixed samples of the results streamed one at a time.
+var goldenStreams = map[string][]tabular{
+	"watch": {
+		watchCorrection{Time: sampleTime, Target: util.Target{Kind: util.TargetSuffix, Name: ".md"}, Role: util.RoleAll,
+			From: &util.Handler{BundleID: "com.microsoft.VSCode"}, To: &util.Handler{BundleID: "dev.zed.Zed", Name: "Zed.app"},
+			Trigger: "change", Status: util.CorrectionDone},
+		watchCorrection{Time: sampleTime, Target: util.Target{Kind: util.TargetScheme, Name: "mailto"}, Role: util.RoleAll,
+			From: &util.Handler{BundleID: "com.google.Chrome"}, To: &util.Handler{BundleID: "com.apple.mail"},
+			Trigger: "interval", Status: util.CorrectionRateLimited},
+	},
+}
+
+func TestOutputGolden(t *testing.T) {
+	for name, v := range goldenResults {
+		testGolden(t, name, func(w io.Writer, format outputFormat) error {
+			return writeOutput(w, format, v)
+		})
+	}
+	for name, vs := range goldenStreams {
+		testGolden(t, name, func(w io.Writer, format outputFormat) error {
+			s := newStream(w, format)
+			for _, v := range vs {
+				if err := s.write(v); err != nil {
+					return err
+				}
+			}
+			return s.close()
+		})
+	}
+}
+
+func testGolden(t *testing.T, name string, write func(w io.Writer, format outputFormat) error) {
+	t.Helper()
+	for _, format := range []outputFormat{formatJSON, formatYAML, formatTSV} {
+		t.Run(name+"."+string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := write(&buf, format); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "output", name+"."+string(format))
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("output differs from %s:\n--- got\n%s\n--- want\n%s", golden, buf.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, f := range outputFormats {
+		if got, err := parseOutputFormat(string(f)); err != nil || got != f {
+			t.Errorf("parseOutputFormat(%q) = %q, %v", f, got, err)
+		}
+	}
+	if _, err := parseOutputFormat("xml"); err == nil {
+		t.Error("parseOutputFormat(xml) succeeded")
+	}
+	if err := writeOutput(&bytes.Buffer{}, formatTable, removeReport{}); err == nil {
+		t.Error("writeOutput(table) succeeded")
+	}
+}
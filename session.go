@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+// session tracks the changes of one interactive run so they can be
+// summarized and undone on exit, and records what was used in the history.
+type session struct {
+	config  *util.Config // nil when the config could not be loaded
+	history *util.History
+	changes []util.JournalEntry // journaled changes, oldest first
+	undone  map[int]bool
+	// quit is set by a double Ctrl+C at a prompt; the session then ends
+	// at the next step, still summarizing and offering undo.
+	quit bool
+}
+
+func newSession(config *util.Config) *session {
+	history, err := util.LoadHistory()
+	if err != nil {
+		util.Log.Warn("reading history", "error", err)
+		history = &util.History{}
+	}
+	return &session{config: config, history: history}
+}
+
+// input prompts with the history of the prompt name and records the line.
+func (s *session) input(name string, completer prompt.Completer) string {
+	t, quit := inputWithDoubleCtrlC("> ", completer, s.history.Prompt(name))
+	if quit {
+		s.quit = true
+		return ""
+	}
+	s.history.AddPrompt(name, t)
+	return t
+}
+
+// boosts ranks recommended, configured and recently used apps higher.
+func (s *session) boosts(recommended []string) util.Boosts {
+	var assocs []util.Association
+	if s.config != nil {
+		assocs = s.config.ListAssociations()
+	}
+	now := time.Now()
+	boosts := util.AppBoosts(assocs, recommended, now)
+	boosts.AddRecent(s.history.Apps, now)
+	return boosts
+}
+
+// apply sets app for suffixes like `dutis set` and keeps the journal
+// entries for undo.
+func (s *session) apply(ctx context.Context, suffixes []util.Suffix, app util.Uti) []setResult {
+	batch := make([]assignment, len(suffixes))
+	for i, suffix := range suffixes {
+		batch[i] = assignment{suffix, app}
+	}
+	return s.applyBatch(ctx, batch)
+}
+
+// applyBatch sets each assignment like apply, saving all of them to the
+// config in a single write.
+func (s *session) applyBatch(ctx context.Context, batch []assignment) []setResult {
+	results := applyAssignments(ctx, s.config, batch, util.RoleAll)
+	var set []util.Suffix
+	now := time.Now()
+	for i, res := range results {
+		if res.change != nil {
+			s.changes = append(s.changes, *res.change)
+			set = append(set, res.Suffix)
+			s.history.UseApp(batch[i].App, now)
+		}
+	}
+	if len(set) > 0 {
+		s.history.UseSuffixes(set)
+	}
+	return results
+}
+
+// close prints the summary, offers to undo the session's changes and
+// saves the history.
+func (s *session) close(ctx context.Context) {
+	if err := s.history.Save(); err != nil {
+		util.Log.Warn("saving history", "error", err)
+	}
+	if len(s.changes) == 0 || ctx.Err() != nil {
+		return
+	}
+	s.printSummary()
+	s.offerUndo(ctx)
+}
+
+func (s *session) printSummary() {
+	out.Println()
+	out.Styledf(ui.Title, "Changes this session")
+	for _, c := range s.changes {
+		out.Printf("  %-10s %s → %s (%s)\n", c.Suffix, handlerName(c.Previous), c.New.Name, c.New.BundleID)
+	}
+}
+
+// offerUndo asks which changes to undo: some suffixes, all, or none.
+func (s *session) offerUndo(ctx context.Context) {
+	out.Println()
+	out.Println("Undo changes? Enter suffixes or 'all', or press enter to keep them.(Tab for auto complement)")
+	suggests := []prompt.Suggest{{Text: "all", Description: "undo every change of this session"}}
+	for _, c := range s.changes {
+		suggests = append(suggests, prompt.Suggest{Text: c.Suffix.String(), Description: "back to " + handlerName(c.Previous)})
+	}
+	t, _ := inputWithDoubleCtrlC("> ", func(d prompt.Document) []prompt.Suggest {
+		return util.FuzzyFilter(suggests, d.GetWordBeforeCursor(), nil)
+	}, nil)
+
+	var suffixes []util.Suffix
+	switch strings.TrimSpace(t) {
+	case "":
+		return
+	case "all":
+	default:
+		var err error
+		if suffixes, err = util.ExpandSuffixes(t); err != nil {
+			out.Failuref("%v", err)
+			return
+		}
+	}
+	s.undo(ctx, suffixes)
+}
+
+// undo reverts the session's changes of suffixes, or all of them when
+// suffixes is empty, newest first.
+func (s *session) undo(ctx context.Context, suffixes []util.Suffix) {
+	var entries []util.JournalEntry
+	found := make(map[util.Suffix]bool)
+	for i := len(s.changes) - 1; i >= 0; i-- {
+		c := s.changes[i]
+		if len(suffixes) > 0 && !slices.Contains(suffixes, c.Suffix) || s.undone[c.ID] {
+			continue
+		}
+		entries = append(entries, c)
+		found[c.Suffix] = true
+	}
+	for _, suffix := range suffixes {
+		if !found[suffix] {
+			out.Indent("  ").Failuref("%s: not changed in this session", suffix)
+		}
+	}
+
+	results := util.Undo(ctx, s.config, entries)
+	for _, r := range results {
+		if r.Status == util.UndoStatusUndone {
+			if s.undone == nil {
+				s.undone = make(map[int]bool)
+			}
+			s.undone[r.ID] = true
+		}
+	}
+	printUndoResults(results)
+}
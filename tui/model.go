@@ -0,0 +1,474 @@
+package tui
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+type screen int
+
+const (
+	screenSuffixes screen = iota
+	screenApps
+	screenReview
+	screenResults
+)
+
+// handlerState is the current handler of a suffix as far as it is known.
+type handlerState struct {
+	loading bool
+	handler util.Handler
+	err     error
+}
+
+// Messages delivering the results of backend calls.
+type (
+	currentMsg struct {
+		suffix  util.Suffix
+		handler util.Handler
+		err     error
+	}
+	appsMsg struct {
+		apps []util.Uti
+		err  error
+	}
+	recommendedMsg struct {
+		suffix util.Suffix
+		names  []string
+	}
+	appliedMsg struct{ results []Result }
+)
+
+type model struct {
+	ctx     context.Context
+	backend Backend
+	p       *ui.Printer
+	width   int
+	height  int
+	screen  screen
+
+	// Suffix list. current and recommended are filled in as lookups finish.
+	entries     []Entry
+	current     map[util.Suffix]*handlerState
+	recommended map[util.Suffix][]string
+	selected    map[util.Suffix]bool
+	pending     map[util.Suffix]util.Uti
+	filter      string
+	filtering   bool
+	cursor      int
+	offset      int
+
+	// Application picker for targets.
+	apps      []util.Uti
+	recent    []util.RecentApp
+	appsErr   error
+	targets   []util.Suffix
+	appFilter string
+	appCursor int
+	appOffset int
+
+	// Review and results.
+	reviewCursor int
+	applying     bool
+	results      []Result
+}
+
+func newModel(ctx context.Context, backend Backend, p *ui.Printer) model {
+	return model{
+		ctx:         ctx,
+		backend:     backend,
+		p:           p,
+		width:       80,
+		height:      24,
+		entries:     backend.Entries(),
+		recent:      backend.Recent(),
+		current:     make(map[util.Suffix]*handlerState),
+		recommended: make(map[util.Suffix][]string),
+		selected:    make(map[util.Suffix]bool),
+		pending:     make(map[util.Suffix]util.Uti),
+	}
+}
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(m.loadApps(), m.loadVisible())
+}
+
+func (m model) loadApps() tea.Cmd {
+	return func() tea.Msg {
+		apps, err := m.backend.Apps(m.ctx)
+		return appsMsg{apps, err}
+	}
+}
+
+// loadVisible looks up the current handler of every visible suffix that
+// has not been looked up yet.
+func (m model) loadVisible() tea.Cmd {
+	var cmds []tea.Cmd
+	rows := m.visibleEntries()
+	end := min(m.offset+m.listHeight(), len(rows))
+	for _, e := range rows[m.offset:end] {
+		suffix := e.Suffix
+		if _, ok := m.current[suffix]; ok {
+			continue
+		}
+		m.current[suffix] = &handlerState{loading: true}
+		cmds = append(cmds, func() tea.Msg {
+			h, err := m.backend.Current(m.ctx, suffix)
+			return currentMsg{suffix, h, err}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m model) loadRecommended(suffix util.Suffix) tea.Cmd {
+	if _, ok := m.recommended[suffix]; ok {
+		return nil
+	}
+	return func() tea.Msg {
+		return recommendedMsg{suffix, m.backend.Recommended(m.ctx, suffix)}
+	}
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.clampCursors()
+		return m, m.loadVisible()
+	case currentMsg:
+		m.current[msg.suffix] = &handlerState{handler: msg.handler, err: msg.err}
+		return m, nil
+	case appsMsg:
+		m.apps, m.appsErr = msg.apps, msg.err
+		sort.Slice(m.apps, func(i, j int) bool { return strings.ToLower(m.apps[i].Name) < strings.ToLower(m.apps[j].Name) })
+		return m, nil
+	case recommendedMsg:
+		m.recommended[msg.suffix] = msg.names
+		return m, nil
+	case appliedMsg:
+		m.applying = false
+		m.results = append(m.results, msg.results...)
+		for _, r := range msg.results {
+			delete(m.pending, r.Suffix)
+			delete(m.selected, r.Suffix)
+			if r.Err == nil {
+				// Look the handler up again the next time it is shown.
+				delete(m.current, r.Suffix)
+			}
+		}
+		m.screen = screenResults
+		return m, nil
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		switch m.screen {
+		case screenSuffixes:
+			return m.updateSuffixes(msg)
+		case screenApps:
+			return m.updateApps(msg)
+		case screenReview:
+			return m.updateReview(msg)
+		case screenResults:
+			return m.updateResults(msg)
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateSuffixes(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	rows := m.visibleEntries()
+	if m.filtering {
+		switch msg.Type {
+		case tea.KeyEnter, tea.KeyEsc:
+			m.filtering = false
+			if msg.Type == tea.KeyEsc {
+				m.filter = ""
+			}
+		case tea.KeyBackspace:
+			m.filter = dropLastRune(m.filter)
+		case tea.KeyRunes, tea.KeySpace:
+			m.filter += string(msg.Runes)
+		default:
+			return m.moveSuffixCursor(msg.String(), rows)
+		}
+		m.cursor, m.offset = 0, 0
+		return m, m.loadVisible()
+	}
+
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "/":
+		m.filtering = true
+	case "esc":
+		m.filter = ""
+		m.cursor, m.offset = 0, 0
+		return m, m.loadVisible()
+	case " ", "x":
+		if len(rows) > 0 {
+			suffix := rows[m.cursor].Suffix
+			if m.selected[suffix] {
+				delete(m.selected, suffix)
+			} else {
+				m.selected[suffix] = true
+			}
+		}
+	case "enter":
+		m.targets = m.selectedSuffixes()
+		if len(m.targets) == 0 && len(rows) > 0 {
+			m.targets = []util.Suffix{rows[m.cursor].Suffix}
+		}
+		if len(m.targets) == 0 {
+			return m, nil
+		}
+		m.screen = screenApps
+		m.appFilter, m.appCursor, m.appOffset = "", 0, 0
+		return m, m.loadRecommended(m.targets[0])
+	case "r", "tab":
+		if len(m.pending) > 0 {
+			m.screen, m.reviewCursor = screenReview, 0
+		}
+	default:
+		return m.moveSuffixCursor(msg.String(), rows)
+	}
+	return m, nil
+}
+
+func (m model) moveSuffixCursor(key string, rows []Entry) (tea.Model, tea.Cmd) {
+	m.cursor = moveCursor(key, m.cursor, len(rows), m.listHeight())
+	m.offset = scrollTo(m.cursor, m.offset, m.listHeight())
+	return m, m.loadVisible()
+}
+
+func (m model) updateApps(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	rows := m.appRows()
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.screen = screenSuffixes
+		return m, nil
+	case tea.KeyEnter:
+		if m.appCursor < len(rows) {
+			app := *rows[m.appCursor].app
+			for _, suffix := range m.targets {
+				m.pending[suffix] = app
+				delete(m.selected, suffix)
+			}
+			m.screen = screenSuffixes
+		}
+		return m, nil
+	case tea.KeyBackspace:
+		m.appFilter = dropLastRune(m.appFilter)
+		m.appCursor, m.appOffset = 0, 0
+		return m, nil
+	case tea.KeyRunes, tea.KeySpace:
+		m.appFilter += string(msg.Runes)
+		m.appCursor, m.appOffset = 0, 0
+		return m, nil
+	}
+	m.appCursor = moveCursor(msg.String(), m.appCursor, len(rows), m.listHeight())
+	m.appOffset = scrollTo(m.appCursor, m.appOffset, m.listHeight())
+	return m, nil
+}
+
+func (m model) updateReview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.applying {
+		return m, nil
+	}
+	changes := m.changes()
+	switch msg.String() {
+	case "esc", "q":
+		m.screen = screenSuffixes
+	case "x", "backspace", "delete":
+		if m.reviewCursor < len(changes) {
+			delete(m.pending, changes[m.reviewCursor].Suffix)
+			if len(m.pending) == 0 {
+				m.screen = screenSuffixes
+			}
+			m.reviewCursor = min(m.reviewCursor, max(len(m.pending)-1, 0))
+		}
+	case "enter", "a":
+		if len(changes) == 0 {
+			return m, nil
+		}
+		m.applying = true
+		return m, func() tea.Msg {
+			return appliedMsg{m.backend.Apply(m.ctx, changes)}
+		}
+	default:
+		m.reviewCursor = moveCursor(msg.String(), m.reviewCursor, len(changes), m.listHeight())
+	}
+	return m, nil
+}
+
+func (m model) updateResults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "enter":
+		return m, tea.Quit
+	case "esc":
+		m.screen = screenSuffixes
+		return m, m.loadVisible()
+	}
+	return m, nil
+}
+
+// visibleEntries returns the entries whose suffix fuzzy-matches the
+// filter, best first, followed by those whose description contains it.
+func (m model) visibleEntries() []Entry {
+	if m.filter == "" {
+		return m.entries
+	}
+	suffixes := make([]string, len(m.entries))
+	for i, e := range m.entries {
+		suffixes[i] = string(e.Suffix)
+	}
+	var rows []Entry
+	matched := make(map[int]bool)
+	for _, r := range util.FuzzyRank(m.filter, suffixes, nil) {
+		rows = append(rows, m.entries[r.Index])
+		matched[r.Index] = true
+	}
+	for i, e := range m.entries {
+		if !matched[i] && strings.Contains(strings.ToLower(e.Description), strings.ToLower(m.filter)) {
+			rows = append(rows, e)
+		}
+	}
+	return rows
+}
+
+// selectedSuffixes returns the selected suffixes in list order.
+func (m model) selectedSuffixes() []util.Suffix {
+	var list []util.Suffix
+	for _, e := range m.entries {
+		if m.selected[e.Suffix] {
+			list = append(list, e.Suffix)
+		}
+	}
+	return list
+}
+
+// changes returns the pending changes in list order.
+func (m model) changes() []Change {
+	var list []Change
+	for _, e := range m.entries {
+		if app, ok := m.pending[e.Suffix]; ok {
+			list = append(list, Change{e.Suffix, app})
+		}
+	}
+	return list
+}
+
+// appRow is a line of the picker.
+type appRow struct {
+	app         *util.Uti
+	recommended bool
+	positions   []int // runes of the name that matched the search
+}
+
+// appRows returns the applications fuzzy-matching the search, ranked with
+// boosts for configured and recently set applications. Those recommended
+// for the first target are pinned at the top.
+func (m model) appRows() []appRow {
+	recommended := m.recommended[m.firstTarget()]
+	var assocs []util.Association
+	for _, e := range m.entries {
+		if e.Configured != nil {
+			assocs = append(assocs, *e.Configured)
+		}
+	}
+	now := time.Now()
+	boosts := util.AppBoosts(assocs, recommended, now)
+	boosts.AddRecent(m.recent, now)
+	pin := util.AppBoosts(nil, recommended, now)
+
+	var pinned, rest []appRow
+	for _, r := range util.RankApps(m.appFilter, m.apps, boosts) {
+		app := &m.apps[r.Index]
+		if pin.For(*app) > 0 {
+			pinned = append(pinned, appRow{app, true, r.Positions})
+		} else {
+			rest = append(rest, appRow{app, false, r.Positions})
+		}
+	}
+	return append(pinned, rest...)
+}
+
+func (m model) firstTarget() util.Suffix {
+	if len(m.targets) == 0 {
+		return ""
+	}
+	return m.targets[0]
+}
+
+// listHeight is the number of list lines that fit between the header and
+// the footer.
+func (m model) listHeight() int {
+	return max(m.height-6, 3)
+}
+
+func (m *model) clampCursors() {
+	m.cursor = min(m.cursor, max(len(m.visibleEntries())-1, 0))
+	m.offset = scrollTo(m.cursor, m.offset, m.listHeight())
+	m.appOffset = scrollTo(m.appCursor, m.appOffset, m.listHeight())
+}
+
+// moveCursor applies a navigation key to cursor in a list of n rows.
+func moveCursor(key string, cursor, n, page int) int {
+	switch key {
+	case "up", "k", "ctrl+p":
+		cursor--
+	case "down", "j", "ctrl+n":
+		cursor++
+	case "pgup":
+		cursor -= page
+	case "pgdown":
+		cursor += page
+	case "home", "g":
+		cursor = 0
+	case "end", "G":
+		cursor = n - 1
+	}
+	return max(min(cursor, n-1), 0)
+}
+
+// scrollTo returns the offset that keeps cursor within a window of height
+// rows starting at offset.
+func scrollTo(cursor, offset, height int) int {
+	if cursor < offset {
+		return cursor
+	}
+	if cursor >= offset+height {
+		return cursor - height + 1
+	}
+	return offset
+}
+
+func dropLastRune(s string) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return s
+	}
+	return string(r[:len(r)-1])
+}
+
+// handlerLabel describes the state of a suffix's current handler.
+func (m model) handlerLabel(suffix util.Suffix) string {
+	state, ok := m.current[suffix]
+	switch {
+	case !ok || state.loading:
+		return m.p.Paint(ui.Muted, "…")
+	case state.err != nil:
+		return m.p.Paint(ui.Muted, "unknown")
+	case state.handler.BundleID == "":
+		return m.p.Paint(ui.Muted, "none")
+	case state.handler.Name != "":
+		return state.handler.Name
+	}
+	return state.handler.BundleID
+}
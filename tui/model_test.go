@@ -0,0 +1,237 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+type fakeBackend struct {
+	mu      sync.Mutex
+	lookups []util.Suffix
+	applied []Change
+}
+
+func (f *fakeBackend) Entries() []Entry {
+	return []Entry{
+		{Suffix: ".md", Configured: &util.Association{Suffix: ".md", Application: "Typora.app", BundleID: "abnerworks.Typora"}},
+		{Suffix: ".go", Description: "For golang files"},
+		{Suffix: ".rs", Description: "For rust files"},
+		{Suffix: ".txt", Description: "For text files"},
+	}
+}
+
+func (f *fakeBackend) Current(ctx context.Context, suffix util.Suffix) (util.Handler, error) {
+	f.mu.Lock()
+	f.lookups = append(f.lookups, suffix)
+	f.mu.Unlock()
+	if suffix == ".rs" {
+		return util.Handler{}, errors.New("no content type")
+	}
+	return util.Handler{BundleID: "com.apple.TextEdit", Name: "TextEdit.app"}, nil
+}
+
+func (f *fakeBackend) Apps(ctx context.Context) ([]util.Uti, error) {
+	return []util.Uti{
+		{Name: "Zed.app", Identifier: "dev.zed.Zed"},
+		{Name: "TextEdit.app", Identifier: "com.apple.TextEdit"},
+		{Name: "Visual Studio Code.app", Identifier: "com.microsoft.VSCode"},
+	}, nil
+}
+
+func (f *fakeBackend) Recommended(ctx context.Context, suffix util.Suffix) []string {
+	return []string{"Zed.app"}
+}
+
+func (f *fakeBackend) Recent() []util.RecentApp {
+	return []util.RecentApp{{Name: "TextEdit.app", BundleID: "com.apple.TextEdit", UsedAt: time.Now()}}
+}
+
+func (f *fakeBackend) Apply(ctx context.Context, changes []Change) []Result {
+	f.applied = append(f.applied, changes...)
+	var results []Result
+	for _, c := range changes {
+		r := Result{Change: c, Saved: true}
+		if c.Suffix == ".txt" {
+			r = Result{Change: c, Err: errors.New("duti failed")}
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// run feeds msg to m and then the messages of the commands it returns,
+// as the bubbletea runtime would.
+func run(t *testing.T, m model, msg tea.Msg) model {
+	t.Helper()
+	queue := []tea.Msg{msg}
+	for len(queue) > 0 {
+		msg, queue = queue[0], queue[1:]
+		next, cmd := m.Update(msg)
+		m = next.(model)
+		queue = append(queue, execute(cmd)...)
+	}
+	return m
+}
+
+func execute(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		var msgs []tea.Msg
+		for _, c := range msg {
+			msgs = append(msgs, execute(c)...)
+		}
+		return msgs
+	case tea.QuitMsg, nil:
+		return nil
+	default:
+		return []tea.Msg{msg}
+	}
+}
+
+func keys(t *testing.T, m model, keys ...string) model {
+	t.Helper()
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		case "backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace}
+		case " ":
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		m = run(t, m, msg)
+	}
+	return m
+}
+
+func newTestModel(t *testing.T) (model, *fakeBackend) {
+	t.Helper()
+	backend := &fakeBackend{}
+	m := newModel(context.Background(), backend, ui.New(nil, false, nil))
+	for _, msg := range execute(m.Init()) {
+		m = run(t, m, msg)
+	}
+	return m, backend
+}
+
+func TestSuffixList(t *testing.T) {
+	m, backend := newTestModel(t)
+	if len(backend.lookups) != 4 {
+		t.Errorf("looked up %v, want every visible suffix", backend.lookups)
+	}
+	view := m.View()
+	for _, want := range []string{".md", "TextEdit.app", "Typora.app", ".rs", "unknown"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view does not contain %q:\n%s", want, view)
+		}
+	}
+
+	m = keys(t, m, "/", "r", "s", "enter")
+	if rows := m.visibleEntries(); len(rows) != 1 || rows[0].Suffix != ".rs" {
+		t.Errorf("filter rs shows %v", rows)
+	}
+	m = keys(t, m, "esc")
+	if rows := m.visibleEntries(); len(rows) != 4 {
+		t.Errorf("after esc, %d rows shown, want 4", len(rows))
+	}
+}
+
+func TestSelectPickReviewApply(t *testing.T) {
+	m, backend := newTestModel(t)
+
+	// Select .go and .txt, then pick an app for both.
+	m = keys(t, m, "down", " ", "down", "down", " ", "enter")
+	if m.screen != screenApps || !reflect.DeepEqual(m.targets, []util.Suffix{".go", ".txt"}) {
+		t.Fatalf("screen %d targets %v, want the picker for .go and .txt", m.screen, m.targets)
+	}
+	rows := m.appRows()
+	if len(rows) != 3 || rows[0].app.Name != "Zed.app" || !rows[0].recommended {
+		t.Errorf("picker rows start with %+v, want the recommended Zed.app pinned", rows[0])
+	}
+	m = keys(t, m, "c", "o", "d", "e")
+	if rows := m.appRows(); len(rows) != 1 || rows[0].app.Name != "Visual Studio Code.app" || !reflect.DeepEqual(rows[0].positions, []int{14, 15, 16, 17}) {
+		t.Errorf("search code shows %+v", rows)
+	}
+	m = keys(t, m, "backspace", "backspace", "backspace", "backspace", "enter")
+	if m.screen != screenSuffixes || len(m.pending) != 2 || len(m.selected) != 0 {
+		t.Fatalf("after picking: screen %d, pending %v, selected %v", m.screen, m.pending, m.selected)
+	}
+	if view := m.View(); !strings.Contains(view, "→ Zed.app") || !strings.Contains(view, "2 change(s) pending") {
+		t.Errorf("suffix list does not show the pending changes:\n%s", view)
+	}
+
+	// Change .md as well, then drop it again on the review screen.
+	m = keys(t, m, "g", "enter", "enter", "r")
+	if m.screen != screenReview || len(m.changes()) != 3 {
+		t.Fatalf("review screen %d with %v", m.screen, m.changes())
+	}
+	m = keys(t, m, "x", "enter")
+	want := []Change{{".go", util.Uti{Name: "Zed.app", Identifier: "dev.zed.Zed"}}, {".txt", util.Uti{Name: "Zed.app", Identifier: "dev.zed.Zed"}}}
+	if !reflect.DeepEqual(backend.applied, want) {
+		t.Errorf("applied %v, want %v", backend.applied, want)
+	}
+	if m.screen != screenResults || len(m.results) != 2 || len(m.pending) != 0 {
+		t.Fatalf("after apply: screen %d, results %v, pending %v", m.screen, m.results, m.pending)
+	}
+	view := m.View()
+	if !strings.Contains(view, "✓ .go → Zed.app") || !strings.Contains(view, "✗ .txt: duti failed") {
+		t.Errorf("results view:\n%s", view)
+	}
+}
+
+func TestScrolling(t *testing.T) {
+	m, _ := newTestModel(t)
+	m = run(t, m, tea.WindowSizeMsg{Width: 60, Height: 9})
+	m = keys(t, m, "G")
+	if m.cursor != 3 || m.offset != 1 {
+		t.Errorf("cursor %d offset %d, want 3 and 1 with 3 visible rows", m.cursor, m.offset)
+	}
+	if view := m.View(); strings.Contains(view, ".md") || !strings.Contains(view, ".txt") {
+		t.Errorf("view scrolled to the end:\n%s", view)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	m, _ := newTestModel(t)
+	m.p = ui.New(nil, true, ui.Theme{ui.Heading: "1"})
+	if got, want := m.highlight("Zed.app", []int{0, 1, 4}), "\033[1mZe\033[0md.\033[1ma\033[0mpp"; got != want {
+		t.Errorf("highlight() = %q, want %q", got, want)
+	}
+}
+
+func TestPad(t *testing.T) {
+	p := ui.New(nil, true, ui.Theme{ui.Accent: "36"})
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abc…"},
+		{p.Paint(ui.Accent, "ab"), 3, p.Paint(ui.Accent, "ab") + " "},
+	}
+	for _, tt := range tests {
+		if got := pad(tt.s, tt.width); got != tt.want {
+			t.Errorf("pad(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
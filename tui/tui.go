@@ -0,0 +1,68 @@
+// Package tui is the full-screen interactive mode of dutis: a list of
+// suffixes with their current and configured handlers, an application
+// picker and a review screen that applies every change at once.
+package tui
+
+import (
+	"context"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+// Entry is one row of the suffix list.
+type Entry struct {
+	Suffix      util.Suffix
+	Description string
+	Configured  *util.Association // nil when the suffix is not in the config
+}
+
+// Change sets App as the handler of Suffix.
+type Change struct {
+	Suffix util.Suffix
+	App    util.Uti
+}
+
+// Result is the outcome of applying one change.
+type Result struct {
+	Change
+	Err   error // setting the handler failed
+	Saved bool  // the association was recorded in the config
+}
+
+// Backend is what the TUI needs from dutis. The CLI implements it with the
+// same functions its commands use; tests use a fake.
+type Backend interface {
+	// Entries returns the suffixes to list.
+	Entries() []Entry
+	// Current returns the default handler of suffix; a zero Handler means
+	// there is none.
+	Current(ctx context.Context, suffix util.Suffix) (util.Handler, error)
+	// Apps returns the installed applications.
+	Apps(ctx context.Context) ([]util.Uti, error)
+	// Recommended returns the names of the applications that declare
+	// suffix.
+	Recommended(ctx context.Context, suffix util.Suffix) []string
+	// Recent returns the applications used in earlier sessions.
+	Recent() []util.RecentApp
+	// Apply sets and records the changes, returning one result per change.
+	Apply(ctx context.Context, changes []Change) []Result
+}
+
+// Run shows the TUI, styled with p's theme, until the user quits and
+// returns the results of the changes that were applied. Changes still
+// pending are discarded. When ctx is done it returns the results so far
+// with ctx's error.
+func Run(ctx context.Context, backend Backend, p *ui.Printer) ([]Result, error) {
+	m := newModel(ctx, backend, p)
+	final, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	var results []Result
+	if fm, ok := final.(model); ok {
+		results = fm.results
+	}
+	if ctx.Err() != nil {
+		return results, ctx.Err()
+	}
+	return results, err
+}
@@ -0,0 +1,191 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tobiashochguertel/dutis/ui"
+	"github.com/tobiashochguertel/dutis/util"
+)
+
+func (m model) View() string {
+	var b strings.Builder
+	switch m.screen {
+	case screenSuffixes:
+		m.viewSuffixes(&b)
+	case screenApps:
+		m.viewApps(&b)
+	case screenReview:
+		m.viewReview(&b)
+	case screenResults:
+		m.viewResults(&b)
+	}
+	return b.String()
+}
+
+func (m model) viewSuffixes(b *strings.Builder) {
+	m.title(b, "Default applications")
+	col := m.columnWidth()
+	fmt.Fprintf(b, "      %-10s %s %s %s\n", "Suffix", pad("Current", col), pad("Config", col), "Change")
+
+	rows := m.visibleEntries()
+	if len(rows) == 0 {
+		b.WriteString(m.p.Paint(ui.Pending, "  No suffix matches "+m.filter) + "\n")
+	}
+	end := min(m.offset+m.listHeight(), len(rows))
+	for i := m.offset; i < end; i++ {
+		e := rows[i]
+		check := "[ ]"
+		if m.selected[e.Suffix] {
+			check = m.p.Paint(ui.Accent, "[x]")
+		}
+		configured := m.p.Paint(ui.Muted, "-")
+		if e.Configured != nil {
+			configured = e.Configured.Application
+		}
+		change := ""
+		if app, ok := m.pending[e.Suffix]; ok {
+			change = m.p.Paint(ui.Added, "→ "+app.Name)
+		}
+		_, positions, _ := util.FuzzyMatch(m.filter, string(e.Suffix))
+		suffix := m.highlight(pad(string(e.Suffix), 10), positions)
+		line := fmt.Sprintf("%s %s %s %s %s", check, suffix, pad(m.handlerLabel(e.Suffix), col), pad(configured, col), change)
+		b.WriteString(m.cursorLine(i == m.cursor, line))
+	}
+
+	b.WriteString("\n")
+	switch {
+	case m.filtering:
+		fmt.Fprintf(b, "Filter: %s█\n", m.filter)
+	case m.filter != "":
+		b.WriteString(m.p.Paint(ui.Muted, fmt.Sprintf("Filter: %s (esc clears)", m.filter)) + "\n")
+	case len(m.pending) > 0:
+		b.WriteString(m.p.Paint(ui.Pending, fmt.Sprintf("%d change(s) pending", len(m.pending))) + "\n")
+	default:
+		b.WriteString("\n")
+	}
+	m.help(b, "↑/↓ move", "space select", "enter choose app", "/ filter", "r review", "q quit")
+}
+
+func (m model) viewApps(b *strings.Builder) {
+	targets := make([]string, len(m.targets))
+	for i, s := range m.targets {
+		targets[i] = s.String()
+	}
+	m.title(b, "Application for "+strings.Join(targets, " "))
+	fmt.Fprintf(b, "Search: %s█\n", m.appFilter)
+
+	rows := m.appRows()
+	switch {
+	case m.appsErr != nil:
+		b.WriteString(m.p.Paint(ui.Failure, "  "+ui.SymbolFailure+" "+m.appsErr.Error()) + "\n")
+	case m.apps == nil:
+		b.WriteString(m.p.Paint(ui.Muted, "  scanning applications...") + "\n")
+	case len(rows) == 0:
+		b.WriteString(m.p.Paint(ui.Pending, "  No application matches "+m.appFilter) + "\n")
+	}
+	end := min(m.appOffset+m.listHeight(), len(rows))
+	for i := m.appOffset; i < end; i++ {
+		row := rows[i]
+		mark := " "
+		if row.recommended {
+			mark = m.p.Paint(ui.Success, "★")
+		}
+		line := fmt.Sprintf("%s %s %s", mark, m.highlight(pad(row.app.Name, 2*m.columnWidth()), row.positions), m.p.Paint(ui.Muted, row.app.Identifier))
+		b.WriteString(m.cursorLine(i == m.appCursor, line))
+	}
+
+	b.WriteString("\n")
+	if _, ok := m.recommended[m.firstTarget()]; !ok {
+		b.WriteString(m.p.Paint(ui.Muted, "looking up recommendations...") + "\n")
+	} else {
+		b.WriteString(m.p.Paint(ui.Muted, "★ recommended for "+m.firstTarget().String()) + "\n")
+	}
+	m.help(b, "type to search", "↑/↓ move", "enter pick", "esc back")
+}
+
+func (m model) viewReview(b *strings.Builder) {
+	m.title(b, "Review changes")
+	for i, c := range m.changes() {
+		line := fmt.Sprintf("%-10s %s → %s %s", c.Suffix, m.handlerLabel(c.Suffix),
+			m.p.Paint(ui.Added, c.App.Name), m.p.Paint(ui.Muted, "("+c.App.Identifier+")"))
+		b.WriteString(m.cursorLine(i == m.reviewCursor, line))
+	}
+	b.WriteString("\n")
+	if m.applying {
+		b.WriteString(m.p.Paint(ui.Pending, "Applying...") + "\n")
+	} else {
+		b.WriteString("\n")
+	}
+	m.help(b, "enter apply", "x drop change", "esc back")
+}
+
+func (m model) viewResults(b *strings.Builder) {
+	m.title(b, "Applied")
+	for _, r := range m.results {
+		switch {
+		case r.Err != nil:
+			b.WriteString(m.p.Paint(ui.Failure, fmt.Sprintf("  %s %s: %v", ui.SymbolFailure, r.Suffix, r.Err)) + "\n")
+		case !r.Saved:
+			b.WriteString(m.p.Paint(ui.Pending, fmt.Sprintf("  %s %s → %s (not saved to config)", ui.SymbolPending, r.Suffix, r.App.Name)) + "\n")
+		default:
+			b.WriteString(m.p.Paint(ui.Success, fmt.Sprintf("  %s %s → %s", ui.SymbolSuccess, r.Suffix, r.App.Name)) + "\n")
+		}
+	}
+	b.WriteString("\n")
+	m.help(b, "esc change more", "q quit")
+}
+
+func (m model) title(b *strings.Builder, text string) {
+	b.WriteString(m.p.Paint(ui.Title, "dutis — "+text) + "\n\n")
+}
+
+func (m model) help(b *strings.Builder, keys ...string) {
+	b.WriteString(m.p.Paint(ui.Muted, strings.Join(keys, " · ")))
+}
+
+func (m model) cursorLine(active bool, line string) string {
+	if active {
+		return m.p.Paint(ui.Accent, "› ") + line + "\n"
+	}
+	return "  " + line + "\n"
+}
+
+// highlight paints the runes of s at positions, the characters that
+// matched a search.
+func (m model) highlight(s string, positions []int) string {
+	if len(positions) == 0 {
+		return s
+	}
+	matched := make(map[int]bool, len(positions))
+	for _, i := range positions {
+		matched[i] = true
+	}
+	var b, run strings.Builder
+	for i, r := range []rune(s) {
+		if matched[i] {
+			run.WriteRune(r)
+			continue
+		}
+		b.WriteString(m.p.Paint(ui.Heading, run.String()))
+		run.Reset()
+		b.WriteRune(r)
+	}
+	b.WriteString(m.p.Paint(ui.Heading, run.String()))
+	return b.String()
+}
+
+// columnWidth is the width of the handler columns of the suffix list.
+func (m model) columnWidth() int {
+	return min(max((m.width-24)/3, 12), 32)
+}
+
+// pad truncates or pads s, which may contain color codes, to width
+// visible columns.
+func pad(s string, width int) string {
+	visible := []rune(ui.Strip(s))
+	if len(visible) > width {
+		return string(visible[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-len(visible))
+}
@@ -0,0 +1,125 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Style names a kind of output; the theme decides how it looks.
+type Style string
+
+const (
+	Title   Style = "title"   // section rules and headings
+	Heading Style = "heading" // the version banner and result headings
+	Muted   Style = "muted"   // secondary information
+	Accent  Style = "accent"  // list items and highlighted values
+	Accent2 Style = "accent2" // alternating list items
+	Success Style = "success" // ✓ status lines
+	Failure Style = "failure" // ✗ status lines
+	Pending Style = "pending" // ○ status lines and notices
+	Added   Style = "added"   // inserted diff lines
+	Removed Style = "removed" // deleted diff lines
+)
+
+// Styles lists every style, in documentation order.
+var Styles = []Style{Title, Heading, Muted, Accent, Accent2, Success, Failure, Pending, Added, Removed}
+
+// Theme maps each style to an SGR parameter string such as "1;35".
+// Styles without an entry are printed plain.
+type Theme map[Style]string
+
+var themes = map[string]Theme{
+	"default": {
+		Title:   "1;35",
+		Heading: "1;36",
+		Muted:   "2;37",
+		Accent:  "0;36",
+		Accent2: "0;34",
+		Success: "2;32",
+		Failure: "0;31",
+		Pending: "2;33",
+		Added:   "0;32",
+		Removed: "0;31",
+	},
+	// bright avoids the dim attribute, which some terminals render unreadably.
+	"bright": {
+		Title:   "1;95",
+		Heading: "1;96",
+		Muted:   "37",
+		Accent:  "96",
+		Accent2: "94",
+		Success: "92",
+		Failure: "91",
+		Pending: "93",
+		Added:   "92",
+		Removed: "91",
+	},
+	// mono uses only bold and dim.
+	"mono": {
+		Title:   "1",
+		Heading: "1",
+		Muted:   "2",
+		Failure: "1",
+		Removed: "2",
+		Added:   "1",
+	},
+}
+
+// ThemeNames returns the names of the built-in themes.
+func ThemeNames() []string {
+	var names []string
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadTheme returns the built-in theme called name ("" means "default"),
+// with overrides applied. overrides has the form "style=sgr:style=sgr",
+// e.g. "title=1;34:muted=90", as in the DUTIS_COLORS variable.
+func LoadTheme(name, overrides string) (Theme, error) {
+	if name == "" {
+		name = "default"
+	}
+	base, ok := themes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q (want %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+	theme := make(Theme, len(base))
+	for s, code := range base {
+		theme[s] = code
+	}
+
+	for _, field := range strings.Split(overrides, ":") {
+		if field == "" {
+			continue
+		}
+		key, code, ok := strings.Cut(field, "=")
+		if !ok || !knownStyle(Style(key)) || !validSGR(code) {
+			return nil, fmt.Errorf("invalid color override %q (want style=sgr, e.g. title=1;34)", field)
+		}
+		theme[Style(key)] = code
+	}
+	return theme, nil
+}
+
+func knownStyle(s Style) bool {
+	for _, known := range Styles {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// validSGR accepts digits separated by semicolons; "" clears the style.
+func validSGR(code string) bool {
+	for _, r := range code {
+		if (r < '0' || r > '9') && r != ';' {
+			return false
+		}
+	}
+	return true
+}
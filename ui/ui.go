@@ -0,0 +1,105 @@
+// Package ui prints the human-readable output of dutis: it decides whether
+// color is used and styles text according to a theme.
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// Status symbols, printed before status lines.
+const (
+	SymbolSuccess = "✓"
+	SymbolFailure = "✗"
+	SymbolPending = "○"
+)
+
+// Printer writes to w, coloring styled text when color is enabled.
+// The zero indent prints status lines flush left.
+type Printer struct {
+	w      io.Writer
+	color  bool
+	theme  Theme
+	indent string
+}
+
+// New returns a Printer for w. Color is only used when color is true.
+func New(w io.Writer, color bool, theme Theme) *Printer {
+	return &Printer{w: w, color: color, theme: theme}
+}
+
+// ColorEnabled reports whether output to f should be colored. --no-color
+// (noColor) and a non-empty NO_COLOR always disable color; otherwise a
+// CLICOLOR_FORCE other than "0" enables it, and by default it is enabled
+// only when f is a terminal.
+func ColorEnabled(f *os.File, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+		return true
+	}
+	return IsTerminal(f)
+}
+
+// IsTerminal reports whether f is a character device such as a TTY.
+func IsTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Color reports whether the printer colors its output.
+func (p *Printer) Color() bool { return p.color }
+
+// Indent returns a printer that prefixes status lines with prefix.
+func (p *Printer) Indent(prefix string) *Printer {
+	q := *p
+	q.indent = p.indent + prefix
+	return &q
+}
+
+// Paint returns text in style s, or text unchanged without color.
+func (p *Printer) Paint(s Style, text string) string {
+	code := p.theme[s]
+	if !p.color || code == "" || text == "" {
+		return text
+	}
+	return "\033[" + code + "m" + text + "\033[0m"
+}
+
+var sgrPattern = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// Strip removes the color codes added by Paint, e.g. to measure the
+// visible width of text.
+func Strip(text string) string {
+	return sgrPattern.ReplaceAllString(text, "")
+}
+
+// Print, Printf and Println write plain text.
+func (p *Printer) Print(a ...any) { fmt.Fprint(p.w, a...) }
+
+func (p *Printer) Printf(format string, a ...any) { fmt.Fprintf(p.w, format, a...) }
+
+func (p *Printer) Println(a ...any) { fmt.Fprintln(p.w, a...) }
+
+// Styledf writes a formatted line in style s.
+func (p *Printer) Styledf(s Style, format string, a ...any) {
+	fmt.Fprintln(p.w, p.Paint(s, fmt.Sprintf(format, a...)))
+}
+
+// Successf, Failuref and Pendingf write a status line: the symbol and the
+// message, both in the status style.
+func (p *Printer) Successf(format string, a ...any) { p.status(Success, SymbolSuccess, format, a) }
+
+func (p *Printer) Failuref(format string, a ...any) { p.status(Failure, SymbolFailure, format, a) }
+
+func (p *Printer) Pendingf(format string, a ...any) { p.status(Pending, SymbolPending, format, a) }
+
+func (p *Printer) status(s Style, symbol, format string, a []any) {
+	fmt.Fprintln(p.w, p.indent+p.Paint(s, symbol+" "+fmt.Sprintf(format, a...)))
+}
@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	// A regular file is never a terminal.
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		noColor, force string
+		flag           bool
+		want           bool
+	}{
+		{want: false},
+		{force: "1", want: true},
+		{force: "0", want: false},
+		{noColor: "1", force: "1", want: false},
+		{force: "1", flag: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColor)
+		t.Setenv("CLICOLOR_FORCE", tt.force)
+		if got := ColorEnabled(f, tt.flag); got != tt.want {
+			t.Errorf("ColorEnabled(NO_COLOR=%q, CLICOLOR_FORCE=%q, --no-color=%v) = %v, want %v",
+				tt.noColor, tt.force, tt.flag, got, tt.want)
+		}
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	theme, err := LoadTheme("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	p := New(&buf, false, theme)
+	p.Successf("saved %d", 2)
+	p.Indent("  ").Failuref("failed")
+	p.Pendingf("later")
+	p.Styledf(Title, "title")
+	if want := "✓ saved 2\n  ✗ failed\n○ later\ntitle\n"; buf.String() != want {
+		t.Errorf("plain output = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	p = New(&buf, true, theme)
+	p.Indent("  ").Successf("ok")
+	if want := "  \033[2;32m✓ ok\033[0m\n"; buf.String() != want {
+		t.Errorf("colored output = %q, want %q", buf.String(), want)
+	}
+	if got := Strip(p.Paint(Accent, "x") + " y"); got != "x y" {
+		t.Errorf("Strip() = %q, want %q", got, "x y")
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	theme, err := LoadTheme("mono", "title=1;34:accent=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme[Title] != "1;34" || theme[Accent] != "" || theme[Muted] != "2" {
+		t.Errorf("LoadTheme(mono, overrides) = %v", theme)
+	}
+	if _, err := LoadTheme("neon", ""); err == nil {
+		t.Error("LoadTheme(neon) succeeded")
+	}
+	for _, bad := range []string{"title", "bogus=1", "title=red"} {
+		if _, err := LoadTheme("", bad); err == nil {
+			t.Errorf("LoadTheme(%q) succeeded", bad)
+		}
+	}
+}
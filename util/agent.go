@@ -0,0 +1,314 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Agent modes: a long-running `dutis watch`, or `dutis apply` at login and
+// whenever the config changes.
+const (
+	AgentWatch = "watch"
+	AgentApply = "apply"
+)
+
+// AgentModes lists the modes in the order status reports them.
+var AgentModes = []string{AgentWatch, AgentApply}
+
+// AgentLabelPrefix is prepended to the mode to form the launchd label.
+const AgentLabelPrefix = "com.github.tobiashochguertel.dutis."
+
+// agentPath is the PATH agents run with; launchd's default lacks the
+// Homebrew prefixes where duti lives.
+const agentPath = "/opt/homebrew/bin:/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin"
+
+// AgentSpec describes a LaunchAgent running dutis.
+type AgentSpec struct {
+	Mode string
+	// Program is the dutis executable and Args what follows it.
+	Program string
+	Args    []string
+	// Interval re-runs an apply agent this often, in seconds; 0 for never.
+	Interval int
+	// WatchPaths re-run an apply agent when one of them changes.
+	WatchPaths []string
+	// LogDir holds <mode>.log, which gets both stdout and stderr.
+	LogDir string
+}
+
+// Label returns the launchd label of the agent.
+func (s AgentSpec) Label() string { return AgentLabelPrefix + s.Mode }
+
+// LogPath returns the file the agent logs to.
+func (s AgentSpec) LogPath() string { return filepath.Join(s.LogDir, s.Mode+".log") }
+
+// AgentProgram returns the path an agent should run for the dutis
+// executable at exe. Symlinks are kept, and a versioned Homebrew Cellar path,
+// which goes away on upgrade, becomes the prefix's bin link to the same
+// binary.
+func AgentProgram(exe string) string {
+	i := strings.LastIndex(exe, "/Cellar/")
+	if i < 0 {
+		return exe
+	}
+	link := filepath.Join(exe[:i], "bin", filepath.Base(exe))
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return exe
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err != nil || resolved != target {
+		return exe
+	}
+	return link
+}
+
+// NewAgentSpec returns the spec of mode running program. configPath, when
+// set, is passed as --config and watched by an apply agent; interval is
+// the watch interval or the apply StartInterval in seconds.
+func NewAgentSpec(mode, program, configPath string, interval int) (AgentSpec, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return AgentSpec{}, err
+	}
+	spec := AgentSpec{Mode: mode, Program: program, LogDir: filepath.Join(dir, "logs")}
+	if configPath != "" {
+		spec.Args = append(spec.Args, "--config", configPath)
+	}
+	switch mode {
+	case AgentWatch:
+		spec.Args = append(spec.Args, "watch")
+		if interval > 0 {
+			spec.Args = append(spec.Args, "--interval", strconv.Itoa(interval)+"s")
+		}
+	case AgentApply:
+		spec.Args = append(spec.Args, "apply")
+		spec.Interval = interval
+		if configPath == "" {
+			if configPath, err = getConfigPath(); err != nil {
+				return AgentSpec{}, err
+			}
+		}
+		spec.WatchPaths = []string{configPath}
+	default:
+		return AgentSpec{}, fmt.Errorf("unknown agent %q: want %s", mode, strings.Join(AgentModes, " or "))
+	}
+	return spec, nil
+}
+
+var agentTemplate = template.Must(template.New("agent").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Program}}</string>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>PATH</key>
+		<string>{{xml .Path}}</string>
+	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+{{- if eq .Mode "watch"}}
+	<key>KeepAlive</key>
+	<true/>
+{{- end}}
+{{- if .Interval}}
+	<key>StartInterval</key>
+	<integer>{{.Interval}}</integer>
+{{- end}}
+{{- if .WatchPaths}}
+	<key>WatchPaths</key>
+	<array>
+{{- range .WatchPaths}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+{{- end}}
+	<key>StandardOutPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>ProcessType</key>
+	<string>Background</string>
+</dict>
+</plist>
+`))
+
+func xmlEscape(s string) (string, error) {
+	var buf bytes.Buffer
+	err := xml.EscapeText(&buf, []byte(s))
+	return buf.String(), err
+}
+
+// Render returns the agent's property list and checks it with the plist
+// parser.
+func (s AgentSpec) Render() ([]byte, error) {
+	var buf bytes.Buffer
+	err := agentTemplate.Execute(&buf, struct {
+		AgentSpec
+		Label, LogPath, Path string
+	}{s, s.Label(), s.LogPath(), agentPath})
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateAgentPlist(buf.Bytes(), s.Label()); err != nil {
+		return nil, fmt.Errorf("generated plist is invalid: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateAgentPlist checks that data is a LaunchAgent property list for
+// label with the keys launchd needs.
+func ValidateAgentPlist(data []byte, label string) error {
+	v, err := ParsePlist(data)
+	if err != nil {
+		return err
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("root is not a dictionary")
+	}
+	if got, _ := dict["Label"].(string); got != label {
+		return fmt.Errorf("Label is %q, want %q", got, label)
+	}
+	args := plistStrings(dict["ProgramArguments"])
+	if len(args) == 0 || !filepath.IsAbs(args[0]) {
+		return fmt.Errorf("ProgramArguments must start with an absolute path")
+	}
+	if _, ok := dict["StandardOutPath"].(string); !ok {
+		return fmt.Errorf("StandardOutPath is missing")
+	}
+	return nil
+}
+
+// AgentStatus describes an installed agent.
+type AgentStatus struct {
+	Mode      string `json:"mode" yaml:"mode"`
+	Label     string `json:"label" yaml:"label"`
+	Path      string `json:"path" yaml:"path"`
+	Installed bool   `json:"installed" yaml:"installed"`
+	Loaded    bool   `json:"loaded" yaml:"loaded"`
+	State     string `json:"state,omitempty" yaml:"state,omitempty"` // as launchctl reports it, e.g. "running"
+	Log       string `json:"log,omitempty" yaml:"log,omitempty"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// AgentPlistPath returns where the agent of mode is installed in dir.
+func AgentPlistPath(dir, mode string) string {
+	return filepath.Join(dir, AgentLabelPrefix+mode+".plist")
+}
+
+// DefaultAgentDir returns ~/Library/LaunchAgents.
+func DefaultAgentDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents"), nil
+}
+
+// launchdDomain is the launchctl domain of the user's agents.
+func launchdDomain() string {
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+// canLaunchctl reports whether launchctl is installed.
+func canLaunchctl() bool {
+	_, err := lookPath("launchctl")
+	return err == nil
+}
+
+// InstallAgent writes the agent's plist to dir and, when load is set and
+// launchctl exists, (re)loads it. It returns the plist path and whether
+// the agent was loaded.
+func InstallAgent(ctx context.Context, spec AgentSpec, dir string, load bool) (string, bool, error) {
+	data, err := spec.Render()
+	if err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(spec.LogDir, 0755); err != nil {
+		return "", false, err
+	}
+	path := AgentPlistPath(dir, spec.Mode)
+	if load && canLaunchctl() {
+		// A loaded agent keeps its old definition until booted out.
+		_, _ = runCommand(ctx, true, "launchctl", "bootout", launchdDomain()+"/"+spec.Label())
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return "", false, err
+	}
+	if !load || !canLaunchctl() {
+		return path, false, nil
+	}
+	if output, err := runCommand(ctx, true, "launchctl", "bootstrap", launchdDomain(), path); err != nil {
+		return path, false, fmt.Errorf("loading %s: %w, output: %s", path, err, strings.TrimSpace(string(output)))
+	}
+	Log.Info("installed agent", "label", spec.Label(), "path", path)
+	return path, true, nil
+}
+
+// UninstallAgent unloads the agent of mode and removes its plist from dir.
+// It reports whether there was anything to remove.
+func UninstallAgent(ctx context.Context, dir, mode string) (bool, error) {
+	path := AgentPlistPath(dir, mode)
+	if canLaunchctl() {
+		_, _ = runCommand(ctx, true, "launchctl", "bootout", launchdDomain()+"/"+AgentLabelPrefix+mode)
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	Log.Info("uninstalled agent", "label", AgentLabelPrefix+mode, "path", path)
+	return true, nil
+}
+
+// AgentStatusOf reports whether the agent of mode is installed in dir,
+// whether its plist is valid, and what launchd says about it.
+func AgentStatusOf(ctx context.Context, dir, mode string) AgentStatus {
+	label := AgentLabelPrefix + mode
+	st := AgentStatus{Mode: mode, Label: label, Path: AgentPlistPath(dir, mode)}
+	data, err := os.ReadFile(st.Path)
+	if err == nil {
+		st.Installed = true
+		if err := ValidateAgentPlist(data, label); err != nil {
+			st.Error = err.Error()
+		} else if v, err := ParsePlist(data); err == nil {
+			st.Log, _ = v.(map[string]any)["StandardOutPath"].(string)
+		}
+	} else if !os.IsNotExist(err) {
+		st.Error = err.Error()
+	}
+	if !canLaunchctl() {
+		return st
+	}
+	output, err := runCommand(ctx, false, "launchctl", "print", launchdDomain()+"/"+label)
+	if err != nil {
+		return st
+	}
+	st.Loaded = true
+	for _, line := range strings.Split(string(output), "\n") {
+		if state, ok := strings.CutPrefix(strings.TrimSpace(line), "state = "); ok {
+			st.State = state
+			break
+		}
+	}
+	return st
+}
@@ -0,0 +1,179 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestAgentRender(t *testing.T) {
+	specs := map[string]AgentSpec{
+		"watch": {Mode: AgentWatch, Program: "/opt/homebrew/bin/dutis", Args: []string{"watch", "--interval", "300s"},
+			LogDir: "/Users/me/.dutis/logs"},
+		"apply": {Mode: AgentApply, Program: "/Users/me/go/bin/dutis", Args: []string{"--config", "/Users/me/dotfiles/dutis & co.yaml", "apply"},
+			Interval: 3600, WatchPaths: []string{"/Users/me/dotfiles/dutis & co.yaml"}, LogDir: "/Users/me/.dutis/logs"},
+	}
+	for name, spec := range specs {
+		t.Run(name, func(t *testing.T) {
+			data, err := spec.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "agent", name+".plist")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(data, want) {
+				t.Errorf("plist differs from %s:\n--- got\n%s\n--- want\n%s", golden, data, want)
+			}
+
+			v, err := ParsePlist(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dict := v.(map[string]any)
+			if got := plistStrings(dict["ProgramArguments"]); !reflect.DeepEqual(got, append([]string{spec.Program}, spec.Args...)) {
+				t.Errorf("ProgramArguments = %q", got)
+			}
+			if got := plistStrings(dict["WatchPaths"]); !slices.Equal(got, spec.WatchPaths) {
+				t.Errorf("WatchPaths = %q", got)
+			}
+		})
+	}
+}
+
+func TestValidateAgentPlist(t *testing.T) {
+	valid, err := AgentSpec{Mode: AgentWatch, Program: "/usr/local/bin/dutis", Args: []string{"watch"}, LogDir: "/tmp"}.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, data, label, want string
+	}{
+		{"valid", string(valid), AgentLabelPrefix + "watch", ""},
+		{"other label", string(valid), AgentLabelPrefix + "apply", "Label"},
+		{"relative program", strings.Replace(string(valid), "/usr/local/bin/dutis", "dutis", 1), AgentLabelPrefix + "watch", "absolute"},
+		{"not a plist", "label = dutis", AgentLabelPrefix + "watch", "plist"},
+	}
+	for _, tt := range tests {
+		err := ValidateAgentPlist([]byte(tt.data), tt.label)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: ValidateAgentPlist() = %v, want an error with %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNewAgentSpec(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	watch, err := NewAgentSpec(AgentWatch, "/usr/local/bin/dutis", "", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(watch.Args, []string{"watch", "--interval", "60s"}) || watch.WatchPaths != nil {
+		t.Errorf("watch spec = %+v", watch)
+	}
+	apply, err := NewAgentSpec(AgentApply, "/usr/local/bin/dutis", "/etc/dutis.yaml", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(apply.Args, []string{"--config", "/etc/dutis.yaml", "apply"}) || !reflect.DeepEqual(apply.WatchPaths, []string{"/etc/dutis.yaml"}) {
+		t.Errorf("apply spec = %+v", apply)
+	}
+	if _, err := NewAgentSpec("cron", "/usr/local/bin/dutis", "", 0); err == nil {
+		t.Error("NewAgentSpec accepted an unknown mode")
+	}
+}
+
+func TestAgentProgram(t *testing.T) {
+	prefix := t.TempDir()
+	cellar := filepath.Join(prefix, "Cellar", "dutis", "1.2.0", "bin", "dutis")
+	link := filepath.Join(prefix, "bin", "dutis")
+	for _, dir := range []string{filepath.Dir(cellar), filepath.Dir(link)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(cellar, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../Cellar/dutis/1.2.0/bin/dutis", link); err != nil {
+		t.Fatal(err)
+	}
+
+	// A symlinked executable is run through the link, and a resolved
+	// Cellar path goes back to it.
+	if got := AgentProgram(link); got != link {
+		t.Errorf("AgentProgram(%s) = %s, want the link kept", link, got)
+	}
+	if got := AgentProgram(cellar); got != link {
+		t.Errorf("AgentProgram(%s) = %s, want %s", cellar, got, link)
+	}
+
+	// A Cellar version the link no longer points to is kept as is.
+	old := filepath.Join(prefix, "Cellar", "dutis", "1.1.0", "bin", "dutis")
+	if got := AgentProgram(old); got != old {
+		t.Errorf("AgentProgram(%s) = %s, want it unchanged", old, got)
+	}
+	if got := AgentProgram("/usr/local/bin/dutis"); got != "/usr/local/bin/dutis" {
+		t.Errorf("AgentProgram(/usr/local/bin/dutis) = %s", got)
+	}
+}
+
+func TestAgentInstall(t *testing.T) {
+	fake := useFakeTools(t, t.TempDir(), func(argv []string) (string, error) {
+		if argv[1] == "print" {
+			return "gui/501/com.github.tobiashochguertel.dutis.watch = {\n\tactive count = 1\n\tstate = running\n}\n", nil
+		}
+		return "", nil
+	}, "launchctl")
+	dir := filepath.Join(t.TempDir(), "LaunchAgents")
+	spec, err := NewAgentSpec(AgentWatch, "/usr/local/bin/dutis", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	path, loaded, err := InstallAgent(ctx, spec, dir, true)
+	if err != nil || !loaded || path != AgentPlistPath(dir, AgentWatch) {
+		t.Fatalf("InstallAgent() = %q, %v, %v", path, loaded, err)
+	}
+	if calls := fake.commands("launchctl bootstrap"); len(calls) != 1 || !strings.HasSuffix(calls[0], path) {
+		t.Errorf("bootstrap calls %v", calls)
+	}
+	if _, err := os.Stat(spec.LogDir); err != nil {
+		t.Errorf("log directory: %v", err)
+	}
+
+	st := AgentStatusOf(ctx, dir, AgentWatch)
+	if !st.Installed || !st.Loaded || st.State != "running" || st.Error != "" || st.Log != spec.LogPath() {
+		t.Errorf("status = %+v", st)
+	}
+
+	removed, err := UninstallAgent(ctx, dir, AgentWatch)
+	if err != nil || !removed {
+		t.Fatalf("UninstallAgent() = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("plist still there: %v", err)
+	}
+	if removed, err := UninstallAgent(ctx, dir, AgentWatch); err != nil || removed {
+		t.Errorf("second UninstallAgent() = %v, %v", removed, err)
+	}
+}
@@ -1,15 +1,18 @@
 package util
 
 import (
+	"context"
 	"encoding/gob"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
 type UtiCache struct {
 	Data      map[string]Uti
 	Timestamp time.Time
+	Roots     []string // ScanRoots when the cache was written
 }
 
 type RecommendedAppsCache struct {
@@ -41,32 +44,67 @@ func getRecommendedAppsCachePath() (string, error) {
 	return filepath.Join(cacheDir, "recommended_apps_cache.gob"), nil
 }
 
-func LoadUtiCache() (map[string]Uti, bool) {
+// CacheInfo describes the application cache for `dutis cache status`.
+type CacheInfo struct {
+	Path         string    `json:"path" yaml:"path"`
+	Ready        bool      `json:"ready" yaml:"ready"`
+	Applications int       `json:"applications" yaml:"applications"`
+	UpdatedAt    time.Time `json:"updated_at,omitempty" yaml:"updated_at,omitempty"`
+}
+
+func readUtiCache() (*UtiCache, error) {
 	cachePath, err := getCacheFilePath()
 	if err != nil {
-		return nil, false
+		return nil, err
 	}
 
 	file, err := os.Open(cachePath)
 	if err != nil {
-		return nil, false
+		return nil, err
 	}
 	defer file.Close()
 
 	var cache UtiCache
 	decoder := gob.NewDecoder(file)
 	if err := decoder.Decode(&cache); err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+func LoadUtiCache() (map[string]Uti, bool) {
+	cache, err := readUtiCache()
+	if err != nil {
+		Log.Info("application cache miss", "reason", err)
 		return nil, false
 	}
 
 	// Cache valid for 24 hours
-	if time.Since(cache.Timestamp) > 24*time.Hour {
+	if age := time.Since(cache.Timestamp); age > 24*time.Hour {
+		Log.Info("application cache miss", "reason", "expired", "age", age.Round(time.Second))
+		return nil, false
+	}
+	if !slices.Equal(cache.Roots, ScanRoots) {
+		Log.Info("application cache miss", "reason", "scan roots changed")
 		return nil, false
 	}
 
+	Log.Debug("application cache hit", "applications", len(cache.Data), "updated_at", cache.Timestamp)
 	return cache.Data, true
 }
 
+// UtiCacheInfo reports whether the application cache is usable.
+func UtiCacheInfo() CacheInfo {
+	var info CacheInfo
+	info.Path, _ = getCacheFilePath()
+	if cache, err := readUtiCache(); err == nil {
+		info.UpdatedAt = cache.Timestamp
+		info.Applications = len(cache.Data)
+		info.Ready = time.Since(cache.Timestamp) <= 24*time.Hour && slices.Equal(cache.Roots, ScanRoots)
+	}
+	return info
+}
+
 func SaveUtiCache(data map[string]Uti) error {
 	cachePath, err := getCacheFilePath()
 	if err != nil {
@@ -82,21 +120,25 @@ func SaveUtiCache(data map[string]Uti) error {
 	cache := UtiCache{
 		Data:      data,
 		Timestamp: time.Now(),
+		Roots:     ScanRoots,
 	}
 
 	encoder := gob.NewEncoder(file)
 	return encoder.Encode(cache)
 }
 
-func GetCachedUtiMap() map[string]Uti {
+func GetCachedUtiMap(ctx context.Context) (map[string]Uti, error) {
 	if cached, ok := LoadUtiCache(); ok {
-		return cached
+		return cached, nil
 	}
 
 	// Cache miss, build and save
-	utiMap := ListApplicationsUti()
+	utiMap, err := ListApplicationsUti(ctx)
+	if err != nil {
+		return nil, err
+	}
 	_ = SaveUtiCache(utiMap)
-	return utiMap
+	return utiMap, nil
 }
 
 func LoadRecommendedAppsCache(suffix string) ([]string, bool) {
@@ -114,15 +156,22 @@ func LoadRecommendedAppsCache(suffix string) ([]string, bool) {
 	var cache RecommendedAppsCache
 	decoder := gob.NewDecoder(file)
 	if err := decoder.Decode(&cache); err != nil {
+		Log.Info("recommended applications cache unreadable", "error", err)
 		return nil, false
 	}
 
 	// Cache valid for 24 hours
 	if time.Since(cache.Timestamp) > 24*time.Hour {
+		Log.Debug("recommended applications cache miss", "suffix", suffix, "reason", "expired")
 		return nil, false
 	}
 
 	apps, ok := cache.Data[suffix]
+	if ok {
+		Log.Debug("recommended applications cache hit", "suffix", suffix)
+	} else {
+		Log.Debug("recommended applications cache miss", "suffix", suffix)
+	}
 	return apps, ok
 }
 
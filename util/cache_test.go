@@ -0,0 +1,122 @@
+package util
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeTestCache(t *testing.T, name string, v any) {
+	t.Helper()
+	path := filepath.Join(os.Getenv("HOME"), ".cache", "dutis", name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if data, ok := v.([]byte); ok {
+		_, err = file.Write(data)
+	} else {
+		err = gob.NewEncoder(file).Encode(v)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadUtiCache(t *testing.T) {
+	apps := map[string]Uti{"Zed.app": {"Zed.app", "/Applications/Zed.app", "dev.zed.Zed"}}
+	tests := []struct {
+		name  string
+		cache any // nil leaves the cache file missing
+		want  bool
+	}{
+		{"missing", nil, false},
+		{"fresh", UtiCache{apps, time.Now().Add(-time.Hour), ScanRoots}, true},
+		{"expired", UtiCache{apps, time.Now().Add(-25 * time.Hour), ScanRoots}, false},
+		{"other roots", UtiCache{apps, time.Now().Add(-time.Hour), []string{"/Applications"}}, false},
+		{"corrupt", []byte("not a gob"), false},
+		{"truncated", []byte{0x1f, 0xff, 0x81}, false},
+		{"empty", []byte{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			if tt.cache != nil {
+				writeTestCache(t, "uti_cache.gob", tt.cache)
+			}
+			got, ok := LoadUtiCache()
+			if ok != tt.want {
+				t.Fatalf("LoadUtiCache() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && !reflect.DeepEqual(got, apps) {
+				t.Errorf("LoadUtiCache() = %v, want %v", got, apps)
+			}
+			if info := UtiCacheInfo(); info.Ready != tt.want {
+				t.Errorf("UtiCacheInfo().Ready = %v, want %v", info.Ready, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveUtiCacheRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writeTestCache(t, "uti_cache.gob", []byte("not a gob"))
+	apps := map[string]Uti{"Zed.app": {"Zed.app", "/Applications/Zed.app", "dev.zed.Zed"}}
+	if err := SaveUtiCache(apps); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := LoadUtiCache()
+	if !ok || !reflect.DeepEqual(got, apps) {
+		t.Errorf("LoadUtiCache() = %v, %v after save", got, ok)
+	}
+	if info := UtiCacheInfo(); info.Applications != 1 || time.Since(info.UpdatedAt) > time.Minute {
+		t.Errorf("UtiCacheInfo() = %+v", info)
+	}
+}
+
+func TestRecommendedAppsCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		cache  any
+		suffix string
+		want   []string
+		wantOK bool
+	}{
+		{"hit", RecommendedAppsCache{map[string][]string{".md": {"Zed.app"}}, time.Now()}, ".md", []string{"Zed.app"}, true},
+		{"other suffix", RecommendedAppsCache{map[string][]string{".md": {"Zed.app"}}, time.Now()}, ".txt", nil, false},
+		{"expired", RecommendedAppsCache{map[string][]string{".md": {"Zed.app"}}, time.Now().Add(-25 * time.Hour)}, ".md", nil, false},
+		{"corrupt", []byte("not a gob"), ".md", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			writeTestCache(t, "recommended_apps_cache.gob", tt.cache)
+			got, ok := LoadRecommendedAppsCache(tt.suffix)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadRecommendedAppsCache(%q) = %v, %v, want %v, %v", tt.suffix, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSaveRecommendedAppsCacheKeepsOtherSuffixes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := SaveRecommendedAppsCache(".md", []string{"Zed.app"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveRecommendedAppsCache(".txt", []string{"TextEdit.app"}); err != nil {
+		t.Fatal(err)
+	}
+	for suffix, want := range map[string][]string{".md": {"Zed.app"}, ".txt": {"TextEdit.app"}} {
+		if got, ok := LoadRecommendedAppsCache(suffix); !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("LoadRecommendedAppsCache(%q) = %v, %v, want %v", suffix, got, ok, want)
+		}
+	}
+}
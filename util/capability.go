@@ -0,0 +1,209 @@
+package util
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities that features depend on. The tools are looked up in PATH;
+// CapLaunchServices needs macOS and swift, and is withdrawn when a query
+// fails.
+const (
+	CapDuti           = "duti"
+	CapMdls           = "mdls"
+	CapSwift          = "swift"
+	CapLaunchServices = "launchservices"
+)
+
+// Capability describes whether one helper is usable.
+type Capability struct {
+	Name      string `json:"name" yaml:"name"`
+	Available bool   `json:"available" yaml:"available"`
+	Path      string `json:"path,omitempty" yaml:"path,omitempty"`
+	Version   string `json:"version,omitempty" yaml:"version,omitempty"`
+	Reason    string `json:"reason,omitempty" yaml:"reason,omitempty"` // why it is unavailable
+
+	withdrawn bool // available when probed, until a query failed
+}
+
+// Degradation records a feature that ran in a reduced form.
+type Degradation struct {
+	Feature  string `json:"feature" yaml:"feature"`
+	Fallback string `json:"fallback" yaml:"fallback"`
+	Reason   string `json:"reason" yaml:"reason"`
+}
+
+// capabilityProbeTimeout bounds the version queries of the probe.
+const capabilityProbeTimeout = 5 * time.Second
+
+// lookPath finds helper tools; tests replace it.
+var lookPath = exec.LookPath
+
+var capabilities struct {
+	once     sync.Once
+	mu       sync.Mutex
+	caps     map[string]*Capability
+	degraded []Degradation
+}
+
+// ProbeCapabilities detects the helpers once per process and returns them
+// sorted by name. Later calls return the recorded state.
+func ProbeCapabilities(ctx context.Context) []Capability {
+	capabilities.once.Do(func() { probeCapabilities(ctx) })
+
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	var list []Capability
+	for _, c := range capabilities.caps {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// HasCapability reports whether name is usable, probing on first use.
+func HasCapability(ctx context.Context, name string) bool {
+	capabilities.once.Do(func() { probeCapabilities(ctx) })
+
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	c, ok := capabilities.caps[name]
+	return ok && c.Available
+}
+
+func probeCapabilities(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, capabilityProbeTimeout)
+	defer cancel()
+
+	versionArgs := map[string][]string{CapDuti: {"-V"}, CapMdls: nil, CapSwift: {"--version"}}
+	caps := make(map[string]*Capability)
+	var wg sync.WaitGroup
+	for name, args := range versionArgs {
+		c := &Capability{Name: name}
+		caps[name] = c
+		path, err := lookPath(name)
+		if err != nil {
+			c.Reason = name + " not found in PATH"
+			continue
+		}
+		c.Available, c.Path = true, path
+		if args == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := runCommand(ctx, true, name, args...); err == nil || len(out) > 0 {
+				c.Version = firstLine(string(out))
+			}
+		}()
+	}
+	wg.Wait()
+
+	ls := &Capability{Name: CapLaunchServices}
+	switch {
+	case runtime.GOOS != "darwin":
+		ls.Reason = "LaunchServices needs macOS"
+	case !caps[CapSwift].Available:
+		ls.Reason = "querying LaunchServices needs swift"
+	default:
+		ls.Available = true
+	}
+	caps[CapLaunchServices] = ls
+
+	capabilities.mu.Lock()
+	capabilities.caps = caps
+	capabilities.mu.Unlock()
+
+	for _, c := range caps {
+		Log.Debug("capability", "name", c.Name, "available", c.Available, "version", c.Version, "reason", c.Reason)
+	}
+}
+
+// withdrawCapability marks name unavailable for the rest of the run, or
+// until RestoreCapability, e.g. after a LaunchServices query failed, so
+// later calls go straight to the fallback.
+func withdrawCapability(name, reason string) {
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	if c, ok := capabilities.caps[name]; ok && c.Available {
+		c.Available, c.Reason, c.withdrawn = false, reason, true
+		Log.Info("capability withdrawn", "name", name, "reason", reason)
+	}
+}
+
+// RestoreCapability makes name available again after withdrawCapability,
+// so a long-running command retries a query that failed once, e.g. on a
+// timeout. A capability the probe found missing stays unavailable. It
+// reports whether name is available.
+func RestoreCapability(ctx context.Context, name string) bool {
+	capabilities.once.Do(func() { probeCapabilities(ctx) })
+
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	c, ok := capabilities.caps[name]
+	if !ok {
+		return false
+	}
+	if c.withdrawn {
+		c.Available, c.Reason, c.withdrawn = true, "", false
+		Log.Info("capability restored", "name", name)
+	}
+	return c.Available
+}
+
+// capabilityReason explains why name is unavailable.
+func capabilityReason(name string) string {
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	if c, ok := capabilities.caps[name]; ok {
+		return c.Reason
+	}
+	return name + " unavailable"
+}
+
+// noteDegraded records that feature used fallback because of reason. Each
+// feature is recorded once.
+func noteDegraded(feature, fallback, reason string) {
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	for _, d := range capabilities.degraded {
+		if d.Feature == feature {
+			return
+		}
+	}
+	capabilities.degraded = append(capabilities.degraded, Degradation{feature, fallback, reason})
+	Log.Info("degraded", "feature", feature, "fallback", fallback, "reason", reason)
+}
+
+// Degradations returns the features that ran in a reduced form so far, for
+// a single summary notice at the end of a command.
+func Degradations() []Degradation {
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	return append([]Degradation(nil), capabilities.degraded...)
+}
+
+// resetCapabilities forgets the probe and degradations; tests use it.
+func resetCapabilities() {
+	capabilities.mu.Lock()
+	defer capabilities.mu.Unlock()
+	capabilities.once = sync.Once{}
+	capabilities.caps = nil
+	capabilities.degraded = nil
+}
+
+// missingCapabilityError is returned by features that have no fallback.
+type missingCapabilityError struct {
+	Feature string
+	Reason  string
+}
+
+func (e *missingCapabilityError) Error() string {
+	return e.Feature + " is unavailable: " + strings.TrimSpace(e.Reason) + " (run `dutis doctor`)"
+}
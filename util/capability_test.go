@@ -0,0 +1,68 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFallbacksWithoutTools(t *testing.T) {
+	root := t.TempDir()
+	writeTestApp(t, root, "Editor.app", "testdata/Info.binary.plist")
+	if err := os.Mkdir(filepath.Join(root, "Utilities"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	withoutTools(t, root)
+	ctx := context.Background()
+
+	apps, err := ListApplicationsUti(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || apps["Editor.app"].Identifier != "com.example.Editor" {
+		t.Errorf("ListApplicationsUti() = %v", apps)
+	}
+
+	if got := LSCopyAllRoleHandlersForContentType(ctx, ".markdown"); !reflect.DeepEqual(got, []string{"Editor.app"}) {
+		t.Errorf("recommendations for .markdown = %v", got)
+	}
+	if got := LSCopyAllRoleHandlersForContentType(ctx, ".rs"); len(got) != 0 {
+		t.Errorf("recommendations for .rs = %v", got)
+	}
+
+	h, err := LookupHandlers(ctx, "public.plain-text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Source != HandlerSourceInfoPlist || len(h.Candidates) != 1 || h.Candidates[0].BundleID != "com.example.Editor" {
+		t.Errorf("LookupHandlers() = %+v", h)
+	}
+
+	err = SetDefaultApplication(ctx, "com.example.Editor", ".md", RoleAll)
+	var missing *missingCapabilityError
+	if !errors.As(err, &missing) || !strings.Contains(err.Error(), "duti not found") {
+		t.Errorf("SetDefaultApplication() error = %v", err)
+	}
+
+	var features []string
+	for _, d := range Degradations() {
+		features = append(features, d.Feature)
+	}
+	want := []string{"application scan", "recommendations", "handler lookup"}
+	if !reflect.DeepEqual(features, want) {
+		t.Errorf("Degradations() = %v, want %v", features, want)
+	}
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	withoutTools(t, t.TempDir())
+	for _, c := range ProbeCapabilities(context.Background()) {
+		if c.Available || c.Reason == "" {
+			t.Errorf("capability %s = %+v, want unavailable with a reason", c.Name, c)
+		}
+	}
+}
@@ -1,17 +1,98 @@
 package util
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os/exec"
+	"strings"
+	"time"
 )
 
-func commandExists(command string) bool {
-	_, err := exec.LookPath(command)
+// maxLoggedOutput bounds how much subprocess output is written to the log.
+const maxLoggedOutput = 512
+
+// CommandTimeout bounds each subprocess, so a hung mdls, swift or duti
+// cannot freeze dutis. Zero disables the limit.
+var CommandTimeout = time.Minute
+
+// commandWaitDelay is how long a killed subprocess may hold its output
+// pipes open before they are closed.
+const commandWaitDelay = 2 * time.Second
+
+// runCommand runs name with args and returns its stdout, or stdout and
+// stderr interleaved when combined is set. The process is killed when ctx
+// is done or CommandTimeout passes. Every run is traced to Log.
+func runCommand(ctx context.Context, combined bool, name string, args ...string) ([]byte, error) {
+	if CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, CommandTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	out, err := execCommand(ctx, combined, name, args...)
+	logCommand(append([]string{name}, args...), time.Since(start), out, err)
+	// Report the cancellation rather than the "signal: killed" it caused.
 	if err != nil {
-		if _, ok := err.(*exec.Error); ok {
-			return false
+		switch ctxErr := ctx.Err(); {
+		case errors.Is(ctxErr, context.DeadlineExceeded):
+			return out, fmt.Errorf("%s timed out after %s: %w", name, time.Since(start).Round(time.Millisecond), ctxErr)
+		case ctxErr != nil:
+			return out, ctxErr
 		}
-		log.Fatal(err)
 	}
-	return true
+	return out, err
+}
+
+// execCommand starts the subprocess for runCommand. Tests replace it with a
+// fake so that no real tools run.
+var execCommand = func(ctx context.Context, combined bool, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = commandWaitDelay
+	if combined {
+		return cmd.CombinedOutput()
+	}
+	return cmd.Output()
+}
+
+func logCommand(argv []string, elapsed time.Duration, out []byte, err error) {
+	attrs := []slog.Attr{
+		slog.String("cmd", strings.Join(argv, " ")),
+		slog.Duration("duration", elapsed),
+		slog.Int("exit_code", exitCode(err)),
+		slog.String("output", truncateOutput(out)),
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		attrs = append(attrs, slog.String("stderr", truncateOutput(exitErr.Stderr)))
+	}
+
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelInfo
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	Log.LogAttrs(context.Background(), level, "exec", attrs...)
+}
+
+// exitCode returns the exit status for err: 0 on success and -1 when the
+// command could not be started.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func truncateOutput(out []byte) string {
+	s := strings.TrimSpace(string(out))
+	if len(s) <= maxLoggedOutput {
+		return s
+	}
+	return fmt.Sprintf("%s… (%d bytes)", s[:maxLoggedOutput], len(s))
 }
@@ -0,0 +1,65 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommandIsTraced(t *testing.T) {
+	var buf bytes.Buffer
+	old := Log
+	Log = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	defer func() { Log = old }()
+
+	out, err := runCommand(context.Background(), true, "sh", "-c", "echo hello; exit 3")
+	if err == nil {
+		t.Fatal("runCommand succeeded, want exit status 3")
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("output = %q, want %q", out, "hello\n")
+	}
+	for _, want := range []string{`cmd="sh -c echo hello; exit 3"`, "exit_code=3", "output=hello", "level=INFO"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q does not contain %q", buf.String(), want)
+		}
+	}
+}
+
+func TestTruncateOutput(t *testing.T) {
+	long := strings.Repeat("x", maxLoggedOutput+10)
+	got := truncateOutput([]byte(long))
+	if !strings.HasPrefix(got, strings.Repeat("x", maxLoggedOutput)+"…") || !strings.HasSuffix(got, "(522 bytes)") {
+		t.Errorf("truncateOutput(long) = %q", got)
+	}
+	if got := truncateOutput([]byte("  short\n")); got != "short" {
+		t.Errorf("truncateOutput(short) = %q", got)
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	old := CommandTimeout
+	CommandTimeout = 50 * time.Millisecond
+	defer func() { CommandTimeout = old }()
+
+	start := time.Now()
+	_, err := runCommand(context.Background(), false, "sleep", "5")
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "sleep timed out") {
+		t.Errorf("runCommand(sleep 5) error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("runCommand(sleep 5) took %s, want it killed", elapsed)
+	}
+}
+
+func TestRunCommandCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := runCommand(ctx, false, "sleep", "5"); !errors.Is(err, context.Canceled) {
+		t.Errorf("runCommand(sleep 5) error = %v, want context.Canceled", err)
+	}
+}
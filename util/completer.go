@@ -1,66 +1,134 @@
 package util
 
-import "github.com/c-bata/go-prompt"
+import (
+	"slices"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// FuzzyFilter returns the suggestions whose text fuzzy-matches pattern,
+// best first. boost, which may be nil, raises the rank of a suggestion.
+func FuzzyFilter(suggests []prompt.Suggest, pattern string, boost func(prompt.Suggest) int) []prompt.Suggest {
+	texts := make([]string, len(suggests))
+	for i, s := range suggests {
+		texts[i] = s.Text
+	}
+	var by func(int) int
+	if boost != nil {
+		by = func(i int) int { return boost(suggests[i]) }
+	}
+	var matched []prompt.Suggest
+	for _, r := range FuzzyRank(pattern, texts, by) {
+		matched = append(matched, suggests[r.Index])
+	}
+	return matched
+}
 
 func MainCompleter(d prompt.Document) []prompt.Suggest {
 	s := []prompt.Suggest{
 		{Text: "1", Description: "suffix, change default application by suffix(eg. .txt, .md, .go)"},
 		{Text: "2", Description: "preset, change default application by preset(eg. code, office, image)"},
 	}
-	return prompt.FilterHasPrefix(s, d.GetWordBeforeCursor(), true)
+	return FuzzyFilter(s, d.GetWordBeforeCursor(), nil)
 }
 
 func PresetCompleter(d prompt.Document) []prompt.Suggest {
-	s := []prompt.Suggest{
-		{Text: "code", Description: "For popular coding files"},
-		{Text: "text", Description: "For popular text files"},
-		{Text: "image", Description: "For popular image files"},
+	return FuzzyFilter(categorySuggestions(), d.GetWordBeforeCursor(), nil)
+}
+
+// suffixCategories are named groups of catalogue suffixes that can be
+// given instead of a suffix list.
+var suffixCategories = []struct {
+	Name, Description string
+	Suffixes          []Suffix
+}{
+	{"code", "For popular coding files", []Suffix{".go", ".py", ".js", ".ts", ".jsx", ".tsx", ".c", ".cpp", ".h", ".hpp", ".java", ".php", ".rb", ".rs", ".swift", ".kt", ".dart", ".vue"}},
+	{"script", "For shell and scripting files", []Suffix{".sh", ".zsh", ".bash", ".fish", ".py", ".rb", ".js"}},
+	{"web", "For web files", []Suffix{".html", ".css", ".scss", ".sass", ".less", ".js", ".ts", ".jsx", ".tsx", ".vue"}},
+	{"text", "For popular text files", []Suffix{".txt", ".md", ".log"}},
+	{"data", "For data files", []Suffix{".json", ".xml", ".yml", ".yaml", ".toml", ".csv", ".tsv", ".sql"}},
+	{"config", "For configuration files", []Suffix{".ini", ".conf", ".toml", ".yml", ".yaml", ".json"}},
+}
+
+func categorySuggestions() []prompt.Suggest {
+	s := make([]prompt.Suggest, len(suffixCategories))
+	for i, c := range suffixCategories {
+		s[i] = prompt.Suggest{Text: c.Name, Description: c.Description}
 	}
-	return prompt.FilterHasPrefix(s, d.GetWordBeforeCursor(), true)
+	return s
+}
+
+// suffixCatalogue lists the suffixes offered for completion.
+var suffixCatalogue = []prompt.Suggest{
+	{Text: ".txt", Description: "For text files"},
+	{Text: ".md", Description: "For markdown files"},
+	{Text: ".go", Description: "For golang files"},
+	{Text: ".py", Description: "For python files"},
+	{Text: ".js", Description: "For javascript files"},
+	{Text: ".ts", Description: "For typescript files"},
+	{Text: ".c", Description: "For c files"},
+	{Text: ".cpp", Description: "For c++ files"},
+	{Text: ".h", Description: "For header files"},
+	{Text: ".hpp", Description: "For header files"},
+	{Text: ".java", Description: "For java files"},
+	{Text: ".sh", Description: "For shell files"},
+	{Text: ".zsh", Description: "For zsh files"},
+	{Text: ".bash", Description: "For bash files"},
+	{Text: ".fish", Description: "For fish files"},
+	{Text: ".json", Description: "For json files"},
+	{Text: ".xml", Description: "For xml files"},
+	{Text: ".html", Description: "For html files"},
+	{Text: ".css", Description: "For css files"},
+	{Text: ".scss", Description: "For scss files"},
+	{Text: ".sass", Description: "For sass files"},
+	{Text: ".less", Description: "For less files"},
+	{Text: ".vue", Description: "For vue files"},
+	{Text: ".tsx", Description: "For typescript files"},
+	{Text: ".jsx", Description: "For javascript files"},
+	{Text: ".php", Description: "For php files"},
+	{Text: ".rb", Description: "For ruby files"},
+	{Text: ".rs", Description: "For rust files"},
+	{Text: ".swift", Description: "For swift files"},
+	{Text: ".kt", Description: "For kotlin files"},
+	{Text: ".dart", Description: "For dart files"},
+	{Text: ".sql", Description: "For sql files"},
+	{Text: ".yml", Description: "For yaml files"},
+	{Text: ".yaml", Description: "For yaml files"},
+	{Text: ".toml", Description: "For toml files"},
+	{Text: ".ini", Description: "For ini files"},
+	{Text: ".conf", Description: "For conf files"},
+	{Text: ".log", Description: "For log files"},
+	{Text: ".csv", Description: "For csv files"},
+	{Text: ".tsv", Description: "For tsv files"},
 }
 
+// SuffixCompleter completes the word before the cursor with a suffix, or
+// with a category when the word does not start like a suffix.
 func SuffixCompleter(d prompt.Document) []prompt.Suggest {
-	s := []prompt.Suggest{
-		{Text: ".txt", Description: "For text files"},
-		{Text: ".md", Description: "For markdown files"},
-		{Text: ".go", Description: "For golang files"},
-		{Text: ".py", Description: "For python files"},
-		{Text: ".js", Description: "For javascript files"},
-		{Text: ".ts", Description: "For typescript files"},
-		{Text: ".c", Description: "For c files"},
-		{Text: ".cpp", Description: "For c++ files"},
-		{Text: ".h", Description: "For header files"},
-		{Text: ".hpp", Description: "For header files"},
-		{Text: ".java", Description: "For java files"},
-		{Text: ".sh", Description: "For shell files"},
-		{Text: ".zsh", Description: "For zsh files"},
-		{Text: ".bash", Description: "For bash files"},
-		{Text: ".fish", Description: "For fish files"},
-		{Text: ".json", Description: "For json files"},
-		{Text: ".xml", Description: "For xml files"},
-		{Text: ".html", Description: "For html files"},
-		{Text: ".css", Description: "For css files"},
-		{Text: ".scss", Description: "For scss files"},
-		{Text: ".sass", Description: "For sass files"},
-		{Text: ".less", Description: "For less files"},
-		{Text: ".vue", Description: "For vue files"},
-		{Text: ".tsx", Description: "For typescript files"},
-		{Text: ".jsx", Description: "For javascript files"},
-		{Text: ".php", Description: "For php files"},
-		{Text: ".rb", Description: "For ruby files"},
-		{Text: ".rs", Description: "For rust files"},
-		{Text: ".swift", Description: "For swift files"},
-		{Text: ".kt", Description: "For kotlin files"},
-		{Text: ".dart", Description: "For dart files"},
-		{Text: ".sql", Description: "For sql files"},
-		{Text: ".yml", Description: "For yaml files"},
-		{Text: ".yaml", Description: "For yaml files"},
-		{Text: ".toml", Description: "For toml files"},
-		{Text: ".ini", Description: "For ini files"},
-		{Text: ".conf", Description: "For conf files"},
-		{Text: ".log", Description: "For log files"},
-		{Text: ".csv", Description: "For csv files"},
-		{Text: ".tsv", Description: "For tsv files"},
+	return RecentSuffixCompleter(nil)(d)
+}
+
+// RecentSuffixCompleter is SuffixCompleter ranking the recent suffixes
+// higher.
+func RecentSuffixCompleter(recent []Suffix) prompt.Completer {
+	boost := func(s prompt.Suggest) int {
+		if slices.Contains(recent, Suffix(s.Text)) {
+			return BoostRecent
+		}
+		return 0
+	}
+	return func(d prompt.Document) []prompt.Suggest {
+		word := d.GetWordBeforeCursor()
+		suggests := FuzzyFilter(suffixCatalogue, suffixQuery(word), boost)
+		if word != "" && !strings.ContainsAny(word[:1], ".*") {
+			suggests = append(FuzzyFilter(categorySuggestions(), strings.ToLower(word), nil), suggests...)
+		}
+		return suggests
 	}
-	return prompt.FilterHasPrefix(s, d.GetWordBeforeCursor(), true)
+}
+
+// KnownSuffixes returns the suffix catalogue with descriptions.
+func KnownSuffixes() []prompt.Suggest {
+	return suffixCatalogue
 }
@@ -1,28 +1,86 @@
 package util
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Association struct {
-	Suffix      string    `yaml:"suffix"`
-	Application string    `yaml:"application"`
-	BundleID    string    `yaml:"bundle_id"`
-	SetAt       time.Time `yaml:"set_at"`
+	Suffix      Suffix    `yaml:"suffix" json:"suffix"`
+	Application string    `yaml:"application" json:"application"`
+	BundleID    string    `yaml:"bundle_id" json:"bundle_id"`
+	SetAt       time.Time `yaml:"set_at" json:"set_at"`
+	Role        Role      `yaml:"role,omitempty" json:"role,omitempty"`
+	// Managed entries are owned by `dutis sync`: once deleted from the
+	// config, sync reverts the suffix to Fallback, a bundle ID.
+	Managed  bool   `yaml:"managed,omitempty" json:"managed,omitempty"`
+	Fallback string `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+}
+
+// EffectiveRole returns the association's role; entries without one apply
+// to all roles.
+func (a Association) EffectiveRole() Role {
+	if a.Role == "" {
+		return RoleAll
+	}
+	return a.Role
+}
+
+// Binding is the handler configured for a UTI or a URL scheme, keyed by
+// the UTI or scheme in Config. Schemes have no role.
+type Binding struct {
+	Application string `yaml:"application" json:"application"`
+	BundleID    string `yaml:"bundle_id" json:"bundle_id"`
+	Role        Role   `yaml:"role,omitempty" json:"role,omitempty"`
+	Managed     bool   `yaml:"managed,omitempty" json:"managed,omitempty"`
+	Fallback    string `yaml:"fallback,omitempty" json:"fallback,omitempty"`
 }
 
 type Config struct {
 	Version      string                 `yaml:"version"`
-	Associations map[string]Association `yaml:"associations"` // key is suffix
+	Associations map[Suffix]Association `yaml:"associations"`
+	UTIs         map[string]Binding     `yaml:"utis,omitempty"`
+	Schemes      map[string]Binding     `yaml:"schemes,omitempty"`
+
+	// doc is the parsed config file and src the bytes it was parsed from.
+	// src is nil once the document can no longer be written back verbatim.
+	// disk holds the file contents as last read or written.
+	doc  *yaml.Node
+	src  []byte
+	disk []byte
+}
+
+// configPathOverride is set by --config.
+var configPathOverride string
+
+// SetConfigPath makes dutis use path instead of ~/.dutis/config.yaml.
+func SetConfigPath(path string) {
+	configPathOverride = path
+}
+
+// ConfigPath returns the config file in use, for display.
+func ConfigPath() string {
+	if configPathOverride != "" {
+		return configPathOverride
+	}
+	return "~/.dutis/config.yaml"
 }
 
 func getConfigPath() (string, error) {
+	if configPathOverride != "" {
+		if err := os.MkdirAll(filepath.Dir(configPathOverride), 0755); err != nil {
+			return "", err
+		}
+		return configPathOverride, nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
@@ -43,56 +101,158 @@ func LoadConfig() (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return &Config{
-				Version:      "1.0",
-				Associations: make(map[string]Association),
-			}, nil
+			return newConfig(), nil
 		}
 		return nil, err
 	}
+	return parseConfig(data)
+}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+func newConfig() *Config {
+	return &Config{
+		Version:      CurrentConfigVersion,
+		Associations: make(map[Suffix]Association),
+	}
+}
+
+func parseConfig(data []byte) (*Config, error) {
+	// Older schemas are upgraded in memory; `dutis config migrate` persists it.
+	doc, src, _, err := migrateSource(data)
+	if err != nil {
+		return nil, err
+	}
+	config := Config{doc: doc, src: src, disk: data}
+
+	if err := config.doc.Decode(&config); err != nil {
 		return nil, err
 	}
 
 	if config.Associations == nil {
-		config.Associations = make(map[string]Association)
+		config.Associations = make(map[Suffix]Association)
 	}
 
 	return &config, nil
 }
 
+// Save writes the config while holding the config lock.
 func (c *Config) Save() error {
 	configPath, err := getConfigPath()
 	if err != nil {
 		return err
 	}
+	unlock, err := lockConfig(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.save(configPath)
+}
 
-	data, err := yaml.Marshal(c)
+func (c *Config) save(configPath string) error {
+	data, err := c.marshal()
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	if err := writeConfigFile(configPath, data); err != nil {
+		return err
+	}
+	c.disk = data
+	return c.parse(data)
 }
 
-func (c *Config) AddAssociation(suffix, appName, bundleID string) error {
-	c.Associations[suffix] = Association{
-		Suffix:      suffix,
-		Application: appName,
-		BundleID:    bundleID,
-		SetAt:       time.Now(),
+// update runs edit against the latest config on disk and saves the result,
+// all under the config lock, so concurrent dutis processes don't lose each
+// other's changes.
+func (c *Config) update(edit func() error) error {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return err
 	}
-	return c.Save()
+	unlock, err := lockConfig(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && !bytes.Equal(data, c.disk) {
+		fresh, err := parseConfig(data)
+		if err != nil {
+			return err
+		}
+		*c = *fresh
+	}
+
+	if err := edit(); err != nil {
+		return err
+	}
+	return c.save(configPath)
+}
+
+// AddAssociation records bundleID as the handler for suffix. RoleAll is
+// stored as the default and left out of the file.
+func (c *Config) AddAssociation(suffix Suffix, appName, bundleID string, role Role) error {
+	return c.AddAssociations([]Suffix{suffix}, appName, bundleID, role)
+}
+
+// AddAssociations records bundleID as the handler for every suffix in a
+// single write, like AddAssociation. An existing entry keeps its managed
+// flag and fallback.
+func (c *Config) AddAssociations(suffixes []Suffix, appName, bundleID string, role Role) error {
+	assocs := make([]Association, len(suffixes))
+	for i, suffix := range suffixes {
+		assocs[i] = Association{Suffix: suffix, Application: appName, BundleID: bundleID, Role: role}
+	}
+	return c.SetAssociations(assocs)
+}
+
+// SetAssociations records assocs, which may name different applications,
+// in a single write stamped with the current time. An existing entry keeps
+// its managed flag and fallback.
+func (c *Config) SetAssociations(assocs []Association) error {
+	setAt := time.Now().UTC().Truncate(time.Second)
+	return c.update(func() error {
+		for _, assoc := range assocs {
+			if assoc.Role == RoleAll {
+				assoc.Role = ""
+			}
+			assoc.SetAt = setAt
+			if old, ok := c.Associations[assoc.Suffix]; ok {
+				assoc.Managed, assoc.Fallback = old.Managed, old.Fallback
+			}
+			c.Associations[assoc.Suffix] = assoc
+			if err := c.setEntry(assoc.Suffix, assoc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Config) RemoveAssociation(suffix Suffix) error {
+	return c.update(func() error {
+		delete(c.Associations, suffix)
+		return c.deleteEntry(suffix)
+	})
 }
 
-func (c *Config) RemoveAssociation(suffix string) error {
-	delete(c.Associations, suffix)
-	return c.Save()
+// RestoreAssociation puts back assoc, an entry as it was before a change,
+// as is; nil removes suffix.
+func (c *Config) RestoreAssociation(suffix Suffix, assoc *Association) error {
+	if assoc == nil {
+		return c.RemoveAssociation(suffix)
+	}
+	return c.update(func() error {
+		c.Associations[suffix] = *assoc
+		return c.setEntry(suffix, *assoc)
+	})
 }
 
-func (c *Config) GetAssociation(suffix string) (Association, bool) {
+func (c *Config) GetAssociation(suffix Suffix) (Association, bool) {
 	assoc, ok := c.Associations[suffix]
 	return assoc, ok
 }
@@ -109,32 +269,64 @@ func (c *Config) ListAssociations() []Association {
 	return list
 }
 
-func (c *Config) ApplyAll() error {
+// ApplyResult is the outcome of applying one association.
+type ApplyResult struct {
+	Suffix      Suffix `json:"suffix" yaml:"suffix"`
+	Application string `json:"application" yaml:"application"`
+	BundleID    string `json:"bundle_id" yaml:"bundle_id"`
+	Role        Role   `json:"role" yaml:"role"`
+	Status      string `json:"status" yaml:"status"` // "applied" or "failed"
+	Error       string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+const (
+	ApplyStatusApplied = "applied"
+	ApplyStatusFailed  = "failed"
+)
+
+// ApplyAll sets every configured association and returns one result per
+// association, in suffix order. The error reports how many failed. When ctx
+// is done it stops and returns the results so far with ctx's error.
+func (c *Config) ApplyAll(ctx context.Context) ([]ApplyResult, error) {
 	if len(c.Associations) == 0 {
-		return fmt.Errorf("no associations configured")
+		return nil, fmt.Errorf("no associations configured")
 	}
 
-	fmt.Printf("Applying %d file associations...\n\n", len(c.Associations))
-	
-	successCount := 0
+	var results []ApplyResult
+	var changes []JournalEntry
+	defer func() { recordJournal(changes...) }()
 	errorCount := 0
-
 	for _, assoc := range c.ListAssociations() {
-		fmt.Printf("  %s → %s (%s)\n", assoc.Suffix, assoc.Application, assoc.BundleID)
-		if err := SetDefaultApplication(assoc.BundleID, assoc.Suffix); err != nil {
-			fmt.Printf("    ✗ Error: %v\n", err)
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result := ApplyResult{
+			Suffix:      assoc.Suffix,
+			Application: assoc.Application,
+			BundleID:    assoc.BundleID,
+			Role:        assoc.EffectiveRole(),
+			Status:      ApplyStatusApplied,
+		}
+		change := JournalEntry{Suffix: assoc.Suffix, Role: assoc.EffectiveRole(), New: &Handler{BundleID: assoc.BundleID, Name: assoc.Application}}
+		if previous, err := CurrentHandler(ctx, assoc.Suffix, assoc.EffectiveRole()); err == nil {
+			change.Previous = &previous
+		}
+		if err := SetDefaultApplication(ctx, assoc.BundleID, assoc.Suffix.String(), assoc.EffectiveRole()); err != nil {
+			if ctx.Err() != nil {
+				return results, err
+			}
+			result.Status = ApplyStatusFailed
+			result.Error = err.Error()
 			errorCount++
-		} else {
-			fmt.Printf("    ✓ Applied\n")
-			successCount++
+		} else if change.Previous == nil || !strings.EqualFold(change.Previous.BundleID, assoc.BundleID) {
+			// Only journal actual changes, not re-applying what is set.
+			changes = append(changes, change)
 		}
+		results = append(results, result)
 	}
 
-	fmt.Printf("\n%d succeeded, %d failed\n", successCount, errorCount)
-	
 	if errorCount > 0 {
-		return fmt.Errorf("%d associations failed to apply", errorCount)
+		return results, fmt.Errorf("%d associations failed to apply", errorCount)
 	}
-	
-	return nil
+	return results, nil
 }
@@ -0,0 +1,458 @@
+package util
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The config file is edited in place so that comments, key order and
+// formatting added by hand survive dutis writes. Entries are located through
+// the yaml.v3 node positions and only their lines are rewritten; when the
+// layout is not block style (flow mappings, no associations yet) the node
+// tree is edited and re-encoded instead.
+
+const defaultConfigIndent = 4
+
+// setEntry records assoc under suffix in the document.
+func (c *Config) setEntry(suffix Suffix, assoc Association) error {
+	return c.editEntry(suffix, &assoc)
+}
+
+// deleteEntry removes suffix from the document.
+func (c *Config) deleteEntry(suffix Suffix) error {
+	return c.editEntry(suffix, nil)
+}
+
+func (c *Config) editEntry(suffix Suffix, assoc *Association) error {
+	if c.doc == nil {
+		// New config: Save encodes the struct.
+		return nil
+	}
+	if c.src != nil {
+		if data, ok, err := spliceEntry(c.src, c.doc, suffix, assoc); err != nil {
+			return err
+		} else if ok {
+			return c.parse(data)
+		}
+	}
+	if err := editEntryNode(c.doc, suffix, assoc); err != nil {
+		return err
+	}
+	c.src = nil
+	return nil
+}
+
+// parse makes data the config source and refreshes the node tree from it.
+func (c *Config) parse(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	c.doc = &doc
+	c.src = data
+	return nil
+}
+
+// marshal returns the bytes to write for the current config.
+func (c *Config) marshal() ([]byte, error) {
+	if c.src != nil {
+		return c.src, nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(c.indent())
+	var err error
+	if c.doc != nil {
+		err = enc.Encode(c.doc)
+	} else {
+		err = enc.Encode(c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// indent returns the indentation used by the document, or the default.
+func (c *Config) indent() int {
+	if c.doc == nil || len(c.doc.Content) == 0 {
+		return defaultConfigIndent
+	}
+	root := c.doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		v := root.Content[i+1]
+		if v.Kind == yaml.MappingNode && v.Style&yaml.FlowStyle == 0 && len(v.Content) > 0 {
+			if n := v.Content[0].Column - root.Content[i].Column; n > 0 {
+				return n
+			}
+		}
+	}
+	return defaultConfigIndent
+}
+
+// spliceEntry rewrites only the lines of one association in src. It reports
+// false when the document layout does not allow a line-level edit.
+func spliceEntry(src []byte, doc *yaml.Node, suffix Suffix, assoc *Association) ([]byte, bool, error) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, false, nil
+	}
+	root := doc.Content[0]
+	var assocsKey, assocs *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "associations" {
+			assocsKey, assocs = root.Content[i], root.Content[i+1]
+		}
+	}
+	if assocs == nil || assocs.Kind != yaml.MappingNode || assocs.Style&yaml.FlowStyle != 0 || len(assocs.Content) == 0 {
+		return nil, false, nil
+	}
+	for i := 1; i < len(assocs.Content); i += 2 {
+		if e := assocs.Content[i]; e.Kind != yaml.MappingNode || e.Style&yaml.FlowStyle != 0 || len(e.Content) == 0 {
+			return nil, false, nil
+		}
+	}
+
+	lines := strings.SplitAfter(string(src), "\n")
+	keyIndent := assocs.Content[0].Column - 1
+	fieldIndent := assocs.Content[1].Content[0].Column - assocs.Content[0].Column
+	if keyIndent <= assocsKey.Column-1 || fieldIndent <= 0 {
+		return nil, false, nil
+	}
+
+	var rendered []string
+	if assoc != nil {
+		text, err := renderEntry(suffix, *assoc, keyIndent, fieldIndent)
+		if err != nil {
+			return nil, false, err
+		}
+		rendered = strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+		rendered[len(rendered)-1] += "\n"
+	}
+
+	// Line indexes below are 0-based into lines.
+	var out []string
+	for i := 0; i+1 < len(assocs.Content); i += 2 {
+		key := assocs.Content[i]
+		start := key.Line - 1
+		end := entryEnd(lines, start, keyIndent)
+
+		switch {
+		case key.Value == suffix.String():
+			// Replace the entry, keeping its leading comments, or drop it
+			// together with them.
+			if assoc == nil {
+				start = commentStart(lines, start, keyIndent)
+			}
+			out = append(out, lines[:start]...)
+			out = append(out, rendered...)
+			out = append(out, lines[end+1:]...)
+			return []byte(strings.Join(out, "")), true, nil
+
+		case assoc != nil && key.Value > suffix.String():
+			at := commentStart(lines, start, keyIndent)
+			out = append(out, lines[:at]...)
+			out = append(out, rendered...)
+			out = append(out, lines[at:]...)
+			return []byte(strings.Join(out, "")), true, nil
+		}
+	}
+	if assoc == nil {
+		// Nothing to remove.
+		return src, true, nil
+	}
+
+	last := assocs.Content[len(assocs.Content)-2]
+	end := entryEnd(lines, last.Line-1, keyIndent)
+	if !strings.HasSuffix(lines[end], "\n") {
+		lines[end] += "\n"
+	}
+	out = append(out, lines[:end+1]...)
+	out = append(out, rendered...)
+	out = append(out, lines[end+1:]...)
+	return []byte(strings.Join(out, "")), true, nil
+}
+
+// entryEnd returns the last line of the block entry whose key is on line
+// start: every following line indented deeper than the key, ignoring
+// trailing blank lines.
+func entryEnd(lines []string, start, keyIndent int) int {
+	end := start
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			continue
+		}
+		if lineIndent(lines[i]) <= keyIndent {
+			break
+		}
+		end = i
+	}
+	return end
+}
+
+// commentStart returns the first line of the comment block directly above
+// line start at the key's indentation, or start if there is none.
+func commentStart(lines []string, start, keyIndent int) int {
+	for start > 0 {
+		prev := lines[start-1]
+		if !strings.HasPrefix(strings.TrimSpace(prev), "#") || lineIndent(prev) != keyIndent {
+			break
+		}
+		start--
+	}
+	return start
+}
+
+func lineIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// renderEntry encodes one association as a block mapping entry.
+func renderEntry(suffix Suffix, assoc Association, keyIndent, fieldIndent int) (string, error) {
+	node, err := entryNode(suffix, assoc)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(fieldIndent)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.MappingNode, Content: node}); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+
+	pad := strings.Repeat(" ", keyIndent)
+	var sb strings.Builder
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			sb.WriteString(pad + line)
+		}
+	}
+	return sb.String(), nil
+}
+
+// entryNode returns the key and value nodes of an association entry.
+func entryNode(suffix Suffix, assoc Association) ([]*yaml.Node, error) {
+	var value yaml.Node
+	if err := value.Encode(assoc); err != nil {
+		return nil, err
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: suffix.String()}
+	return []*yaml.Node{key, &value}, nil
+}
+
+// editEntryNode applies the change to the node tree, keeping entries sorted.
+func editEntryNode(doc *yaml.Node, suffix Suffix, assoc *Association) error {
+	root, err := documentRoot(doc)
+	if err != nil {
+		return err
+	}
+	assocs := mappingValue(root, "associations")
+	if assocs == nil {
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "associations"},
+			&yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		assocs = root.Content[len(root.Content)-1]
+	}
+	if assocs.Kind != yaml.MappingNode {
+		*assocs = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	if len(assocs.Content) == 0 {
+		assocs.Style = 0
+	}
+
+	var entry []*yaml.Node
+	if assoc != nil {
+		if entry, err = entryNode(suffix, *assoc); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i+1 < len(assocs.Content); i += 2 {
+		key := assocs.Content[i]
+		switch {
+		case key.Value == suffix.String():
+			if entry == nil {
+				assocs.Content = append(assocs.Content[:i], assocs.Content[i+2:]...)
+			} else {
+				assocs.Content[i+1] = entry[1]
+			}
+			return nil
+		case entry != nil && key.Value > suffix.String():
+			assocs.Content = append(assocs.Content[:i], append(entry, assocs.Content[i:]...)...)
+			return nil
+		}
+	}
+	assocs.Content = append(assocs.Content, entry...)
+	return nil
+}
+
+// docSnapshot records a config document before it is migrated.
+type docSnapshot struct {
+	scalars map[*yaml.Node]yaml.Node // every scalar as it was
+	keys    []*yaml.Node             // the association keys
+}
+
+func snapshotDocument(doc *yaml.Node) docSnapshot {
+	s := docSnapshot{scalars: make(map[*yaml.Node]yaml.Node)}
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode {
+			s.scalars[n] = *n
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		if assocs := mappingValue(doc.Content[0], "associations"); assocs != nil && assocs.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(assocs.Content); i += 2 {
+				s.keys = append(s.keys, assocs.Content[i])
+			}
+		}
+	}
+	return s
+}
+
+// spliceMigration makes the edits a migration made to doc on the lines of
+// src: changed scalars are rewritten where they stand, dropped association
+// entries are removed with their comments and a missing version is inserted
+// above the first key. It reports false when an edit cannot be made on the
+// lines.
+func spliceMigration(src []byte, doc *yaml.Node, before docSnapshot) ([]byte, bool) {
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode || doc.Content[0].Style&yaml.FlowStyle != 0 {
+		return nil, false
+	}
+	root := doc.Content[0]
+	lines := strings.SplitAfter(string(src), "\n")
+
+	// Rewrite changed scalars right to left so columns stay valid.
+	var changed []*yaml.Node
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if old, ok := before.scalars[n]; ok && (old.Value != n.Value || old.Style != n.Style) {
+			changed = append(changed, n)
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(doc)
+	sort.Slice(changed, func(i, j int) bool {
+		if changed[i].Line != changed[j].Line {
+			return changed[i].Line < changed[j].Line
+		}
+		return changed[i].Column > changed[j].Column
+	})
+	for _, n := range changed {
+		if n.Line < 1 || n.Line > len(lines) {
+			return nil, false
+		}
+		line, ok := replaceScalar(lines[n.Line-1], n, before.scalars[n])
+		if !ok {
+			return nil, false
+		}
+		lines[n.Line-1] = line
+	}
+
+	// Drop merged association entries from the bottom up.
+	kept := make(map[*yaml.Node]bool)
+	if assocs := mappingValue(root, "associations"); assocs != nil {
+		for i := 0; i+1 < len(assocs.Content); i += 2 {
+			kept[assocs.Content[i]] = true
+		}
+	}
+	for i := len(before.keys) - 1; i >= 0; i-- {
+		key := before.keys[i]
+		if kept[key] {
+			continue
+		}
+		if key.Line < 1 || key.Line > len(lines) || key.Style&yaml.FlowStyle != 0 {
+			return nil, false
+		}
+		start, indent := key.Line-1, key.Column-1
+		end := entryEnd(lines, start, indent)
+		start = commentStart(lines, start, indent)
+		lines = append(lines[:start], lines[end+1:]...)
+	}
+
+	if version := mappingValue(root, "version"); version != nil {
+		if _, ok := before.scalars[version]; !ok {
+			if len(root.Content) < 4 {
+				return nil, false
+			}
+			first := root.Content[2]
+			text, ok := renderScalar(version)
+			if !ok || first.Line < 1 || first.Line > len(lines) {
+				return nil, false
+			}
+			at := commentStart(lines, first.Line-1, first.Column-1)
+			line := strings.Repeat(" ", first.Column-1) + "version: " + text + "\n"
+			lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+		}
+	}
+	return []byte(strings.Join(lines, "")), true
+}
+
+// replaceScalar replaces the text of old on line with n.
+func replaceScalar(line string, n *yaml.Node, old yaml.Node) (string, bool) {
+	start := old.Column - 1
+	if start < 0 || start >= len(line) {
+		return "", false
+	}
+	end := -1
+	switch old.Style {
+	case 0:
+		if strings.HasPrefix(line[start:], old.Value) {
+			end = start + len(old.Value)
+		}
+	case yaml.DoubleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				end = i + 1
+				break
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				end = i + 1
+				break
+			}
+		}
+	}
+	text, ok := renderScalar(n)
+	if end < 0 || !ok {
+		return "", false
+	}
+	return line[:start] + text + line[end:], true
+}
+
+// renderScalar writes a single-line scalar in its style.
+func renderScalar(n *yaml.Node) (string, bool) {
+	switch n.Style {
+	case 0:
+		return n.Value, true
+	case yaml.DoubleQuotedStyle:
+		return strconv.Quote(n.Value), true
+	case yaml.SingleQuotedStyle:
+		return "'" + strings.ReplaceAll(n.Value, "'", "''") + "'", true
+	}
+	return "", false
+}
@@ -0,0 +1,492 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const handEditedConfig = `# Team defaults, see docs/dotfiles.md
+version: "1.1"
+
+associations:
+  # Editors
+  .go:
+    suffix: .go
+    application: GoLand.app
+    bundle_id: com.jetbrains.goland # keep in sync with the JetBrains toolbox
+    set_at: 2024-11-07T20:00:00Z
+
+  .txt:
+    suffix: .txt
+    application: 'Visual Studio Code.app'
+    bundle_id: com.microsoft.VSCode
+    set_at: 2024-11-07T20:00:00Z
+# end of file
+`
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".dutis", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func readTestConfig(t *testing.T, configPath string) string {
+	t.Helper()
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return regexp.MustCompile(`set_at: \S+`).ReplaceAllString(string(data), "set_at: NOW")
+}
+
+func TestConfig_SaveRoundTrip(t *testing.T) {
+	configPath := writeTestConfig(t, handEditedConfig)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != handEditedConfig {
+		t.Errorf("round trip changed config:\n%s", data)
+	}
+}
+
+func TestConfig_EditsPreserveFormatting(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Config) error
+		want string
+	}{
+		{
+			name: "insert sorted",
+			edit: func(c *Config) error { return c.AddAssociation(".md", "Typora.app", "abnerworks.Typora", RoleAll) },
+			want: `# Team defaults, see docs/dotfiles.md
+version: "1.1"
+
+associations:
+  # Editors
+  .go:
+    suffix: .go
+    application: GoLand.app
+    bundle_id: com.jetbrains.goland # keep in sync with the JetBrains toolbox
+    set_at: NOW
+
+  .md:
+    suffix: .md
+    application: Typora.app
+    bundle_id: abnerworks.Typora
+    set_at: NOW
+  .txt:
+    suffix: .txt
+    application: 'Visual Studio Code.app'
+    bundle_id: com.microsoft.VSCode
+    set_at: NOW
+# end of file
+`,
+		},
+		{
+			name: "insert first keeps comment with following entry",
+			edit: func(c *Config) error { return c.AddAssociation(".c", "Xcode.app", "com.apple.dt.Xcode", RoleAll) },
+			want: `# Team defaults, see docs/dotfiles.md
+version: "1.1"
+
+associations:
+  .c:
+    suffix: .c
+    application: Xcode.app
+    bundle_id: com.apple.dt.Xcode
+    set_at: NOW
+  # Editors
+  .go:
+    suffix: .go
+    application: GoLand.app
+    bundle_id: com.jetbrains.goland # keep in sync with the JetBrains toolbox
+    set_at: NOW
+
+  .txt:
+    suffix: .txt
+    application: 'Visual Studio Code.app'
+    bundle_id: com.microsoft.VSCode
+    set_at: NOW
+# end of file
+`,
+		},
+		{
+			name: "append last",
+			edit: func(c *Config) error { return c.AddAssociation(".yaml", "Zed.app", "dev.zed.Zed", RoleAll) },
+			want: `# Team defaults, see docs/dotfiles.md
+version: "1.1"
+
+associations:
+  # Editors
+  .go:
+    suffix: .go
+    application: GoLand.app
+    bundle_id: com.jetbrains.goland # keep in sync with the JetBrains toolbox
+    set_at: NOW
+
+  .txt:
+    suffix: .txt
+    application: 'Visual Studio Code.app'
+    bundle_id: com.microsoft.VSCode
+    set_at: NOW
+  .yaml:
+    suffix: .yaml
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+    set_at: NOW
+# end of file
+`,
+		},
+		{
+			name: "replace keeps comment",
+			edit: func(c *Config) error { return c.AddAssociation(".go", "Zed.app", "dev.zed.Zed", RoleAll) },
+			want: `# Team defaults, see docs/dotfiles.md
+version: "1.1"
+
+associations:
+  # Editors
+  .go:
+    suffix: .go
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+    set_at: NOW
+
+  .txt:
+    suffix: .txt
+    application: 'Visual Studio Code.app'
+    bundle_id: com.microsoft.VSCode
+    set_at: NOW
+# end of file
+`,
+		},
+		{
+			name: "remove",
+			edit: func(c *Config) error { return c.RemoveAssociation(".go") },
+			want: `# Team defaults, see docs/dotfiles.md
+version: "1.1"
+
+associations:
+
+  .txt:
+    suffix: .txt
+    application: 'Visual Studio Code.app'
+    bundle_id: com.microsoft.VSCode
+    set_at: NOW
+# end of file
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := writeTestConfig(t, handEditedConfig)
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.edit(config); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTestConfig(t, configPath); got != tt.want {
+				t.Errorf("config after edit:\n%s\nwant:\n%s", got, tt.want)
+			}
+
+			reloaded, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reloaded.Associations) != len(config.Associations) {
+				t.Errorf("reloaded %d associations, want %d", len(reloaded.Associations), len(config.Associations))
+			}
+		})
+	}
+}
+
+func TestConfig_EditsFlowStyle(t *testing.T) {
+	configPath := writeTestConfig(t, "version: \"1.1\"\nassociations: {}\n")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.AddAssociation(".md", "Typora.app", "abnerworks.Typora", RoleAll); err != nil {
+		t.Fatal(err)
+	}
+	want := `version: "1.1"
+associations:
+    .md:
+        suffix: .md
+        application: Typora.app
+        bundle_id: abnerworks.Typora
+        set_at: NOW
+`
+	if got := readTestConfig(t, configPath); got != want {
+		t.Errorf("config after edit:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConfig_EditsMigratedConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name: "1.0 with duplicate keys",
+			input: `# Team defaults
+version: 1.0 # bumped by hand
+
+associations:
+  # Plain text
+  txt:
+    suffix: txt
+    bundle_id: com.apple.TextEdit
+    set_at: 2024-11-01T10:00:00Z
+  # Editors
+  .go:
+    suffix: .go
+    bundle_id: com.jetbrains.goland # keep in sync
+    set_at: 2024-11-07T20:00:00Z
+  # Newer choice for text
+  '.TXT':
+    suffix: ".TXT"
+    bundle_id: com.microsoft.VSCode
+    set_at: 2024-11-07T10:00:00Z
+`,
+			want: `# Team defaults
+version: "1.1" # bumped by hand
+
+associations:
+  # Editors
+  .go:
+    suffix: .go
+    bundle_id: com.jetbrains.goland # keep in sync
+    set_at: NOW
+  .md:
+    suffix: .md
+    application: Typora.app
+    bundle_id: abnerworks.Typora
+    set_at: NOW
+  # Newer choice for text
+  '.txt':
+    suffix: ".txt"
+    bundle_id: com.microsoft.VSCode
+    set_at: NOW
+`,
+		},
+		{
+			name: "unversioned",
+			input: `# Team defaults
+
+# Everything dutis manages
+associations:
+  .txt:
+    suffix: .txt
+    bundle_id: com.apple.TextEdit # the default
+`,
+			want: `# Team defaults
+
+version: "1.1"
+# Everything dutis manages
+associations:
+  .md:
+    suffix: .md
+    application: Typora.app
+    bundle_id: abnerworks.Typora
+    set_at: NOW
+  .txt:
+    suffix: .txt
+    bundle_id: com.apple.TextEdit # the default
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := writeTestConfig(t, tt.input)
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := config.AddAssociation(".md", "Typora.app", "abnerworks.Typora", RoleAll); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTestConfig(t, configPath); got != tt.want {
+				t.Errorf("config after edit:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_CRUD(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Associations) != 0 || config.Version != CurrentConfigVersion {
+		t.Fatalf("LoadConfig() without a file = %+v, want an empty current config", config)
+	}
+
+	steps := []struct {
+		name string
+		edit func(*Config) error
+		want []string // suffix=bundle_id/role, in suffix order
+	}{
+		{"add", func(c *Config) error { return c.AddAssociation(".md", "Typora.app", "abnerworks.Typora", RoleAll) },
+			[]string{".md=abnerworks.Typora/"}},
+		{"add with role", func(c *Config) error { return c.AddAssociation(".html", "Safari.app", "com.apple.Safari", RoleViewer) },
+			[]string{".html=com.apple.Safari/viewer", ".md=abnerworks.Typora/"}},
+		{"replace", func(c *Config) error { return c.AddAssociation(".md", "Zed.app", "dev.zed.Zed", RoleEditor) },
+			[]string{".html=com.apple.Safari/viewer", ".md=dev.zed.Zed/editor"}},
+		{"remove", func(c *Config) error { return c.RemoveAssociation(".html") },
+			[]string{".md=dev.zed.Zed/editor"}},
+		{"remove missing", func(c *Config) error { return c.RemoveAssociation(".txt") },
+			[]string{".md=dev.zed.Zed/editor"}},
+		{"restore", func(c *Config) error {
+			return c.RestoreAssociation(".html", &Association{Suffix: ".html", Application: "Safari.app", BundleID: "com.apple.Safari", Role: RoleViewer})
+		}, []string{".html=com.apple.Safari/viewer", ".md=dev.zed.Zed/editor"}},
+		{"restore to none", func(c *Config) error { return c.RestoreAssociation(".html", nil) },
+			[]string{".md=dev.zed.Zed/editor"}},
+	}
+	for _, step := range steps {
+		if err := step.edit(config); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		// Check both the edited value and what the next process reads.
+		reloaded, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		for _, c := range []*Config{config, reloaded} {
+			var got []string
+			for _, a := range c.ListAssociations() {
+				got = append(got, string(a.Suffix)+"="+a.BundleID+"/"+string(a.Role))
+			}
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("%s: associations = %v, want %v", step.name, got, step.want)
+			}
+		}
+	}
+
+	assoc, ok := config.GetAssociation(".md")
+	if !ok || assoc.Application != "Zed.app" || assoc.EffectiveRole() != RoleEditor || assoc.SetAt.IsZero() {
+		t.Errorf("GetAssociation(.md) = %+v, %v", assoc, ok)
+	}
+	if _, ok := config.GetAssociation(".html"); ok {
+		t.Error("GetAssociation(.html) found a removed association")
+	}
+}
+
+func TestConfig_ApplyAll(t *testing.T) {
+	const content = `version: "1.1"
+associations:
+  .md:
+    suffix: .md
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+    set_at: 2024-11-07T20:00:00Z
+  .html:
+    suffix: .html
+    application: Gone.app
+    bundle_id: com.example.Gone
+    set_at: 2024-11-07T20:00:00Z
+    role: viewer
+  .txt:
+    suffix: .txt
+    application: TextEdit.app
+    bundle_id: com.apple.TextEdit
+    set_at: 2024-11-07T20:00:00Z
+`
+	dutiFails := func(argv []string) (string, error) {
+		if argv[0] == "duti" && argv[1] == "-s" && argv[2] == "com.example.Gone" {
+			return "failed to set", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	tests := []struct {
+		name     string
+		tools    []string
+		cancel   bool
+		statuses []string // in suffix order
+		wantErr  string
+		wantDuti int
+	}{
+		{"one failure", []string{CapDuti}, false,
+			[]string{ApplyStatusFailed, ApplyStatusApplied, ApplyStatusApplied}, "1 associations failed to apply", 3},
+		{"duti missing", nil, false,
+			[]string{ApplyStatusFailed, ApplyStatusFailed, ApplyStatusFailed}, "3 associations failed to apply", 0},
+		{"canceled", []string{CapDuti}, true,
+			nil, context.Canceled.Error(), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeTools(t, t.TempDir(), dutiFails, tt.tools...)
+			writeTestConfig(t, content)
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			results, err := config.ApplyAll(ctx)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ApplyAll() error = %v, want %q", err, tt.wantErr)
+			}
+			var statuses []string
+			for _, r := range results {
+				statuses = append(statuses, r.Status)
+				if (r.Status == ApplyStatusFailed) != (r.Error != "") {
+					t.Errorf("result %s: status %s with error %q", r.Suffix, r.Status, r.Error)
+				}
+			}
+			if !reflect.DeepEqual(statuses, tt.statuses) {
+				t.Errorf("statuses = %v, want %v", statuses, tt.statuses)
+			}
+			if got := fake.commands("duti -s"); len(got) != tt.wantDuti {
+				t.Errorf("ran %v, want %d duti calls", got, tt.wantDuti)
+			}
+			// Every applied change is journaled; the previous handler is
+			// unknown without LaunchServices.
+			journal, err := ReadJournal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied := 0
+			for _, s := range statuses {
+				if s == ApplyStatusApplied {
+					applied++
+				}
+			}
+			if len(journal) != applied || applied > 0 && (journal[0].Previous != nil || journal[0].New == nil) {
+				t.Errorf("journal = %+v, want %d entries", journal, applied)
+			}
+		})
+	}
+}
+
+func TestConfig_ApplyAllEmpty(t *testing.T) {
+	useFakeTools(t, t.TempDir(), nil, CapDuti)
+	results, err := newConfig().ApplyAll(context.Background())
+	if err == nil || len(results) != 0 {
+		t.Errorf("ApplyAll() on an empty config = %v, %v, want an error", results, err)
+	}
+}
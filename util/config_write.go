@@ -0,0 +1,152 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigBackups is the number of rotated backups (config.yaml.1 being the
+// newest) kept next to config.yaml.
+const ConfigBackups = 5
+
+// configLockTimeout bounds how long a write waits for another dutis process.
+const configLockTimeout = 10 * time.Second
+
+type ConfigBackup struct {
+	Index   int       `json:"index" yaml:"index"`
+	Path    string    `json:"path" yaml:"path"`
+	ModTime time.Time `json:"mod_time" yaml:"mod_time"`
+}
+
+func configBackupPath(configPath string, n int) string {
+	return fmt.Sprintf("%s.%d", configPath, n)
+}
+
+func lockConfig(configPath string) (func(), error) {
+	return lockFile(configPath+".lock", configLockTimeout)
+}
+
+// writeConfigFile atomically replaces the config, first rotating the
+// current contents into the backups. Unchanged contents are not rewritten.
+func writeConfigFile(configPath string, data []byte) error {
+	old, err := os.ReadFile(configPath)
+	switch {
+	case err == nil:
+		if bytes.Equal(old, data) {
+			return nil
+		}
+		if err := rotateConfigBackups(configPath, old); err != nil {
+			return fmt.Errorf("rotating backups: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	return writeFileAtomic(configPath, data, 0644)
+}
+
+func rotateConfigBackups(configPath string, current []byte) error {
+	for n := ConfigBackups - 1; n >= 1; n-- {
+		from := configBackupPath(configPath, n)
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		if err := os.Rename(from, configBackupPath(configPath, n+1)); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(configBackupPath(configPath, 1), current, 0644)
+}
+
+// writeFileAtomic writes data to a temp file in the same directory, syncs it
+// and renames it over path, so readers see either the old or the new file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// ListConfigBackups returns the existing backups, newest first.
+func ListConfigBackups() ([]ConfigBackup, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	var backups []ConfigBackup
+	for n := 1; n <= ConfigBackups; n++ {
+		path := configBackupPath(configPath, n)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, ConfigBackup{Index: n, Path: path, ModTime: info.ModTime()})
+	}
+	return backups, nil
+}
+
+// RestoreConfigBackup replaces config.yaml with backup n. The replaced
+// config becomes backup 1, so a restore can itself be rolled back.
+func RestoreConfigBackup(n int) (string, error) {
+	if n < 1 || n > ConfigBackups {
+		return "", fmt.Errorf("backup number must be between 1 and %d", ConfigBackups)
+	}
+	configPath, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	unlock, err := lockConfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	backupPath := configBackupPath(configPath, n)
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no backup %d (%s)", n, backupPath)
+		}
+		return "", err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("backup %d is not valid YAML: %w", n, err)
+	}
+	if err := writeConfigFile(configPath, data); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
@@ -0,0 +1,146 @@
+package util
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfig_BackupRotationAndRestore(t *testing.T) {
+	configPath := writeTestConfig(t, "version: \"1.1\"\nassociations: {}\n")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	suffixes := []Suffix{".a", ".b", ".c", ".d", ".e", ".f", ".g"}
+	for _, s := range suffixes {
+		if err := config.AddAssociation(s, "App.app", "com.example.app", RoleAll); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := ListConfigBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != ConfigBackups {
+		t.Fatalf("got %d backups, want %d", len(backups), ConfigBackups)
+	}
+	newest, _ := os.ReadFile(configBackupPath(configPath, 1))
+	if !strings.Contains(string(newest), ".f:") || strings.Contains(string(newest), ".g:") {
+		t.Errorf("backup 1 should be the config before .g was added:\n%s", newest)
+	}
+
+	if _, err := RestoreConfigBackup(1); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.GetAssociation(".g"); ok {
+		t.Error("restore did not roll back .g")
+	}
+	if _, ok := restored.GetAssociation(".f"); !ok {
+		t.Error("restore lost .f")
+	}
+
+	if _, err := RestoreConfigBackup(ConfigBackups + 1); err == nil {
+		t.Error("restoring a non-existent backup should fail")
+	}
+}
+
+func TestConfig_AddAssociationsWritesOnce(t *testing.T) {
+	writeTestConfig(t, "version: \"1.1\"\nassociations: {}\n")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.AddAssociations([]Suffix{".go", ".rs", ".py"}, "Zed.app", "dev.zed.Zed", RoleEditor); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := ListConfigBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("got %d backups, want 1 for a single write", len(backups))
+	}
+	reloaded, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []Suffix{".go", ".rs", ".py"} {
+		if a, ok := reloaded.GetAssociation(s); !ok || a.BundleID != "dev.zed.Zed" || a.Role != RoleEditor {
+			t.Errorf("GetAssociation(%s) = %+v, %v", s, a, ok)
+		}
+	}
+}
+
+func TestConfig_SetAssociationsWritesOnce(t *testing.T) {
+	writeTestConfig(t, `version: "1.1"
+associations:
+    .md:
+        suffix: .md
+        application: Typora.app
+        bundle_id: abnerworks.Typora
+        managed: true
+        fallback: com.apple.TextEdit
+`)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = config.SetAssociations([]Association{
+		{Suffix: ".md", Application: "Zed.app", BundleID: "dev.zed.Zed", Role: RoleAll},
+		{Suffix: ".json", Application: "Visual Studio Code.app", BundleID: "com.microsoft.VSCode", Role: RoleEditor},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if backups, err := ListConfigBackups(); err != nil || len(backups) != 1 {
+		t.Errorf("got %d backups (%v), want 1 for a single write", len(backups), err)
+	}
+	reloaded, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := reloaded.GetAssociation(".md"); a.BundleID != "dev.zed.Zed" || a.Role != "" || !a.Managed || a.Fallback != "com.apple.TextEdit" {
+		t.Errorf(".md = %+v, want Zed keeping managed and fallback", a)
+	}
+	if a, _ := reloaded.GetAssociation(".json"); a.BundleID != "com.microsoft.VSCode" || a.Role != RoleEditor || a.SetAt.IsZero() {
+		t.Errorf(".json = %+v", a)
+	}
+}
+
+func TestConfig_ConcurrentUpdates(t *testing.T) {
+	writeTestConfig(t, "version: \"1.1\"\nassociations: {}\n")
+	first, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.AddAssociation(".md", "Typora.app", "abnerworks.Typora", RoleAll); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.AddAssociation(".txt", "TextEdit.app", "com.apple.TextEdit", RoleAll); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []Suffix{".md", ".txt"} {
+		if _, ok := config.GetAssociation(s); !ok {
+			t.Errorf("association %s was lost", s)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package util
+
+import "strings"
+
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	DiffDelete
+	DiffInsert
+)
+
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// LineDiff returns a line-based diff turning a into b, computed from the
+// longest common subsequence of their lines.
+func LineDiff(a, b string) []DiffLine {
+	al := splitLines(a)
+	bl := splitLines(b)
+
+	// lcs[i][j] is the LCS length of al[i:] and bl[j:]
+	lcs := make([][]int, len(al)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bl)+1)
+	}
+	for i := len(al) - 1; i >= 0; i-- {
+		for j := len(bl) - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []DiffLine
+	i, j := 0, 0
+	for i < len(al) && j < len(bl) {
+		switch {
+		case al[i] == bl[j]:
+			out = append(out, DiffLine{DiffEqual, al[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{DiffDelete, al[i]})
+			i++
+		default:
+			out = append(out, DiffLine{DiffInsert, bl[j]})
+			j++
+		}
+	}
+	for ; i < len(al); i++ {
+		out = append(out, DiffLine{DiffDelete, al[i]})
+	}
+	for ; j < len(bl); j++ {
+		out = append(out, DiffLine{DiffInsert, bl[j]})
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,218 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CheckStatus is the outcome of a doctor check.
+type CheckStatus string
+
+const (
+	CheckOK      CheckStatus = "ok"
+	CheckWarning CheckStatus = "warning" // dutis works, with reduced features
+	CheckError   CheckStatus = "error"   // dutis cannot work until this is fixed
+)
+
+// Check is one line of `dutis doctor`. FixAction describes what Fix would
+// do; it is empty when the problem has to be fixed by hand (see Hint).
+type Check struct {
+	Name      string      `json:"name" yaml:"name"`
+	Status    CheckStatus `json:"status" yaml:"status"`
+	Version   string      `json:"version,omitempty" yaml:"version,omitempty"`
+	Path      string      `json:"path,omitempty" yaml:"path,omitempty"`
+	Detail    string      `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Hint      string      `json:"hint,omitempty" yaml:"hint,omitempty"`
+	FixAction string      `json:"fix,omitempty" yaml:"fix,omitempty"`
+
+	fix func(ctx context.Context) error
+}
+
+// CanFix reports whether Fix can repair the problem.
+func (c Check) CanFix() bool { return c.fix != nil }
+
+// Fix runs the repair described by FixAction.
+func (c Check) Fix(ctx context.Context) error {
+	if c.fix == nil {
+		return fmt.Errorf("%s cannot be fixed automatically: %s", c.Name, c.Hint)
+	}
+	return c.fix(ctx)
+}
+
+// RunChecks inspects the tools, files and directories dutis depends on.
+// It only reads; nothing is installed or changed.
+func RunChecks(ctx context.Context) []Check {
+	brew := checkTool(ctx, "brew", []string{"--version"}, CheckWarning,
+		"only needed to install duti", "install Homebrew from https://brew.sh")
+	duti := checkTool(ctx, "duti", []string{"-V"}, CheckError,
+		"needed to set default applications", "brew install duti")
+	if duti.Status != CheckOK && brew.Status == CheckOK {
+		duti.FixAction = "brew install duti"
+		duti.fix = func(ctx context.Context) error {
+			out, err := runCommand(ctx, true, "brew", "install", "duti")
+			if err != nil {
+				return fmt.Errorf("brew install duti: %w\n%s", err, out)
+			}
+			return nil
+		}
+	}
+	swift := checkTool(ctx, "swift", []string{"--version"}, CheckWarning,
+		"needed for recommendations and `dutis get`", "xcode-select --install")
+	if swift.Status != CheckOK && runtime.GOOS == "darwin" {
+		swift.FixAction = "xcode-select --install"
+		swift.fix = func(ctx context.Context) error {
+			_, err := runCommand(ctx, true, "xcode-select", "--install")
+			return err
+		}
+	}
+	mdls := checkTool(ctx, "mdls", nil, CheckError,
+		"needed to read bundle IDs and content types", "mdls ships with macOS; dutis needs macOS")
+
+	checks := []Check{duti, swift, mdls, brew, checkLaunchServices(ctx), checkConfig(), checkCache()}
+	for i, root := range ScanRoots {
+		if _, err := os.Stat(root); i > 0 && os.IsNotExist(err) {
+			continue
+		}
+		checks = append(checks, checkScanRoot(root))
+	}
+	return checks
+}
+
+// checkTool looks name up in PATH and reads its version by running it with
+// versionArgs. A tool that is not found gets the status passed as missing.
+func checkTool(ctx context.Context, name string, versionArgs []string, missing CheckStatus, purpose, hint string) Check {
+	c := Check{Name: name, Status: CheckOK}
+	path, err := lookPath(name)
+	if err != nil {
+		c.Status = missing
+		c.Detail = "not found in PATH; " + purpose
+		c.Hint = hint
+		return c
+	}
+	c.Path = path
+	if versionArgs != nil {
+		out, err := runCommand(ctx, true, name, versionArgs...)
+		if err != nil && len(out) == 0 {
+			c.Status = CheckWarning
+			c.Detail = fmt.Sprintf("could not run %s: %v", name, err)
+			return c
+		}
+		c.Version = firstLine(string(out))
+	}
+	return c
+}
+
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+func checkLaunchServices(ctx context.Context) Check {
+	c := Check{Name: CapLaunchServices, Status: CheckOK}
+	if !HasCapability(ctx, CapLaunchServices) {
+		c.Status = CheckWarning
+		c.Detail = capabilityReason(CapLaunchServices) +
+			"; recommendations and `dutis get` fall back to Info.plist declarations"
+	}
+	return c
+}
+
+func checkConfig() Check {
+	c := Check{Name: "config", Status: CheckOK}
+	path, err := getConfigPath()
+	if err != nil {
+		c.Status, c.Detail = CheckError, err.Error()
+		return c
+	}
+	c.Path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		c.Detail = "not created yet; it is written on the first `dutis set`"
+		return c
+	} else if err != nil {
+		c.Status, c.Detail = CheckError, err.Error()
+		return c
+	}
+
+	var header struct {
+		Version string `yaml:"version"`
+	}
+	parseErr := yaml.Unmarshal(data, &header)
+	c.Version = header.Version
+
+	diags := validateConfigData(path, data, nil)
+	errs := 0
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			errs++
+		}
+	}
+	switch {
+	case errs > 0:
+		c.Status = CheckError
+	case len(diags) > 0:
+		c.Status = CheckWarning
+	}
+	if len(diags) > 0 {
+		c.Detail = fmt.Sprintf("%d error(s), %d warning(s)", errs, len(diags)-errs)
+		c.Hint = "run `dutis config validate` for details"
+	}
+	if cmp, err := compareConfigVersions(header.Version, CurrentConfigVersion); parseErr == nil && err == nil && cmp < 0 {
+		c.FixAction = "dutis config migrate"
+		c.fix = func(context.Context) error {
+			_, err := MigrateConfig(false)
+			return err
+		}
+	}
+	return c
+}
+
+func checkCache() Check {
+	info := UtiCacheInfo()
+	c := Check{Name: "cache", Status: CheckOK, Path: info.Path}
+	if !info.Ready {
+		c.Status = CheckWarning
+		c.Detail = "missing or older than 24h; the next command that needs it will scan"
+		c.Hint = "dutis cache refresh"
+		c.FixAction = "dutis cache refresh"
+		c.fix = func(ctx context.Context) error {
+			apps, err := ListApplicationsUti(ctx)
+			if err != nil {
+				return err
+			}
+			return SaveUtiCache(apps)
+		}
+		return c
+	}
+	c.Detail = fmt.Sprintf("%d applications, updated %s", info.Applications, info.UpdatedAt.Format("2006-01-02 15:04"))
+	return c
+}
+
+func checkScanRoot(root string) Check {
+	c := Check{Name: "scan root", Status: CheckOK, Path: root}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		c.Status = CheckError
+		c.Detail = err.Error()
+		c.Hint = "applications are scanned from " + strings.Join(ScanRoots, ", ")
+		return c
+	}
+	apps := 0
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".app") {
+			apps++
+		}
+	}
+	c.Detail = fmt.Sprintf("%d entries, %d .app bundles", len(entries), apps)
+	return c
+}
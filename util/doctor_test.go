@@ -0,0 +1,68 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		status  CheckStatus
+		canFix  bool
+	}{
+		{"current", "version: \"1.1\"\nassociations: {}\n", CheckOK, false},
+		{"old", "version: \"1.0\"\nassociations: {}\n", CheckWarning, true},
+		{"broken", "associations: [\n", CheckError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestConfig(t, tt.content)
+			c := checkConfig()
+			if c.Status != tt.status || c.CanFix() != tt.canFix {
+				t.Errorf("checkConfig() = %s (fixable %v), want %s (fixable %v): %s",
+					c.Status, c.CanFix(), tt.status, tt.canFix, c.Detail)
+			}
+		})
+	}
+}
+
+func TestCheckConfigFixMigrates(t *testing.T) {
+	configPath := writeTestConfig(t, "version: \"1.0\"\nassociations: {}\n")
+	if err := checkConfig().Fix(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestConfig(t, configPath); !strings.Contains(got, `version: "1.1"`) {
+		t.Errorf("config after fix:\n%s", got)
+	}
+	if c := checkConfig(); c.Status != CheckOK {
+		t.Errorf("checkConfig() after fix = %s: %s", c.Status, c.Detail)
+	}
+}
+
+func TestCheckScanRoot(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"Safari.app", "Utilities", "Zed.app"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c := checkScanRoot(root); c.Status != CheckOK || c.Detail != "3 entries, 2 .app bundles" {
+		t.Errorf("checkScanRoot() = %s, %q", c.Status, c.Detail)
+	}
+	if c := checkScanRoot(filepath.Join(root, "missing")); c.Status != CheckError {
+		t.Errorf("checkScanRoot(missing) = %s, want error", c.Status)
+	}
+}
+
+func TestCheckToolMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	c := checkTool(context.Background(), "duti", []string{"-V"}, CheckError, "needed", "brew install duti")
+	if c.Status != CheckError || c.Hint != "brew install duti" || c.CanFix() {
+		t.Errorf("checkTool(missing) = %+v", c)
+	}
+}
@@ -0,0 +1,213 @@
+package util
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Scores of FuzzyMatch. A matched character earns scoreMatch, more when it
+// starts a word or follows the previous match; skipped characters cost
+// scoreGap each, up to maxGapPenalty per gap.
+const (
+	scoreMatch       = 16
+	bonusBoundary    = 24
+	bonusFirst       = 8
+	bonusConsecutive = 12
+	scoreGap         = 1
+	maxGapPenalty    = 8
+)
+
+// FuzzyMatch reports whether the runes of pattern occur in text in order,
+// ignoring case. It returns the score of the best alignment, which favours
+// word starts ("code" in "Visual Studio Code.app") and runs of adjacent
+// characters, and the rune indices of text that matched. An empty pattern
+// matches everything with score 0.
+func FuzzyMatch(pattern, text string) (score int, positions []int, ok bool) {
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(text)
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	if len(p) > len(t) {
+		return 0, nil, false
+	}
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(t) {
+		// Lowercasing changed the length; match on the lowered runes only.
+		t = lower
+	}
+
+	// best[i][j] is the best score of matching p[:i+1] with p[i] at t[j],
+	// and from[i][j] the position of p[i-1] in that alignment.
+	const none = -1 << 30
+	best := make([][]int, len(p))
+	from := make([][]int, len(p))
+	for i := range p {
+		best[i] = make([]int, len(t))
+		from[i] = make([]int, len(t))
+		for j := range t {
+			best[i][j] = none
+			if lower[j] != p[i] {
+				continue
+			}
+			gain := scoreMatch + boundaryBonus(t, j)
+			if i == 0 {
+				best[i][j] = gain - min(j*scoreGap, maxGapPenalty)
+				from[i][j] = -1
+				continue
+			}
+			for k := i - 1; k < j; k++ {
+				if best[i-1][k] == none {
+					continue
+				}
+				s := best[i-1][k] + gain
+				if k == j-1 {
+					s += bonusConsecutive
+				} else {
+					s -= min((j-k-1)*scoreGap, maxGapPenalty)
+				}
+				if s > best[i][j] {
+					best[i][j], from[i][j] = s, k
+				}
+			}
+		}
+	}
+
+	last := len(p) - 1
+	end := -1
+	for j := range t {
+		if best[last][j] != none && (end < 0 || best[last][j] > best[last][end]) {
+			end = j
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	positions = make([]int, len(p))
+	for i, j := last, end; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+	return best[last][end], positions, true
+}
+
+// boundaryBonus rewards matching the first rune of text or of a word: after
+// a separator or at a lower-to-upper case change.
+func boundaryBonus(t []rune, j int) int {
+	if j == 0 {
+		return bonusBoundary + bonusFirst
+	}
+	prev := t[j-1]
+	switch {
+	case unicode.IsSpace(prev) || strings.ContainsRune("./-_:", prev):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(t[j]):
+		return bonusBoundary
+	}
+	return 0
+}
+
+// Ranked is a candidate that matched a pattern.
+type Ranked struct {
+	Index     int   // index of the candidate
+	Score     int   // match score plus boost
+	Positions []int // rune indices of the matched characters
+}
+
+// FuzzyRank matches pattern against every candidate and returns the matches
+// best first. boost, which may be nil, is added to the score of candidate
+// i; ties keep the candidates' order.
+func FuzzyRank(pattern string, candidates []string, boost func(i int) int) []Ranked {
+	var ranked []Ranked
+	for i, c := range candidates {
+		score, positions, ok := FuzzyMatch(pattern, c)
+		if !ok {
+			continue
+		}
+		if boost != nil {
+			score += boost(i)
+		}
+		ranked = append(ranked, Ranked{i, score, positions})
+	}
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].Score > ranked[b].Score })
+	return ranked
+}
+
+// Boosts raise the rank of applications the user is likely to want. Keys
+// are lowercased application names (recommendations) and bundle IDs (config
+// entries).
+type Boosts map[string]int
+
+// Boosts for recommended, configured and recently set applications.
+const (
+	BoostRecommended = 40
+	BoostConfigured  = 20
+	BoostRecent      = 30 // set within the last week; half within a month
+)
+
+// AppBoosts boosts the recommended applications (names as returned by
+// LSCopyAllRoleHandlersForContentType), the applications used in assocs
+// and, more, those set recently.
+func AppBoosts(assocs []Association, recommended []string, now time.Time) Boosts {
+	b := make(Boosts)
+	for _, name := range recommended {
+		b.raise(path.Base(name), BoostRecommended)
+	}
+	for _, a := range assocs {
+		b.raise(a.BundleID, BoostConfigured+recentBoost(now.Sub(a.SetAt)))
+	}
+	return b
+}
+
+// AddRecent boosts the applications used in recent sessions.
+func (b Boosts) AddRecent(apps []RecentApp, now time.Time) {
+	for _, a := range apps {
+		b.raise(a.BundleID, recentBoost(now.Sub(a.UsedAt)))
+	}
+}
+
+func recentBoost(age time.Duration) int {
+	switch {
+	case age < 7*24*time.Hour:
+		return BoostRecent
+	case age < 30*24*time.Hour:
+		return BoostRecent / 2
+	}
+	return 0
+}
+
+// raise sets the boost of key to at least n.
+func (b Boosts) raise(key string, n int) {
+	if key != "" {
+		key = strings.ToLower(key)
+		b[key] = max(b[key], n)
+	}
+}
+
+// For returns the boost of app: its recommendation and config boosts
+// added up.
+func (b Boosts) For(app Uti) int {
+	return b[strings.ToLower(app.Name)] + b[strings.ToLower(app.Identifier)]
+}
+
+// RankApps ranks apps by how well their name matches pattern, plus their
+// boosts. Apps whose name does not match but whose bundle ID does are
+// ranked lower and have no positions.
+func RankApps(pattern string, apps []Uti, boosts Boosts) []Ranked {
+	var ranked []Ranked
+	for i, app := range apps {
+		score, positions, ok := FuzzyMatch(pattern, app.Name)
+		if !ok {
+			if score, _, ok = FuzzyMatch(pattern, app.Identifier); !ok {
+				continue
+			}
+			score, positions = score/2, nil
+		}
+		ranked = append(ranked, Ranked{i, score + boosts.For(app), positions})
+	}
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].Score > ranked[b].Score })
+	return ranked
+}
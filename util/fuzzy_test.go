@@ -0,0 +1,124 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		text      string
+		ok        bool
+		positions []int
+	}{
+		{"", "Zed.app", true, nil},
+		{"code", "Visual Studio Code.app", true, []int{14, 15, 16, 17}},
+		{"studio", "Visual Studio Code.app", true, []int{7, 8, 9, 10, 11, 12}},
+		{"vsc", "Visual Studio Code.app", true, []int{0, 7, 14}},
+		{"VSC", "visual studio code.app", true, []int{0, 7, 14}},
+		{"md", ".md", true, []int{1, 2}},
+		{"js", ".json", true, []int{1, 2}},
+		{"te", "TextEdit.app", true, []int{0, 4}},
+		{"edit", "TextEdit.app", true, []int{4, 5, 6, 7}},
+		{"zz", "Zed.app", false, nil},
+		{"deZ", "Zed.app", false, nil},
+		{"toolong", "Zed", false, nil},
+	}
+	for _, tt := range tests {
+		_, positions, ok := FuzzyMatch(tt.pattern, tt.text)
+		if ok != tt.ok || !reflect.DeepEqual(positions, tt.positions) {
+			t.Errorf("FuzzyMatch(%q, %q) = %v, %v, want %v, %v", tt.pattern, tt.text, positions, ok, tt.positions, tt.ok)
+		}
+	}
+}
+
+func TestFuzzyRank(t *testing.T) {
+	candidates := []string{"Xcode.app", "Visual Studio Code.app", "CotEditor.app", "Zed.app"}
+	tests := []struct {
+		pattern string
+		boost   func(int) int
+		want    []string
+	}{
+		{"code", nil, []string{"Visual Studio Code.app", "Xcode.app"}},
+		{"ed", nil, []string{"CotEditor.app", "Zed.app"}},
+		{"", nil, candidates},
+		// A boost decides between similar matches and orders an empty search.
+		{"code", func(i int) int { return map[int]int{0: BoostRecommended}[i] }, []string{"Xcode.app", "Visual Studio Code.app"}},
+		{"", func(i int) int { return i }, []string{"Zed.app", "CotEditor.app", "Visual Studio Code.app", "Xcode.app"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range FuzzyRank(tt.pattern, candidates, tt.boost) {
+			got = append(got, candidates[r.Index])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FuzzyRank(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestRankApps(t *testing.T) {
+	now := time.Date(2024, 11, 7, 20, 0, 0, 0, time.UTC)
+	apps := []Uti{
+		{Name: "CotEditor.app", Identifier: "com.coteditor.CotEditor"},
+		{Name: "TextEdit.app", Identifier: "com.apple.TextEdit"},
+		{Name: "Visual Studio Code.app", Identifier: "com.microsoft.VSCode"},
+		{Name: "Zed.app", Identifier: "dev.zed.Zed"},
+	}
+	assocs := []Association{
+		{Application: "Zed.app", BundleID: "dev.zed.Zed", SetAt: now.Add(-time.Hour)},
+		{Application: "TextEdit.app", BundleID: "com.apple.TextEdit", SetAt: now.Add(-365 * 24 * time.Hour)},
+	}
+	boosts := AppBoosts(assocs, []string{"Utilities/CotEditor.app"}, now)
+	if got := boosts.For(apps[3]); got != BoostConfigured+BoostRecent {
+		t.Errorf("boost of recently set Zed = %d", got)
+	}
+	if got := boosts.For(apps[1]); got != BoostConfigured {
+		t.Errorf("boost of TextEdit set a year ago = %d", got)
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"", []string{"Zed.app", "CotEditor.app", "TextEdit.app", "Visual Studio Code.app"}},
+		{"edit", []string{"CotEditor.app", "TextEdit.app"}},
+		// Matches on the bundle ID rank after matches on the name.
+		{"microsoft", []string{"Visual Studio Code.app"}},
+		{"e", []string{"CotEditor.app", "Zed.app", "TextEdit.app", "Visual Studio Code.app"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range RankApps(tt.pattern, apps, boosts) {
+			got = append(got, apps[r.Index].Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RankApps(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	got := FuzzyFilter(suffixCatalogue, suffixQuery("ts"), nil)
+	var texts []string
+	for _, s := range got {
+		texts = append(texts, s.Text)
+	}
+	if len(texts) < 2 || texts[0] != ".ts" || texts[1] != ".tsx" {
+		t.Errorf("FuzzyFilter(.ts) = %v, want .ts and .tsx first", texts)
+	}
+
+	boosted := FuzzyFilter(suffixCatalogue, ".j", func(s prompt.Suggest) int {
+		if s.Text == ".json" {
+			return 100
+		}
+		return 0
+	})
+	if boosted[0].Text != ".json" {
+		t.Errorf("FuzzyFilter(.j) with a boost for .json starts with %s", boosted[0].Text)
+	}
+}
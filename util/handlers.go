@@ -0,0 +1,260 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Handler is an application registered for a content type.
+type Handler struct {
+	BundleID string `json:"bundle_id" yaml:"bundle_id"`
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// Handlers describes who opens a content type: the default application per
+// role and every registered candidate.
+type Handlers struct {
+	ContentType string           `json:"content_type" yaml:"content_type"`
+	Source      string           `json:"source" yaml:"source"`
+	Defaults    map[Role]Handler `json:"defaults" yaml:"defaults"`
+	Candidates  []Handler        `json:"candidates" yaml:"candidates"`
+}
+
+// Sources of Handlers. Info.plist declarations list candidates only; the
+// defaults are unknown without LaunchServices.
+const (
+	HandlerSourceLaunchServices = "launchservices"
+	HandlerSourceInfoPlist      = "info.plist"
+)
+
+// DefaultRoles are the roles whose default handler LookupHandlers reports.
+var DefaultRoles = []Role{RoleAll, RoleViewer, RoleEditor, RoleShell}
+
+const handlersScript = `
+import CoreServices
+import Foundation
+
+let args = CommandLine.arguments
+guard args.count > 1 else {
+    print("Missing argument")
+    exit(1)
+}
+
+let fileType = args[1] as CFString
+let roles: [(String, LSRolesMask)] = [("all", .all), ("viewer", .viewer), ("editor", .editor), ("shell", .shell)]
+
+func firstURL(_ bundleId: String) -> String {
+    guard let urls = LSCopyApplicationURLsForBundleIdentifier(bundleId as CFString, nil) else { return "" }
+    return ((urls.takeRetainedValue() as NSArray).firstObject as? URL)?.absoluteString ?? ""
+}
+
+for (name, mask) in roles {
+    if let handler = LSCopyDefaultRoleHandlerForContentType(fileType, mask) {
+        let bundleId = handler.takeRetainedValue() as String
+        print("default\t\(name)\t\(bundleId)\t\(firstURL(bundleId))")
+    }
+}
+
+if let bundleIds = LSCopyAllRoleHandlersForContentType(fileType, LSRolesMask.all) {
+    for case let bundleId as String in bundleIds.takeRetainedValue() as NSArray {
+        print("candidate\t\t\(bundleId)\t\(firstURL(bundleId))")
+    }
+}
+`
+
+// ErrHandlerUnknown is returned by CurrentHandler when LaunchServices is
+// unavailable, so the default handler cannot be known.
+var ErrHandlerUnknown = errors.New("default handler unknown without LaunchServices")
+
+// CurrentHandler returns the default handler of suffix for role; a zero
+// Handler means there is none.
+func CurrentHandler(ctx context.Context, suffix Suffix, role Role) (Handler, error) {
+	if !HasCapability(ctx, CapLaunchServices) {
+		return Handler{}, ErrHandlerUnknown
+	}
+	contentType, err := ContentTypeForSuffix(ctx, suffix.String())
+	if err != nil {
+		return Handler{}, err
+	}
+	handlers, err := LookupHandlers(ctx, contentType)
+	if err != nil {
+		return Handler{}, err
+	}
+	if handlers.Source == HandlerSourceInfoPlist {
+		return Handler{}, ErrHandlerUnknown
+	}
+	return handlers.Defaults[role], nil
+}
+
+const schemeHandlerScript = `
+import CoreServices
+import Foundation
+
+let args = CommandLine.arguments
+guard args.count > 1 else {
+    print("Missing argument")
+    exit(1)
+}
+
+if let handler = LSCopyDefaultHandlerForURLScheme(args[1] as CFString) {
+    let bundleId = handler.takeRetainedValue() as String
+    var path = ""
+    if let urls = LSCopyApplicationURLsForBundleIdentifier(bundleId as CFString, nil),
+       let url = (urls.takeRetainedValue() as NSArray).firstObject as? URL {
+        path = url.absoluteString
+    }
+    print("default\tall\t\(bundleId)\t\(path)")
+}
+`
+
+// CurrentSchemeHandler returns the default handler of a URL scheme such as
+// "mailto"; a zero Handler means there is none.
+func CurrentSchemeHandler(ctx context.Context, scheme string) (Handler, error) {
+	if !HasCapability(ctx, CapLaunchServices) {
+		return Handler{}, ErrHandlerUnknown
+	}
+	out, err := runSwiftScript(ctx, schemeHandlerScript, scheme)
+	if err != nil {
+		if ctx.Err() == nil {
+			withdrawCapability(CapLaunchServices, fmt.Sprintf("LaunchServices query failed: %v", err))
+		}
+		return Handler{}, err
+	}
+	return parseHandlers(scheme, out).Defaults[RoleAll], nil
+}
+
+// LookupHandlers asks LaunchServices for the handlers of contentType. When
+// LaunchServices is unavailable it falls back to the candidates declared in
+// Info.plist files, without defaults.
+func LookupHandlers(ctx context.Context, contentType string) (*Handlers, error) {
+	if !HasCapability(ctx, CapLaunchServices) {
+		return lookupDeclaredHandlers(ctx, contentType, capabilityReason(CapLaunchServices))
+	}
+	start := time.Now()
+	out, err := runSwiftScript(ctx, handlersScript, contentType)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		withdrawCapability(CapLaunchServices, fmt.Sprintf("LaunchServices query failed: %v", err))
+		return lookupDeclaredHandlers(ctx, contentType, capabilityReason(CapLaunchServices))
+	}
+	h := parseHandlers(contentType, out)
+	Log.Info("looked up handlers", "content_type", contentType, "candidates", len(h.Candidates), "duration", time.Since(start))
+	return h, nil
+}
+
+func parseHandlers(contentType string, out []byte) *Handlers {
+	h := &Handlers{
+		ContentType: contentType,
+		Source:      HandlerSourceLaunchServices,
+		Defaults:    make(map[Role]Handler),
+		Candidates:  []Handler{},
+	}
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 || fields[2] == "" {
+			continue
+		}
+		handler := Handler{BundleID: fields[2]}
+		if fields[3] != "" {
+			handler.Path = strings.TrimSuffix(strings.TrimPrefix(fields[3], "file://"), "/")
+			if decoded, err := url.PathUnescape(handler.Path); err == nil {
+				handler.Path = decoded
+			}
+			handler.Name = filepath.Base(handler.Path)
+		}
+
+		switch fields[0] {
+		case "default":
+			h.Defaults[Role(fields[1])] = handler
+		case "candidate":
+			if !seen[handler.BundleID] {
+				seen[handler.BundleID] = true
+				h.Candidates = append(h.Candidates, handler)
+			}
+		}
+	}
+	return h
+}
+
+// Matches reports whether assoc's application is the current default for
+// its role.
+func (h *Handlers) Matches(assoc Association) bool {
+	current, ok := h.Defaults[assoc.EffectiveRole()]
+	return ok && strings.EqualFold(current.BundleID, assoc.BundleID)
+}
+
+func lookupDeclaredHandlers(ctx context.Context, contentType, reason string) (*Handlers, error) {
+	noteDegraded("handler lookup", "use Info.plist declarations; defaults unknown", reason)
+	candidates, err := declaredHandlers(ctx, "", contentType)
+	if err != nil {
+		return nil, err
+	}
+	return &Handlers{
+		ContentType: contentType,
+		Source:      HandlerSourceInfoPlist,
+		Defaults:    make(map[Role]Handler),
+		Candidates:  candidates,
+	}, nil
+}
+
+// declaredHandlers returns the installed applications whose Info.plist
+// declares a document type with the suffix's extension or with
+// contentType, sorted by name. Either may be empty.
+func declaredHandlers(ctx context.Context, suf, contentType string) ([]Handler, error) {
+	apps, err := GetCachedUtiMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.ToLower(strings.TrimPrefix(suf, "."))
+	lastExt := ext[strings.LastIndex(ext, ".")+1:]
+
+	candidates := []Handler{}
+	for _, app := range apps {
+		info, err := readInfoPlist(app.Path)
+		if err != nil {
+			Log.Debug("skipping Info.plist", "app", app.Path, "error", err)
+			continue
+		}
+		if declaresDocumentType(info, ext, lastExt, contentType) {
+			candidates = append(candidates, Handler{BundleID: app.Identifier, Name: app.Name, Path: app.Path})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Name < candidates[j].Name })
+	return candidates, nil
+}
+
+func declaresDocumentType(info map[string]any, ext, lastExt, contentType string) bool {
+	docTypes, _ := info["CFBundleDocumentTypes"].([]any)
+	for _, dt := range docTypes {
+		docType, ok := dt.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, e := range plistStrings(docType["CFBundleTypeExtensions"]) {
+			e = strings.ToLower(e)
+			if ext != "" && (e == ext || e == lastExt) {
+				return true
+			}
+		}
+		for _, t := range plistStrings(docType["LSItemContentTypes"]) {
+			if contentType != "" && strings.EqualFold(t, contentType) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package util
+
+import "testing"
+
+func Test_parseHandlers(t *testing.T) {
+	out := "default\tall\tcom.microsoft.VSCode\tfile:///Applications/Visual%20Studio%20Code.app/\n" +
+		"default\teditor\tcom.microsoft.VSCode\tfile:///Applications/Visual%20Studio%20Code.app/\n" +
+		"default\tviewer\tcom.apple.TextEdit\tfile:///System/Applications/TextEdit.app/\n" +
+		"candidate\t\tcom.microsoft.VSCode\tfile:///Applications/Visual%20Studio%20Code.app/\n" +
+		"candidate\t\tcom.apple.TextEdit\tfile:///System/Applications/TextEdit.app/\n" +
+		"candidate\t\tcom.microsoft.VSCode\tfile:///Applications/Visual%20Studio%20Code.app/\n" +
+		"candidate\t\tcom.example.Gone\t\n"
+
+	h := parseHandlers("net.daringfireball.markdown", []byte(out))
+	if got := h.Defaults[RoleAll]; got.Name != "Visual Studio Code.app" || got.Path != "/Applications/Visual Studio Code.app" {
+		t.Errorf("default all = %+v", got)
+	}
+	if len(h.Candidates) != 3 {
+		t.Errorf("got %d candidates, want 3 (deduplicated): %+v", len(h.Candidates), h.Candidates)
+	}
+
+	tests := []struct {
+		assoc Association
+		want  bool
+	}{
+		{Association{BundleID: "com.microsoft.vscode"}, true},
+		{Association{BundleID: "com.microsoft.VSCode", Role: RoleViewer}, false},
+		{Association{BundleID: "com.apple.TextEdit", Role: RoleViewer}, true},
+		{Association{BundleID: "com.apple.TextEdit", Role: RoleShell}, false},
+	}
+	for _, tt := range tests {
+		if got := h.Matches(tt.assoc); got != tt.want {
+			t.Errorf("Matches(%+v) = %v, want %v", tt.assoc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRunner stands in for execCommand. It records every command line and
+// answers with respond; without respond every command fails.
+type fakeRunner struct {
+	respond func(argv []string) (string, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeRunner) run(ctx context.Context, combined bool, name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+	f.mu.Lock()
+	f.calls = append(f.calls, strings.Join(argv, " "))
+	f.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.respond == nil {
+		return nil, fmt.Errorf("fake: unexpected command %q", strings.Join(argv, " "))
+	}
+	out, err := f.respond(argv)
+	return []byte(out), err
+}
+
+// commands returns the recorded command lines that start with name.
+func (f *fakeRunner) commands(name string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var list []string
+	for _, c := range f.calls {
+		if c == name || strings.HasPrefix(c, name+" ") {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// useFakeTools isolates a test from the machine: HOME is a temp dir, root
+// is the only scan root, only tools are found in PATH and subprocesses are
+// answered by respond.
+func useFakeTools(t *testing.T, root string, respond func(argv []string) (string, error), tools ...string) *fakeRunner {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	fake := &fakeRunner{respond: respond}
+	oldLookPath, oldExec, oldRoots := lookPath, execCommand, ScanRoots
+	lookPath = func(name string) (string, error) {
+		if slices.Contains(tools, name) {
+			return "/usr/local/bin/" + name, nil
+		}
+		return "", exec.ErrNotFound
+	}
+	execCommand = fake.run
+	ScanRoots = []string{root}
+	resetCapabilities()
+	t.Cleanup(func() {
+		lookPath, execCommand, ScanRoots = oldLookPath, oldExec, oldRoots
+		resetCapabilities()
+	})
+	return fake
+}
+
+// withoutTools makes every helper tool look uninstalled and scans root.
+func withoutTools(t *testing.T, root string) {
+	t.Helper()
+	useFakeTools(t, root, nil)
+}
+
+// writeTestApp creates root/name as an application bundle whose Info.plist
+// is a copy of plist.
+func writeTestApp(t *testing.T, root, name, plist string) {
+	t.Helper()
+	data, err := os.ReadFile(plist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, name, "Contents")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Info.plist"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
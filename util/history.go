@@ -0,0 +1,122 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Limits of the history: lines kept per prompt, and recent apps and
+// suffixes kept for ranking.
+const (
+	promptHistoryLimit = 100
+	recentLimit        = 20
+)
+
+// History is what interactive mode remembers across sessions: the lines
+// entered at each prompt and the applications and suffixes used recently.
+type History struct {
+	Prompts  map[string][]string `json:"prompts,omitempty"`  // oldest first
+	Apps     []RecentApp         `json:"apps,omitempty"`     // most recent first
+	Suffixes []Suffix            `json:"suffixes,omitempty"` // most recent first
+}
+
+// RecentApp is an application set in an earlier session.
+type RecentApp struct {
+	Name     string    `json:"name"`
+	BundleID string    `json:"bundle_id"`
+	UsedAt   time.Time `json:"used_at"`
+}
+
+// DataDir returns ~/.dutis, where dutis keeps its state next to the
+// default config, creating it if needed.
+func DataDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(homeDir, ".dutis")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func historyPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.json"), nil
+}
+
+// LoadHistory reads the history, which is empty before the first session.
+func LoadHistory() (*History, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	h := &History{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Save writes the history.
+func (h *History) Save() error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// Prompt returns the lines entered at the prompt name, oldest first.
+func (h *History) Prompt(name string) []string {
+	return h.Prompts[name]
+}
+
+// AddPrompt appends line to the history of the prompt name, unless it
+// repeats the last line.
+func (h *History) AddPrompt(name, line string) {
+	if line == "" {
+		return
+	}
+	lines := h.Prompts[name]
+	if len(lines) > 0 && lines[len(lines)-1] == line {
+		return
+	}
+	if h.Prompts == nil {
+		h.Prompts = make(map[string][]string)
+	}
+	lines = append(lines, line)
+	h.Prompts[name] = lines[max(len(lines)-promptHistoryLimit, 0):]
+}
+
+// UseApp moves app to the front of the recent applications.
+func (h *History) UseApp(app Uti, now time.Time) {
+	apps := slices.DeleteFunc(h.Apps, func(r RecentApp) bool { return r.BundleID == app.Identifier })
+	apps = append([]RecentApp{{Name: app.Name, BundleID: app.Identifier, UsedAt: now.UTC().Truncate(time.Second)}}, apps...)
+	h.Apps = apps[:min(len(apps), recentLimit)]
+}
+
+// UseSuffixes moves suffixes to the front of the recent suffixes.
+func (h *History) UseSuffixes(suffixes []Suffix) {
+	rest := slices.DeleteFunc(h.Suffixes, func(s Suffix) bool { return slices.Contains(suffixes, s) })
+	all := append(slices.Clone(suffixes), rest...)
+	h.Suffixes = all[:min(len(all), recentLimit)]
+}
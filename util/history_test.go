@@ -0,0 +1,91 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	h, err := LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Apps) != 0 || len(h.Prompt("suffix")) != 0 {
+		t.Fatalf("LoadHistory() without a file = %+v, want it empty", h)
+	}
+
+	h.AddPrompt("suffix", ".go .rs")
+	h.AddPrompt("suffix", ".go .rs")
+	h.AddPrompt("suffix", "")
+	h.AddPrompt("suffix", "code")
+	h.AddPrompt("app", "Zed.app")
+
+	now := time.Date(2024, 11, 7, 20, 0, 0, 0, time.UTC)
+	h.UseApp(Uti{Name: "Zed.app", Identifier: "dev.zed.Zed"}, now.Add(-time.Hour))
+	h.UseApp(Uti{Name: "TextEdit.app", Identifier: "com.apple.TextEdit"}, now)
+	h.UseApp(Uti{Name: "Zed.app", Identifier: "dev.zed.Zed"}, now)
+	h.UseSuffixes([]Suffix{".go", ".rs"})
+	h.UseSuffixes([]Suffix{".md", ".go"})
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err = LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.Prompt("suffix"), []string{".go .rs", "code"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("suffix prompt history = %v, want %v", got, want)
+	}
+	want := []RecentApp{
+		{Name: "Zed.app", BundleID: "dev.zed.Zed", UsedAt: now},
+		{Name: "TextEdit.app", BundleID: "com.apple.TextEdit", UsedAt: now},
+	}
+	if !reflect.DeepEqual(h.Apps, want) {
+		t.Errorf("recent apps = %+v, want %+v", h.Apps, want)
+	}
+	if got, want := h.Suffixes, []Suffix{".md", ".go", ".rs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recent suffixes = %v, want %v", got, want)
+	}
+
+	boosts := make(Boosts)
+	boosts.AddRecent(h.Apps, now.Add(10*24*time.Hour))
+	if got := boosts.For(Uti{Name: "Zed.app", Identifier: "dev.zed.Zed"}); got != BoostRecent/2 {
+		t.Errorf("boost of Zed used 10 days ago = %d", got)
+	}
+}
+
+func TestHistoryLimits(t *testing.T) {
+	h := &History{}
+	for i := range promptHistoryLimit + 5 {
+		h.AddPrompt("app", fmt.Sprint(i))
+		h.UseApp(Uti{Name: fmt.Sprint(i), Identifier: fmt.Sprint("id", i)}, time.Now())
+		h.UseSuffixes([]Suffix{Suffix(fmt.Sprint(".s", i))})
+	}
+	if lines := h.Prompt("app"); len(lines) != promptHistoryLimit || lines[0] != "5" {
+		t.Errorf("prompt history keeps %d lines from %q", len(lines), lines[0])
+	}
+	if len(h.Apps) != recentLimit || h.Apps[0].Name != fmt.Sprint(promptHistoryLimit+4) {
+		t.Errorf("recent apps keep %d, newest %q", len(h.Apps), h.Apps[0].Name)
+	}
+	if len(h.Suffixes) != recentLimit {
+		t.Errorf("recent suffixes keep %d", len(h.Suffixes))
+	}
+}
+
+func TestHistoryCorrupt(t *testing.T) {
+	writeTestConfig(t, "")
+	path, err := historyPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHistory(); err == nil {
+		t.Error("LoadHistory() of a corrupt file did not fail")
+	}
+}
@@ -0,0 +1,291 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JournalCommand is recorded as the command of new journal entries; main
+// sets it to the command being run, e.g. "dutis set".
+var JournalCommand = "dutis"
+
+// JournalEntry records one change of the handler of a suffix, of its
+// config entry, or both, with what was there before so it can be undone.
+type JournalEntry struct {
+	ID      int       `json:"id" yaml:"id"`
+	Time    time.Time `json:"time" yaml:"time"`
+	Command string    `json:"command" yaml:"command"`
+	Suffix  Suffix    `json:"suffix" yaml:"suffix"`
+	// Kind is set for a UTI or URL scheme, whose name is then in Suffix.
+	Kind TargetKind `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Role Role       `json:"role" yaml:"role"`
+	// Previous is the default handler before the change, nil if unknown;
+	// a zero Handler means there was none. New is nil when the change did
+	// not touch the system.
+	Previous *Handler `json:"previous,omitempty" yaml:"previous,omitempty"`
+	New      *Handler `json:"new,omitempty" yaml:"new,omitempty"`
+	// Config reports whether config.yaml changed, from PreviousConfig to
+	// NewConfig; nil means no entry.
+	Config         bool         `json:"config,omitempty" yaml:"config,omitempty"`
+	PreviousConfig *Association `json:"previous_config,omitempty" yaml:"previous_config,omitempty"`
+	NewConfig      *Association `json:"new_config,omitempty" yaml:"new_config,omitempty"`
+	// Undoes is the ID of the entry this one reverted.
+	Undoes int `json:"undoes,omitempty" yaml:"undoes,omitempty"`
+}
+
+// Target returns what the entry changed the handler of.
+func (e JournalEntry) Target() Target {
+	if e.Kind == "" {
+		return Target{Kind: TargetSuffix, Name: string(e.Suffix)}
+	}
+	return Target{Kind: e.Kind, Name: string(e.Suffix)}
+}
+
+func journalPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "journal.jsonl"), nil
+}
+
+// AppendJournal adds entries to the journal, numbering them and filling in
+// the time and command, and returns them as written.
+func AppendJournal(entries ...JournalEntry) ([]JournalEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	path, err := journalPath()
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(path+".lock", configLockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := repairJournalTail(path); err != nil {
+		return nil, err
+	}
+	existing, err := readJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	id := 0
+	if len(existing) > 0 {
+		id = existing[len(existing)-1].ID
+	}
+
+	var buf bytes.Buffer
+	now := time.Now().UTC().Truncate(time.Second)
+	written := make([]JournalEntry, len(entries))
+	for i, e := range entries {
+		id++
+		e.ID = id
+		if e.Time.IsZero() {
+			e.Time = now
+		}
+		if e.Command == "" {
+			e.Command = JournalCommand
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(append(line, '\n'))
+		written[i] = e
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return written, f.Close()
+}
+
+// repairJournalTail makes path end in a newline before entries are appended
+// to it, so they don't run into a last line left without one: a torn line
+// is cut off, a complete one gets its newline.
+func repairJournalTail(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+	start := bytes.LastIndexByte(data, '\n') + 1
+	if !json.Valid(data[start:]) {
+		Log.Warn("removing torn journal line", "path", path, "line", bytes.Count(data, []byte("\n"))+1)
+		return os.Truncate(path, int64(start))
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte("\n")); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// recordJournal appends entries, logging rather than failing the change
+// they describe when the journal cannot be written.
+func recordJournal(entries ...JournalEntry) []JournalEntry {
+	written, err := AppendJournal(entries...)
+	if err != nil {
+		Log.Warn("writing journal", "error", err)
+	}
+	return written
+}
+
+// ReadJournal returns every journal entry, oldest first.
+func ReadJournal() ([]JournalEntry, error) {
+	path, err := journalPath()
+	if err != nil {
+		return nil, err
+	}
+	return readJournal(path)
+}
+
+// readJournal parses path. A torn last line, left by a write that was cut
+// short, is skipped.
+func readJournal(path string) ([]JournalEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []JournalEntry
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if i == len(lines)-1 {
+				Log.Warn("skipping torn journal line", "path", path, "line", i+1)
+				break
+			}
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Undoable returns the entries that can still be undone, newest first:
+// neither undo entries themselves nor entries an undo already reverted.
+func Undoable(entries []JournalEntry) []JournalEntry {
+	undone := make(map[int]bool)
+	for _, e := range entries {
+		if e.Undoes != 0 {
+			undone[e.Undoes] = true
+		}
+	}
+	var undoable []JournalEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.Undoes == 0 && !undone[e.ID] {
+			undoable = append(undoable, e)
+		}
+	}
+	return undoable
+}
+
+// OriginalHandler returns the handler suffix had before dutis first
+// changed it, from the first journal entry that touched the system. It
+// reports false when dutis never changed it; the handler is nil when it
+// was not known then and a zero Handler when there was none.
+func OriginalHandler(entries []JournalEntry, suffix Suffix) (*Handler, bool) {
+	for _, e := range entries {
+		if e.Suffix == suffix && e.New != nil {
+			return e.Previous, true
+		}
+	}
+	return nil, false
+}
+
+// Statuses of an UndoResult.
+const (
+	UndoStatusUndone = "undone"
+	UndoStatusFailed = "failed"
+)
+
+// UndoResult is the outcome of undoing one journal entry.
+type UndoResult struct {
+	ID       int        `json:"id" yaml:"id"`
+	Suffix   Suffix     `json:"suffix" yaml:"suffix"`
+	Kind     TargetKind `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Role     Role       `json:"role" yaml:"role"`
+	Restored *Handler   `json:"restored,omitempty" yaml:"restored,omitempty"`
+	Config   bool       `json:"config" yaml:"config"`
+	Status   string     `json:"status" yaml:"status"`
+	Error    string     `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Undo reverts entries in the given order, newest first as Undoable
+// returns them: the default handler goes back to the previous one and the
+// config entry, when the change touched config.yaml, to what it was. When
+// the previous handler is unknown only the config entry is restored. Each
+// revert is recorded as a journal entry of its own.
+func Undo(ctx context.Context, config *Config, entries []JournalEntry) []UndoResult {
+	var results []UndoResult
+	var reverts []JournalEntry
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		res := UndoResult{ID: e.ID, Suffix: e.Suffix, Kind: e.Kind, Role: e.Role, Status: UndoStatusFailed}
+		revert := JournalEntry{Suffix: e.Suffix, Kind: e.Kind, Role: e.Role, Undoes: e.ID}
+		if e.New != nil {
+			switch {
+			case e.Previous == nil:
+				res.Error = "the previous handler is unknown, the handler was left at " + e.New.BundleID
+			case e.Previous.BundleID == "":
+				res.Error = "there was no default handler before, the handler was left at " + e.New.BundleID
+			default:
+				if err := (SystemHandlers{}).Set(ctx, e.Target(), e.Previous.BundleID, e.Role); err != nil {
+					// Keep the config as well, so the undo can be retried.
+					res.Error = err.Error()
+					results = append(results, res)
+					continue
+				}
+				res.Restored = e.Previous
+				revert.Previous, revert.New = e.New, e.Previous
+			}
+		}
+		if e.Config {
+			if err := config.RestoreAssociation(e.Suffix, e.PreviousConfig); err != nil {
+				res.Error = fmt.Sprintf("could not restore the config entry: %v", err)
+			} else {
+				res.Config = true
+				revert.Config = true
+				revert.PreviousConfig, revert.NewConfig = e.NewConfig, e.PreviousConfig
+			}
+		}
+		if res.Restored != nil || res.Config {
+			res.Status = UndoStatusUndone
+			reverts = append(reverts, revert)
+		}
+		results = append(results, res)
+	}
+	recordJournal(reverts...)
+	return results
+}
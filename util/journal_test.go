@@ -0,0 +1,214 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJournalAppendAndRead(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if entries, err := ReadJournal(); err != nil || entries != nil {
+		t.Fatalf("ReadJournal() without a journal = %v, %v", entries, err)
+	}
+
+	JournalCommand = "dutis set"
+	t.Cleanup(func() { JournalCommand = "dutis" })
+	written, err := AppendJournal(
+		JournalEntry{Suffix: ".md", Role: RoleAll, New: &Handler{BundleID: "dev.zed.Zed"}},
+		JournalEntry{Suffix: ".go", Role: RoleEditor, Previous: &Handler{}, New: &Handler{BundleID: "dev.zed.Zed"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendJournal(JournalEntry{Suffix: ".md", Command: "dutis undo", Undoes: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || !reflect.DeepEqual(entries[:2], written) {
+		t.Fatalf("ReadJournal() = %+v, want what was written", entries)
+	}
+	for i, e := range entries {
+		if e.ID != i+1 || e.Time.IsZero() {
+			t.Errorf("entry %d has ID %d, time %v", i, e.ID, e.Time)
+		}
+	}
+	if entries[0].Command != "dutis set" || entries[2].Command != "dutis undo" {
+		t.Errorf("commands %q and %q", entries[0].Command, entries[2].Command)
+	}
+	if entries[1].Previous == nil || entries[1].Previous.BundleID != "" || entries[0].Previous != nil {
+		t.Error("an unknown previous handler must stay distinct from none")
+	}
+
+	if got := Undoable(entries); len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("Undoable() = %+v, want only entry 2", got)
+	}
+}
+
+func TestOriginalHandler(t *testing.T) {
+	typora := &Handler{BundleID: "abnerworks.Typora"}
+	zed := &Handler{BundleID: "dev.zed.Zed"}
+	entries := []JournalEntry{
+		{ID: 1, Suffix: ".md", Config: true},
+		{ID: 2, Suffix: ".md", Previous: typora, New: zed},
+		{ID: 3, Suffix: ".md", Previous: zed, New: &Handler{BundleID: "com.microsoft.VSCode"}},
+		{ID: 4, Suffix: ".go", New: zed},
+		{ID: 5, Suffix: ".rs", Previous: &Handler{}, New: zed},
+	}
+	tests := []struct {
+		suffix  Suffix
+		want    *Handler
+		touched bool
+	}{
+		{".md", typora, true},
+		{".go", nil, true},
+		{".rs", &Handler{}, true},
+		{".txt", nil, false},
+	}
+	for _, tt := range tests {
+		got, touched := OriginalHandler(entries, tt.suffix)
+		if !reflect.DeepEqual(got, tt.want) || touched != tt.touched {
+			t.Errorf("OriginalHandler(%s) = %+v, %v, want %+v, %v", tt.suffix, got, touched, tt.want, tt.touched)
+		}
+	}
+}
+
+func TestJournalDamaged(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if _, err := AppendJournal(JournalEntry{Suffix: ".md"}); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := journalPath()
+	data, _ := os.ReadFile(path)
+
+	// A write cut short leaves a partial last line, which is skipped.
+	if err := os.WriteFile(path, append(data, `{"id":2,"suff`...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := ReadJournal(); err != nil || len(entries) != 1 {
+		t.Errorf("ReadJournal() with a torn line = %v, %v", entries, err)
+	}
+
+	// Appending drops the torn line instead of continuing it.
+	if _, err := AppendJournal(JournalEntry{Suffix: ".go"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := ReadJournal(); err != nil || len(entries) != 2 || entries[1].Suffix != ".go" || entries[1].ID != 2 {
+		t.Errorf("ReadJournal() after appending to a torn line = %v, %v", entries, err)
+	}
+
+	// A complete last line without its newline is kept.
+	data, _ = os.ReadFile(path)
+	if err := os.WriteFile(path, bytes.TrimSuffix(data, []byte("\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AppendJournal(JournalEntry{Suffix: ".rs"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := ReadJournal(); err != nil || len(entries) != 3 || entries[1].Suffix != ".go" || entries[2].ID != 3 {
+		t.Errorf("ReadJournal() after appending to an unterminated line = %v, %v", entries, err)
+	}
+	data, _ = os.ReadFile(path)
+
+	if err := os.WriteFile(path, append([]byte("garbage\n"), data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadJournal(); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("ReadJournal() with a corrupt line: %v, want an error naming line 1", err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	fake := useFakeTools(t, t.TempDir(), func(argv []string) (string, error) {
+		if len(argv) > 2 && argv[2] == "com.example.Broken" {
+			return "", errors.New("exit status 1")
+		}
+		return "", nil
+	}, CapDuti)
+	writeTestConfig(t, `version: "1.1"
+associations:
+  .md:
+    suffix: .md
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+    set_at: 2024-11-07T20:00:00Z
+  .go:
+    suffix: .go
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+    set_at: 2024-11-07T20:00:00Z
+`)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	typora := &Association{Suffix: ".md", Application: "Typora.app", BundleID: "abnerworks.Typora"}
+	zed := &Association{Suffix: ".md", Application: "Zed.app", BundleID: "dev.zed.Zed"}
+	entries, err := AppendJournal(
+		// .md was Typora, then set to Zed.
+		JournalEntry{Suffix: ".md", Role: RoleAll, Previous: &Handler{BundleID: "abnerworks.Typora", Name: "Typora.app"},
+			New: &Handler{BundleID: "dev.zed.Zed"}, Config: true, PreviousConfig: typora, NewConfig: zed},
+		// .go had no config entry and an unknown handler.
+		JournalEntry{Suffix: ".go", Role: RoleAll, New: &Handler{BundleID: "dev.zed.Zed"}, Config: true},
+		// .txt only lost its config entry.
+		JournalEntry{Suffix: ".txt", Role: RoleEditor, Config: true, PreviousConfig: &Association{Suffix: ".txt", Application: "TextEdit.app", BundleID: "com.apple.TextEdit", Role: RoleEditor}},
+		JournalEntry{Suffix: ".rs", Role: RoleAll, Previous: &Handler{BundleID: "com.example.Broken"}, New: &Handler{BundleID: "dev.zed.Zed"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := Undo(context.Background(), config, Undoable(entries))
+	var got []string
+	for _, r := range results {
+		got = append(got, string(r.Suffix)+" "+r.Status)
+	}
+	want := []string{".rs failed", ".txt undone", ".go undone", ".md undone"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Undo() = %v, want %v", got, want)
+	}
+	if calls := fake.commands("duti -s"); !reflect.DeepEqual(calls, []string{"duti -s com.example.Broken .rs all", "duti -s abnerworks.Typora .md all"}) {
+		t.Errorf("ran %v", calls)
+	}
+
+	reloaded, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := reloaded.GetAssociation(".md"); a.BundleID != "abnerworks.Typora" {
+		t.Errorf(".md config entry = %+v, want Typora back", a)
+	}
+	if a, _ := reloaded.GetAssociation(".txt"); a.BundleID != "com.apple.TextEdit" || a.Role != RoleEditor {
+		t.Errorf(".txt config entry = %+v, want it restored", a)
+	}
+	if _, ok := reloaded.GetAssociation(".go"); ok {
+		t.Error(".go config entry was kept, want it removed even though the handler is unknown")
+	}
+	if results[2].Restored != nil || !strings.Contains(results[2].Error, "unknown") {
+		t.Errorf(".go result = %+v, want only the config restored", results[2])
+	}
+
+	// The reverts are journaled, so only the failed change remains undoable.
+	all, err := ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 7 || all[4].Undoes != 3 || all[5].Undoes != 2 || all[5].New != nil || all[6].Undoes != 1 || all[6].New.BundleID != "abnerworks.Typora" {
+		t.Errorf("journal after undo = %+v", all[4:])
+	}
+	var left []Suffix
+	for _, e := range Undoable(all) {
+		left = append(left, e.Suffix)
+	}
+	if !reflect.DeepEqual(left, []Suffix{".rs"}) {
+		t.Errorf("undoable after undo = %v", left)
+	}
+}
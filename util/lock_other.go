@@ -0,0 +1,10 @@
+//go:build !unix
+
+package util
+
+import "time"
+
+// lockFile is a no-op where advisory file locks are unavailable.
+func lockFile(path string, timeout time.Duration) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,352 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the config schema version written by this build.
+const CurrentConfigVersion = "1.1"
+
+// Migration upgrades a parsed config document from one schema version to the next.
+type Migration struct {
+	From        string
+	To          string
+	Description string
+	Upgrade     func(root *yaml.Node) error
+}
+
+// MigrationResult describes what `dutis config migrate` did (or would do).
+type MigrationResult struct {
+	Path       string
+	From       string
+	To         string
+	Applied    []Migration
+	Before     []byte
+	After      []byte
+	BackupPath string
+}
+
+// NewerConfigError is returned for config files written by a newer dutis.
+type NewerConfigError struct {
+	Version string
+}
+
+func (e *NewerConfigError) Error() string {
+	return fmt.Sprintf("config version %s is newer than this dutis supports (%s), please upgrade dutis",
+		e.Version, CurrentConfigVersion)
+}
+
+// migrations is keyed on the version a step upgrades from.
+var migrations = make(map[string]Migration)
+
+func registerMigration(m Migration) {
+	if _, exists := migrations[m.From]; exists {
+		panic("duplicate config migration from version " + strconv.Quote(m.From))
+	}
+	migrations[m.From] = m
+}
+
+func init() {
+	registerMigration(Migration{
+		From:        "",
+		To:          "1.0",
+		Description: "add schema version to unversioned config",
+		Upgrade: func(root *yaml.Node) error {
+			return nil
+		},
+	})
+	registerMigration(Migration{
+		From:        "1.0",
+		To:          "1.1",
+		Description: "canonicalize suffix keys and merge duplicates",
+		Upgrade:     canonicalizeSuffixKeys,
+	})
+}
+
+// canonicalizeSuffixKeys rewrites association keys such as "txt" or ".TXT"
+// to their canonical form. When several keys collapse into one, the entry
+// with the latest set_at wins. Keys that cannot be parsed are left for
+// `dutis config validate` to report.
+func canonicalizeSuffixKeys(root *yaml.Node) error {
+	assocs := mappingValue(root, "associations")
+	if assocs == nil || assocs.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var content []*yaml.Node
+	index := make(map[Suffix]int) // position of the kept value node in content
+	for i := 0; i+1 < len(assocs.Content); i += 2 {
+		key, entry := assocs.Content[i], assocs.Content[i+1]
+		suffix, err := ParseSuffix(key.Value)
+		if err != nil {
+			content = append(content, key, entry)
+			continue
+		}
+		key.Value = suffix.String()
+		if entry.Kind == yaml.MappingNode {
+			if s := mappingValue(entry, "suffix"); s != nil {
+				s.Value = suffix.String()
+			}
+		}
+
+		if pos, ok := index[suffix]; ok {
+			if associationSetAt(entry).After(associationSetAt(content[pos])) {
+				content[pos-1], content[pos] = key, entry
+			}
+			continue
+		}
+		content = append(content, key, entry)
+		index[suffix] = len(content) - 1
+	}
+	assocs.Content = content
+	return nil
+}
+
+func associationSetAt(entry *yaml.Node) time.Time {
+	if entry.Kind != yaml.MappingNode {
+		return time.Time{}
+	}
+	if v := mappingValue(entry, "set_at"); v != nil {
+		t, _ := time.Parse(time.RFC3339Nano, v.Value)
+		return t
+	}
+	return time.Time{}
+}
+
+// parseConfigVersion splits "major[.minor[.patch]]" into comparable major
+// and minor parts; a patch level is accepted and ignored.
+// An empty version is older than every released schema.
+func parseConfigVersion(v string) ([2]int, error) {
+	var parts [2]int
+	if v == "" {
+		return [2]int{-1, 0}, nil
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) > 3 {
+		return parts, fmt.Errorf("invalid config version %q", v)
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, fmt.Errorf("invalid config version %q", v)
+		}
+		if i < len(parts) {
+			parts[i] = n
+		}
+	}
+	return parts, nil
+}
+
+// normalizeConfigVersion returns v as the "major.minor" the migrations are
+// keyed on, so "1" and "1.0.0" both become "1.0".
+func normalizeConfigVersion(v string) (string, error) {
+	parts, err := parseConfigVersion(v)
+	if err != nil || v == "" {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d", parts[0], parts[1]), nil
+}
+
+func compareConfigVersions(a, b string) (int, error) {
+	pa, err := parseConfigVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parseConfigVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// documentRoot returns the top-level mapping of a config document, creating
+// it when the document is empty.
+func documentRoot(doc *yaml.Node) (*yaml.Node, error) {
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	if doc.Kind != yaml.DocumentNode {
+		return nil, fmt.Errorf("config is not a YAML document")
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config root must be a mapping, line %d", root.Line)
+	}
+	return root, nil
+}
+
+// migrateDocument upgrades doc in place to CurrentConfigVersion and returns
+// the steps it applied.
+func migrateDocument(doc *yaml.Node) ([]Migration, error) {
+	root, err := documentRoot(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	version := ""
+	if v := mappingValue(root, "version"); v != nil {
+		version = v.Value
+	}
+
+	cmp, err := compareConfigVersions(version, CurrentConfigVersion)
+	if err != nil {
+		return nil, err
+	}
+	if cmp > 0 {
+		return nil, &NewerConfigError{Version: version}
+	}
+
+	raw := version
+	if version, err = normalizeConfigVersion(version); err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for version != CurrentConfigVersion {
+		m, ok := migrations[version]
+		if !ok {
+			return applied, fmt.Errorf("no migration registered from config version %q", version)
+		}
+		if err := m.Upgrade(root); err != nil {
+			return applied, fmt.Errorf("migrating config %q → %q: %w", m.From, m.To, err)
+		}
+		setMappingScalar(root, "version", m.To)
+		applied = append(applied, m)
+		version = m.To
+	}
+	if len(applied) == 0 && raw != CurrentConfigVersion {
+		// Only the spelling differs, e.g. "1.1.0".
+		setMappingScalar(root, "version", CurrentConfigVersion)
+	}
+	return applied, nil
+}
+
+// migrateSource parses data and upgrades it to CurrentConfigVersion. src is
+// data with the migration made on its lines, so comments and formatting
+// survive, and doc is parsed from it; when the lines cannot be edited src is
+// nil and doc has to be re-encoded.
+func migrateSource(data []byte) (doc *yaml.Node, src []byte, applied []Migration, err error) {
+	doc = new(yaml.Node)
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, nil, nil, err
+	}
+	before := snapshotDocument(doc)
+	if applied, err = migrateDocument(doc); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(applied) == 0 {
+		return doc, data, nil, nil
+	}
+
+	if spliced, ok := spliceMigration(data, doc, before); ok {
+		// Only trust the edited lines if they read back as the migrated tree.
+		var redone yaml.Node
+		if yaml.Unmarshal(spliced, &redone) == nil && sameConfig(doc, &redone) {
+			return &redone, spliced, applied, nil
+		}
+	}
+	return doc, nil, applied, nil
+}
+
+func sameConfig(a, b *yaml.Node) bool {
+	var ca, cb Config
+	if a.Decode(&ca) != nil || b.Decode(&cb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(ca, cb)
+}
+
+// MigrateConfig upgrades the config file to CurrentConfigVersion. With dryRun
+// the file is left untouched; otherwise the original becomes backup 1.
+func MigrateConfig(dryRun bool) (*MigrationResult, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	before, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		Version string `yaml:"version"`
+	}
+	_ = yaml.Unmarshal(before, &header) // migrateSource reports a broken file
+
+	result := &MigrationResult{Path: configPath, Before: before, From: header.Version}
+	doc, src, applied, err := migrateSource(before)
+	if err != nil {
+		return nil, err
+	}
+	result.Applied = applied
+	result.To = CurrentConfigVersion
+	if len(result.Applied) == 0 {
+		result.After = before
+		return result, nil
+	}
+
+	result.After = src
+	if result.After == nil {
+		if result.After, err = yaml.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if err := writeConfigFile(configPath, result.After); err != nil {
+		return nil, err
+	}
+	result.BackupPath = configBackupPath(configPath, 1)
+	return result, nil
+}
+
+// mappingValue returns the value node stored under key in a mapping node.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingScalar sets key to a string scalar, appending the key if missing.
+func setMappingScalar(mapping *yaml.Node, key, value string) {
+	if v := mappingValue(mapping, key); v != nil {
+		v.Kind = yaml.ScalarNode
+		v.Tag = "!!str"
+		v.Value = value
+		v.Style = yaml.DoubleQuotedStyle
+		v.Content = nil
+		return
+	}
+	mapping.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: yaml.DoubleQuotedStyle},
+	}, mapping.Content...)
+}
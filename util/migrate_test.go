@@ -0,0 +1,152 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func Test_migrateDocument(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantApplied int
+		wantErr     bool
+		wantNewer   bool
+	}{
+		{"unversioned", "associations: {}\n", 2, false, false},
+		{"empty", "", 2, false, false},
+		{"1.0", "version: \"1.0\"\n", 1, false, false},
+		{"current", "version: \"1.1\"\n", 0, false, false},
+		{"1 unquoted", "version: 1\n", 1, false, false},
+		{"1.0 unquoted", "version: 1.0\n", 1, false, false},
+		{"1.1.0", "version: \"1.1.0\"\n", 0, false, false},
+		{"1.0.2", "version: \"1.0.2\"\n", 1, false, false},
+		{"too many parts", "version: \"1.1.0.0\"\n", 0, true, false},
+		{"newer", "version: \"99.0\"\n", 0, true, true},
+		{"invalid", "version: banana\n", 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.input), &doc); err != nil {
+				t.Fatal(err)
+			}
+			applied, err := migrateDocument(&doc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrateDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var newer *NewerConfigError
+			if errors.As(err, &newer) != tt.wantNewer {
+				t.Errorf("migrateDocument() error = %v, want NewerConfigError %v", err, tt.wantNewer)
+			}
+			if len(applied) != tt.wantApplied {
+				t.Errorf("migrateDocument() applied %d steps, want %d", len(applied), tt.wantApplied)
+			}
+			if err == nil {
+				root, _ := documentRoot(&doc)
+				if v := mappingValue(root, "version"); v == nil || v.Value != CurrentConfigVersion {
+					t.Errorf("version after migration = %v, want %s", v, CurrentConfigVersion)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	configPath := filepath.Join(home, ".dutis", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	original := "associations:\n    .txt:\n        suffix: .txt\n"
+	if err := os.WriteFile(configPath, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MigrateConfig(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != original {
+		t.Errorf("dry run modified config:\n%s", data)
+	}
+	if !strings.Contains(string(result.After), `version: "`+CurrentConfigVersion+`"`) {
+		t.Errorf("migrated config missing version:\n%s", result.After)
+	}
+
+	result, err = MigrateConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup, err := os.ReadFile(result.BackupPath); err != nil || string(backup) != original {
+		t.Errorf("backup = %q, %v; want original contents", backup, err)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != string(result.After) {
+		t.Errorf("config not rewritten:\n%s", data)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	diff := LineDiff("a\nb\nc\n", "a\nc\nd\n")
+	want := []DiffLine{
+		{DiffEqual, "a"},
+		{DiffDelete, "b"},
+		{DiffEqual, "c"},
+		{DiffInsert, "d"},
+	}
+	if len(diff) != len(want) {
+		t.Fatalf("LineDiff() = %v, want %v", diff, want)
+	}
+	for i := range want {
+		if diff[i] != want[i] {
+			t.Errorf("LineDiff()[%d] = %v, want %v", i, diff[i], want[i])
+		}
+	}
+}
+
+func Test_canonicalizeSuffixKeys(t *testing.T) {
+	input := `version: "1.0"
+associations:
+    txt:
+        suffix: txt
+        bundle_id: com.apple.TextEdit
+        set_at: 2024-11-01T10:00:00Z
+    .TXT:
+        suffix: .TXT
+        bundle_id: com.microsoft.VSCode
+        set_at: 2024-11-07T10:00:00Z
+    .txt:
+        suffix: .txt
+        bundle_id: com.sublimetext.4
+        set_at: 2024-11-03T10:00:00Z
+    TAR.GZ:
+        suffix: TAR.GZ
+        bundle_id: com.apple.archiveutility
+`
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(input), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrateDocument(&doc); err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	if err := doc.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Associations) != 2 {
+		t.Fatalf("got %d associations, want 2: %v", len(config.Associations), config.Associations)
+	}
+	if got := config.Associations[".txt"]; got.BundleID != "com.microsoft.VSCode" || got.Suffix != ".txt" {
+		t.Errorf(".txt = %+v, want newest entry com.microsoft.VSCode", got)
+	}
+	if got := config.Associations[".tar.gz"]; got.Suffix != ".tar.gz" {
+		t.Errorf(".tar.gz = %+v", got)
+	}
+}
@@ -0,0 +1,8 @@
+package util
+
+import "log/slog"
+
+// Log receives the diagnostics of this package: subprocess traces at debug
+// level, cache and scan timings at info level. It discards everything until
+// the CLI configures it from -v and --log-file.
+var Log = slog.New(slog.DiscardHandler)
@@ -0,0 +1,411 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ParsePlist decodes an XML or binary property list. Values are returned as
+// map[string]any, []any, string, int64, float64, bool, time.Time or []byte.
+func ParsePlist(data []byte) (any, error) {
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		return parseBinaryPlist(data)
+	}
+	return parseXMLPlist(data)
+}
+
+// ReadPlist reads and decodes the property list at path.
+func ReadPlist(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := ParsePlist(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return v, nil
+}
+
+// readInfoPlist returns the Info.plist dictionary of the bundle at appPath.
+func readInfoPlist(appPath string) (map[string]any, error) {
+	v, err := ReadPlist(filepath.Join(appPath, "Contents", "Info.plist"))
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: Info.plist is not a dictionary", appPath)
+	}
+	return dict, nil
+}
+
+// plistStrings returns v as a list of strings, skipping other values.
+func plistStrings(v any) []string {
+	list, _ := v.([]any)
+	var out []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// plistTimeEpoch is the reference date of binary plist dates.
+var plistTimeEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func parseXMLPlist(data []byte) (any, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, errors.New("plist: no value found")
+			}
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local == "plist" {
+			continue
+		}
+		return decodeXMLValue(d, start)
+	}
+}
+
+func decodeXMLValue(d *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := make(map[string]any)
+		for {
+			key, end, err := nextXMLElement(d)
+			if err != nil {
+				return nil, err
+			}
+			if end {
+				return dict, nil
+			}
+			if key.Name.Local != "key" {
+				return nil, fmt.Errorf("plist: expected <key>, got <%s>", key.Name.Local)
+			}
+			var name string
+			if err := d.DecodeElement(&name, &key); err != nil {
+				return nil, fmt.Errorf("plist: %w", err)
+			}
+			elem, end, err := nextXMLElement(d)
+			if err != nil {
+				return nil, err
+			}
+			if end {
+				return nil, fmt.Errorf("plist: key %q has no value", name)
+			}
+			if dict[name], err = decodeXMLValue(d, elem); err != nil {
+				return nil, err
+			}
+		}
+	case "array":
+		list := []any{}
+		for {
+			elem, end, err := nextXMLElement(d)
+			if err != nil {
+				return nil, err
+			}
+			if end {
+				return list, nil
+			}
+			v, err := decodeXMLValue(d, elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, fmt.Errorf("plist: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		n, err := strconv.ParseInt(text, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("plist: integer %q: %w", text, err)
+		}
+		return n, nil
+	case "real":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("plist: real %q: %w", text, err)
+		}
+		return f, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("plist: date %q: %w", text, err)
+		}
+		return t, nil
+	case "data":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, fmt.Errorf("plist: data: %w", err)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("plist: unknown element <%s>", start.Name.Local)
+}
+
+// nextXMLElement returns the next start element, or end=true at the end of
+// the enclosing element.
+func nextXMLElement(d *xml.Decoder) (xml.StartElement, bool, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, false, fmt.Errorf("plist: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, false, nil
+		case xml.EndElement:
+			return xml.StartElement{}, true, nil
+		}
+	}
+}
+
+// binaryPlist decodes the bplist00 format: objects addressed through an
+// offset table described by the 32-byte trailer.
+type binaryPlist struct {
+	data    []byte
+	offsets []uint64
+	refSize int
+	depth   int
+}
+
+// maxPlistDepth guards against reference cycles in malformed files.
+const maxPlistDepth = 64
+
+func parseBinaryPlist(data []byte) (any, error) {
+	if len(data) < 8+32 {
+		return nil, errors.New("plist: truncated binary plist")
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 ||
+		numObjects > uint64(len(data)) || topObject >= numObjects || tableOffset > uint64(len(data)) ||
+		tableOffset+numObjects*uint64(offsetSize) > uint64(len(data)-32) {
+		return nil, errors.New("plist: invalid binary plist trailer")
+	}
+
+	p := &binaryPlist{data: data, refSize: refSize, offsets: make([]uint64, numObjects)}
+	for i := range p.offsets {
+		start := tableOffset + uint64(i*offsetSize)
+		p.offsets[i] = readUint(data[start : start+uint64(offsetSize)])
+	}
+	return p.object(topObject)
+}
+
+func readUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+func (p *binaryPlist) object(ref uint64) (any, error) {
+	if ref >= uint64(len(p.offsets)) {
+		return nil, fmt.Errorf("plist: object reference %d out of range", ref)
+	}
+	if p.depth++; p.depth > maxPlistDepth {
+		return nil, errors.New("plist: nesting too deep")
+	}
+	defer func() { p.depth-- }()
+
+	off := p.offsets[ref]
+	if off >= uint64(len(p.data)) {
+		return nil, fmt.Errorf("plist: object offset %d out of range", off)
+	}
+	marker := p.data[off]
+	kind, info := marker>>4, int(marker&0x0f)
+	pos := off + 1
+
+	switch kind {
+	case 0x0:
+		switch info {
+		case 0x8:
+			return false, nil
+		case 0x9:
+			return true, nil
+		}
+		return nil, nil
+	case 0x1:
+		b, err := p.bytes(pos, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readUint(b)), nil
+	case 0x2:
+		b, err := p.bytes(pos, 1<<info)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) == 4 {
+			return float64(math.Float32frombits(uint32(readUint(b)))), nil
+		}
+		return math.Float64frombits(readUint(b)), nil
+	case 0x3:
+		b, err := p.bytes(pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		secs := math.Float64frombits(readUint(b))
+		return plistTimeEpoch.Add(time.Duration(secs * float64(time.Second))), nil
+	}
+
+	n, pos, err := p.count(info, pos)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 0x4:
+		b, err := p.bytes(pos, n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 0x5:
+		b, err := p.bytes(pos, n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 0x6:
+		b, err := p.bytes(pos, 2*n)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0xA:
+		list := make([]any, n)
+		for i := range list {
+			ref, err := p.ref(pos, i)
+			if err != nil {
+				return nil, err
+			}
+			if list[i], err = p.object(ref); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case 0xD:
+		dict := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			keyRef, err := p.ref(pos, i)
+			if err != nil {
+				return nil, err
+			}
+			valRef, err := p.ref(pos, n+i)
+			if err != nil {
+				return nil, err
+			}
+			key, err := p.object(keyRef)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("plist: dictionary key is %T, not a string", key)
+			}
+			if dict[name], err = p.object(valRef); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("plist: unsupported object type 0x%x", marker)
+}
+
+// count decodes the length of a data, string or collection object; 0xF
+// means the length follows as an integer object.
+func (p *binaryPlist) count(info int, pos uint64) (int, uint64, error) {
+	if info != 0xf {
+		return info, pos, nil
+	}
+	b, err := p.bytes(pos, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if b[0]>>4 != 0x1 {
+		return 0, 0, errors.New("plist: invalid length marker")
+	}
+	size := 1 << (b[0] & 0x0f)
+	nb, err := p.bytes(pos+1, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	n := readUint(nb)
+	if n > uint64(len(p.data)) {
+		return 0, 0, errors.New("plist: length out of range")
+	}
+	return int(n), pos + 1 + uint64(size), nil
+}
+
+func (p *binaryPlist) ref(pos uint64, i int) (uint64, error) {
+	b, err := p.bytes(pos+uint64(i*p.refSize), p.refSize)
+	if err != nil {
+		return 0, err
+	}
+	return readUint(b), nil
+}
+
+func (p *binaryPlist) bytes(pos uint64, n int) ([]byte, error) {
+	if n < 0 || pos+uint64(n) > uint64(len(p.data)) {
+		return nil, errors.New("plist: object extends past end of file")
+	}
+	return p.data[pos : pos+uint64(n)], nil
+}
+
+// plistBundleIdentifier reads CFBundleIdentifier from the Info.plist of the
+// bundle at path. It returns "" for paths that are not application bundles.
+func plistBundleIdentifier(path string) (string, error) {
+	if !strings.HasSuffix(path, ".app") {
+		return "", nil
+	}
+	info, err := readInfoPlist(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	id, _ := info["CFBundleIdentifier"].(string)
+	return id, nil
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePlist(t *testing.T) {
+	want := map[string]any{
+		"CFBundleIdentifier":        "com.example.Editor",
+		"CFBundleName":              "Editor",
+		"CFBundleVersion":           int64(42),
+		"LSMinimumSystemVersion":    "11.0",
+		"NSHighResolutionCapable":   true,
+		"LSRequiresNativeExecution": false,
+		"Scale":                     1.5,
+		"Built":                     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		"Icon":                      []byte{0, 1, 2},
+		"CFBundleDocumentTypes": []any{
+			map[string]any{
+				"CFBundleTypeName":       "Markdown",
+				"CFBundleTypeRole":       "Editor",
+				"CFBundleTypeExtensions": []any{"md", "markdown"},
+				"LSItemContentTypes":     []any{"net.daringfireball.markdown"},
+			},
+			map[string]any{
+				"CFBundleTypeName":   "Text ünïcode",
+				"CFBundleTypeRole":   "Viewer",
+				"LSItemContentTypes": []any{"public.plain-text"},
+			},
+		},
+	}
+	for _, file := range []string{"testdata/Info.xml.plist", "testdata/Info.binary.plist"} {
+		t.Run(file, func(t *testing.T) {
+			got, err := ReadPlist(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dict, ok := got.(map[string]any); ok {
+				if built, ok := dict["Built"].(time.Time); ok {
+					dict["Built"] = built.UTC()
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ReadPlist(%s) =\n%#v\nwant\n%#v", file, got, want)
+			}
+		})
+	}
+}
+
+func TestParsePlistInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"<plist><dict><key>a</key></dict></plist>",
+		"<plist><integer>x</integer></plist>",
+		"bplist00 truncated",
+		"bplist00" + string(make([]byte, 32)),
+	} {
+		if _, err := ParsePlist([]byte(data)); err == nil {
+			t.Errorf("ParsePlist(%q) succeeded", data)
+		}
+	}
+}
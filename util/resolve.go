@@ -0,0 +1,156 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Confidence of an application candidate, by how the query matched it.
+// Substring matches score between ConfidenceSubstring and
+// ConfidenceSubstring+substringRange, higher the more of the name they
+// cover.
+const (
+	ConfidenceExact      = 100 // the bundle ID, or the path of the bundle
+	ConfidenceBundleID   = 95  // the bundle ID in another case
+	ConfidenceName       = 92  // the name, with or without ".app"
+	ConfidenceNameFolded = 90  // the name in another case
+	ConfidenceSubstring  = 40  // part of the name or bundle ID
+	substringRange       = 40
+)
+
+// ErrAppNotFound is returned by ResolveApp when no installed application
+// matches the query.
+var ErrAppNotFound = errors.New("no installed application matches")
+
+// Match kinds of AppCandidate.
+const (
+	MatchPath      = "path"
+	MatchBundleID  = "bundle_id"
+	MatchName      = "name"
+	MatchSubstring = "substring"
+)
+
+// AppCandidate is an application a query may mean.
+type AppCandidate struct {
+	App        Uti    `json:"app" yaml:"app"`
+	Confidence int    `json:"confidence" yaml:"confidence"` // 1 to 100
+	Match      string `json:"match" yaml:"match"`
+}
+
+// AppCandidates returns the applications query may mean, most confident
+// first. query may be a bundle ID, an application name with or without
+// ".app", a path to an .app bundle or part of a name or bundle ID. A path
+// that is not among apps is read from disk.
+func AppCandidates(ctx context.Context, query string, apps map[string]Uti) ([]AppCandidate, error) {
+	q := strings.TrimSpace(query)
+	if q == "" {
+		return nil, fmt.Errorf("empty application")
+	}
+	if strings.Contains(q, "/") {
+		app, err := resolveAppPath(ctx, q, apps)
+		if err != nil {
+			return nil, err
+		}
+		return []AppCandidate{{app, ConfidenceExact, MatchPath}}, nil
+	}
+
+	lower := strings.ToLower(q)
+	name := strings.TrimSuffix(lower, ".app")
+	var candidates []AppCandidate
+	for _, app := range apps {
+		appName := strings.ToLower(strings.TrimSuffix(app.Name, ".app"))
+		id := strings.ToLower(app.Identifier)
+		switch {
+		case app.Identifier == q:
+			candidates = append(candidates, AppCandidate{app, ConfidenceExact, MatchBundleID})
+		case id == lower:
+			candidates = append(candidates, AppCandidate{app, ConfidenceBundleID, MatchBundleID})
+		case app.Name == q || strings.TrimSuffix(app.Name, ".app") == q:
+			candidates = append(candidates, AppCandidate{app, ConfidenceName, MatchName})
+		case appName == name:
+			candidates = append(candidates, AppCandidate{app, ConfidenceNameFolded, MatchName})
+		case strings.Contains(appName, name):
+			candidates = append(candidates, AppCandidate{app, substringConfidence(name, appName), MatchSubstring})
+		case strings.Contains(id, lower):
+			candidates = append(candidates, AppCandidate{app, substringConfidence(lower, id), MatchSubstring})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Confidence != candidates[j].Confidence {
+			return candidates[i].Confidence > candidates[j].Confidence
+		}
+		return candidates[i].App.Path < candidates[j].App.Path
+	})
+	return candidates, nil
+}
+
+// substringConfidence scores part of text matching, by how much of text
+// it covers.
+func substringConfidence(part, text string) int {
+	return ConfidenceSubstring + substringRange*len(part)/max(len(text), 1)
+}
+
+// ResolveApp finds the application meant by query, which may be a bundle ID,
+// an application name with or without ".app", a path to an .app bundle or
+// a substring of exactly one application's name or bundle ID. An exact
+// match wins over substrings, and a name in the same case over one in
+// another case; when several candidates match equally well the error lists
+// them. ErrAppNotFound is returned when nothing matches.
+func ResolveApp(ctx context.Context, query string, apps map[string]Uti) (Uti, error) {
+	candidates, err := AppCandidates(ctx, query, apps)
+	if err != nil {
+		return Uti{}, err
+	}
+	if len(candidates) == 0 {
+		return Uti{}, fmt.Errorf("%w %q", ErrAppNotFound, query)
+	}
+
+	// Substrings only resolve when no exact match exists and they are unique.
+	best := candidates[:1]
+	for _, c := range candidates[1:] {
+		if c.Confidence == best[0].Confidence || c.Match == MatchSubstring && best[0].Match == MatchSubstring {
+			best = append(best, c)
+		}
+	}
+	if len(best) == 1 {
+		return best[0].App, nil
+	}
+	var lines []string
+	for _, c := range best {
+		lines = append(lines, fmt.Sprintf("  %s (%s, %s match, confidence %d)", c.App.Path, c.App.Identifier, c.Match, c.Confidence))
+	}
+	return Uti{}, fmt.Errorf("%q matches several applications, use a bundle ID or path:\n%s",
+		query, strings.Join(lines, "\n"))
+}
+
+func resolveAppPath(ctx context.Context, path string, apps map[string]Uti) (Uti, error) {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	path = strings.TrimSuffix(filepath.Clean(path), "/")
+
+	for _, app := range apps {
+		if app.Path == path {
+			return app, nil
+		}
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return Uti{}, fmt.Errorf("application %s: %w", path, err)
+	}
+	id, err := bundleIdentifier(ctx, path)
+	if err != nil {
+		return Uti{}, fmt.Errorf("reading bundle ID of %s: %w", path, err)
+	}
+	if id == "" {
+		return Uti{}, fmt.Errorf("%s is not an application bundle", path)
+	}
+	return Uti{Name: filepath.Base(path), Path: path, Identifier: id}, nil
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveApp(t *testing.T) {
+	apps := map[string]Uti{
+		"Visual Studio Code.app": {"Visual Studio Code.app", "/Applications/Visual Studio Code.app", "com.microsoft.VSCode"},
+		"TextEdit.app":           {"TextEdit.app", "/System/Applications/TextEdit.app", "com.apple.TextEdit"},
+		"Zed.app":                {"Zed.app", "/Applications/Zed.app", "dev.zed.Zed"},
+		"zed.app":                {"zed.app", "/Users/me/Applications/zed.app", "dev.zed.Zed-Preview"},
+	}
+	tests := []struct {
+		query   string
+		want    string
+		wantErr string
+	}{
+		{"com.microsoft.VSCode", "com.microsoft.VSCode", ""},
+		{"com.microsoft.vscode", "com.microsoft.VSCode", ""},
+		{"Visual Studio Code", "com.microsoft.VSCode", ""},
+		{"visual studio code.app", "com.microsoft.VSCode", ""},
+		{"/System/Applications/TextEdit.app/", "com.apple.TextEdit", ""},
+		{"Zed", "dev.zed.Zed", ""},
+		{"zed.app", "dev.zed.Zed-Preview", ""},
+		{"ZED", "", "matches several applications"},
+		{"studio", "com.microsoft.VSCode", ""},
+		{"TEXTED", "com.apple.TextEdit", ""},
+		{"microsoft", "com.microsoft.VSCode", ""},
+		{"e", "", "substring match"},
+		{"Sublime Text", "", "no installed application"},
+		{"", "", "empty application"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := ResolveApp(context.Background(), tt.query, apps)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveApp(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Identifier != tt.want {
+				t.Errorf("ResolveApp(%q) = %s, want %s", tt.query, got.Identifier, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppCandidates(t *testing.T) {
+	apps := map[string]Uti{
+		"Zed.app":         {"Zed.app", "/Applications/Zed.app", "dev.zed.Zed"},
+		"Zed Preview.app": {"Zed Preview.app", "/Applications/Zed Preview.app", "dev.zed.Zed-Preview"},
+		"TextEdit.app":    {"TextEdit.app", "/System/Applications/TextEdit.app", "com.apple.TextEdit"},
+	}
+	got, err := AppCandidates(context.Background(), "zed", apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary []string
+	for _, c := range got {
+		summary = append(summary, fmt.Sprintf("%s %s %d", c.App.Identifier, c.Match, c.Confidence))
+	}
+	want := []string{"dev.zed.Zed name 90", "dev.zed.Zed-Preview substring 50"}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("AppCandidates(zed) = %q, want %q", summary, want)
+	}
+	if _, err := ResolveApp(context.Background(), "Sublime Text", apps); !errors.Is(err, ErrAppNotFound) {
+		t.Errorf("ResolveApp(Sublime Text) error = %v, want ErrAppNotFound", err)
+	}
+	if app, err := ResolveApp(context.Background(), "zed", apps); err != nil || app.Identifier != "dev.zed.Zed" {
+		t.Errorf("ResolveApp(zed) = %v, %v; the name should win over substrings", app.Identifier, err)
+	}
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Role is a LaunchServices handler role as understood by duti.
+type Role string
+
+const (
+	RoleAll    Role = "all"
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleShell  Role = "shell"
+	RoleNone   Role = "none"
+)
+
+var Roles = []Role{RoleAll, RoleViewer, RoleEditor, RoleShell, RoleNone}
+
+func ParseRole(s string) (Role, error) {
+	r := Role(strings.ToLower(strings.TrimSpace(s)))
+	if r == "" {
+		return RoleAll, nil
+	}
+	for _, known := range Roles {
+		if r == known {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role %q (want one of all, viewer, editor, shell, none)", s)
+}
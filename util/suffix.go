@@ -0,0 +1,126 @@
+package util
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Suffix is a canonical file suffix: a leading dot followed by one or more
+// lowercase dot-separated parts, e.g. ".txt" or ".tar.gz".
+type Suffix string
+
+// ParseSuffix normalizes user input such as "txt", ".TXT", "*.md" or
+// "tar.gz" into a canonical Suffix.
+func ParseSuffix(s string) (Suffix, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "*")
+	s = strings.ToLower(s)
+	if s != "" && !strings.HasPrefix(s, ".") {
+		s = "." + s
+	}
+
+	if s == "" || s == "." {
+		return "", fmt.Errorf("empty suffix %q", raw)
+	}
+	if strings.ContainsAny(s, `/\:`) {
+		return "", fmt.Errorf("suffix %q must not contain path separators", raw)
+	}
+	if strings.ContainsAny(s, " \t\n*?[]") {
+		return "", fmt.Errorf("suffix %q must not contain whitespace or wildcards", raw)
+	}
+	for _, part := range strings.Split(s[1:], ".") {
+		if part == "" {
+			return "", fmt.Errorf("suffix %q has an empty part", raw)
+		}
+	}
+	return Suffix(s), nil
+}
+
+// ExpandSuffixes parses a list of suffixes separated by spaces or commas,
+// such as ".go .rs py". A word may also name a category ("code", "web") or
+// be a glob matched against the suffixes and file kinds of the catalogue
+// ("*script*" finds .js and .ts). The result is in input order without
+// duplicates.
+func ExpandSuffixes(input string) ([]Suffix, error) {
+	var suffixes []Suffix
+	seen := make(map[Suffix]bool)
+	add := func(s Suffix) {
+		if !seen[s] {
+			seen[s] = true
+			suffixes = append(suffixes, s)
+		}
+	}
+	words := strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	for _, word := range words {
+		if category, ok := findCategory(word); ok {
+			for _, s := range category {
+				add(s)
+			}
+			continue
+		}
+		if !strings.ContainsAny(strings.TrimPrefix(word, "*"), "*?[") {
+			s, err := ParseSuffix(word)
+			if err != nil {
+				return nil, err
+			}
+			add(s)
+			continue
+		}
+		matched, err := globCatalogue(word)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("no known suffix matches %q", word)
+		}
+		for _, s := range matched {
+			add(s)
+		}
+	}
+	return suffixes, nil
+}
+
+func findCategory(name string) ([]Suffix, bool) {
+	for _, c := range suffixCategories {
+		if strings.EqualFold(c.Name, name) {
+			return c.Suffixes, true
+		}
+	}
+	return nil, false
+}
+
+// globCatalogue returns the catalogue suffixes that pattern matches, with
+// or without their dot, or whose kind ("javascript" for .js) it matches.
+func globCatalogue(pattern string) ([]Suffix, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	var matched []Suffix
+	for _, s := range suffixCatalogue {
+		kind := strings.TrimSuffix(strings.TrimPrefix(s.Description, "For "), " files")
+		for _, name := range []string{s.Text, s.Text[1:], kind} {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = append(matched, Suffix(s.Text))
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+func (s Suffix) String() string {
+	return string(s)
+}
+
+// suffixQuery turns a partially typed suffix into the form used for
+// matching completions, so "MD" and "md" both find ".md".
+func suffixQuery(word string) string {
+	word = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(word), "*"))
+	if word != "" && !strings.HasPrefix(word, ".") {
+		word = "." + word
+	}
+	return word
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSuffix(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Suffix
+		wantErr bool
+	}{
+		{".txt", ".txt", false},
+		{"txt", ".txt", false},
+		{".TXT", ".txt", false},
+		{"  md ", ".md", false},
+		{"*.go", ".go", false},
+		{"tar.gz", ".tar.gz", false},
+		{".Tar.GZ", ".tar.gz", false},
+		{"", "", true},
+		{".", "", true},
+		{"..txt", "", true},
+		{".tar.", "", true},
+		{"../txt", "", true},
+		{"a/b", "", true},
+		{`a\b`, "", true},
+		{"my file", "", true},
+		{"*script*", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSuffix(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSuffix(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSuffix(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandSuffixes(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []Suffix
+		wantErr bool
+	}{
+		{".go .rs py", []Suffix{".go", ".rs", ".py"}, false},
+		{".go,.rs, .go", []Suffix{".go", ".rs"}, false},
+		{"*.md", []Suffix{".md"}, false},
+		{"text", []Suffix{".txt", ".md", ".log"}, false},
+		{".md Text", []Suffix{".md", ".txt", ".log"}, false},
+		{"*script*", []Suffix{".js", ".ts", ".tsx", ".jsx"}, false},
+		{".y?ml", []Suffix{".yaml"}, false},
+		{"*.y*ml .tar.gz", []Suffix{".yml", ".yaml", ".tar.gz"}, false},
+		{"", nil, false},
+		{"*nothing*", nil, true},
+		{"[", nil, true},
+		{".go a/b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ExpandSuffixes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandSuffixes(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandSuffixes(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
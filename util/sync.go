@@ -0,0 +1,250 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Actions of a SyncItem.
+const (
+	SyncOK     = "ok"     // the handler already matches
+	SyncSet    = "set"    // there is no handler, or it is unknown
+	SyncFix    = "fix"    // the handler drifted from the config
+	SyncRevert = "revert" // a managed entry left the config; back to its fallback
+	SyncSkip   = "skip"   // a managed entry left the config without a fallback
+)
+
+// Statuses of a SyncItem after ApplySync.
+const (
+	SyncStatusDone   = "done"
+	SyncStatusFailed = "failed"
+)
+
+// SyncItem is one step of a sync plan: what a target's handler is and what
+// the config wants it to be.
+type SyncItem struct {
+	Target  `yaml:",inline"`
+	Role    Role     `json:"role" yaml:"role"`
+	Action  string   `json:"action" yaml:"action"`
+	Current *Handler `json:"current,omitempty" yaml:"current,omitempty"` // nil when unknown
+	Want    *Handler `json:"want,omitempty" yaml:"want,omitempty"`
+	Reason  string   `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Status  string   `json:"status,omitempty" yaml:"status,omitempty"`
+	Error   string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Pending reports whether applying the item changes anything.
+func (i SyncItem) Pending() bool {
+	return i.Action == SyncSet || i.Action == SyncFix || i.Action == SyncRevert
+}
+
+// change is the journal entry of applying the item.
+func (i SyncItem) change() JournalEntry {
+	e := JournalEntry{Suffix: Suffix(i.Name), Role: i.Role, Previous: i.Current, New: i.Want}
+	if i.Kind != TargetSuffix {
+		e.Kind = i.Kind
+	}
+	return e
+}
+
+// ManagedTarget is a managed config entry as of the last sync, so the next
+// one can revert it once it is gone from the config.
+type ManagedTarget struct {
+	Target
+	Role     Role   `json:"role"`
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// SyncState is what `dutis sync` remembers between runs.
+type SyncState struct {
+	Managed []ManagedTarget `json:"managed"`
+}
+
+func syncStatePath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sync.json"), nil
+}
+
+// LoadSyncState reads the state of the last sync, which is empty before
+// the first one.
+func LoadSyncState() (*SyncState, error) {
+	path, err := syncStatePath()
+	if err != nil {
+		return nil, err
+	}
+	state := &SyncState{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save writes the state.
+func (s *SyncState) Save() error {
+	path, err := syncStatePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// desired is one config entry as sync sees it.
+type desired struct {
+	target   Target
+	role     Role
+	handler  Handler
+	managed  bool
+	fallback string
+}
+
+// desiredHandlers lists the suffixes, UTIs and schemes of config in that
+// order, each sorted by name.
+func desiredHandlers(config *Config) []desired {
+	var list []desired
+	for _, a := range config.ListAssociations() {
+		list = append(list, desired{Target{TargetSuffix, string(a.Suffix)}, a.EffectiveRole(),
+			Handler{BundleID: a.BundleID, Name: a.Application}, a.Managed, a.Fallback})
+	}
+	for _, kind := range []TargetKind{TargetUTI, TargetScheme} {
+		bindings := config.UTIs
+		if kind == TargetScheme {
+			bindings = config.Schemes
+		}
+		names := make([]string, 0, len(bindings))
+		for name := range bindings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b := bindings[name]
+			role := b.Role
+			if role == "" || kind == TargetScheme {
+				role = RoleAll
+			}
+			list = append(list, desired{Target{kind, name}, role,
+				Handler{BundleID: b.BundleID, Name: b.Application}, b.Managed, b.Fallback})
+		}
+	}
+	return list
+}
+
+// PlanSync compares the handlers on the system with config and returns
+// one item per config entry, then one per managed entry of state that is
+// no longer in config. Nothing is changed.
+func PlanSync(ctx context.Context, sys HandlerSystem, config *Config, state *SyncState) []SyncItem {
+	var items []SyncItem
+	inConfig := make(map[Target]bool)
+	for _, d := range desiredHandlers(config) {
+		inConfig[d.target] = true
+		want := d.handler
+		items = append(items, planItem(ctx, sys, d.target, d.role, &want))
+	}
+	for _, m := range state.Managed {
+		if inConfig[m.Target] {
+			continue
+		}
+		if m.Fallback == "" {
+			items = append(items, SyncItem{Target: m.Target, Role: m.Role, Action: SyncSkip,
+				Reason: "managed entry removed from the config without a fallback"})
+			continue
+		}
+		item := planItem(ctx, sys, m.Target, m.Role, &Handler{BundleID: m.Fallback})
+		if item.Action != SyncOK {
+			item.Action, item.Reason = SyncRevert, "managed entry removed from the config"
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func planItem(ctx context.Context, sys HandlerSystem, t Target, role Role, want *Handler) SyncItem {
+	item := SyncItem{Target: t, Role: role, Want: want}
+	current, err := sys.Current(ctx, t, role)
+	switch {
+	case errors.Is(err, ErrHandlerUnknown):
+		item.Action, item.Reason = SyncSet, "current handler unknown"
+	case err != nil:
+		item.Action, item.Reason = SyncSet, "current handler unknown: "+err.Error()
+	case current.BundleID == "":
+		item.Current, item.Action, item.Reason = &current, SyncSet, "no handler"
+	case strings.EqualFold(current.BundleID, want.BundleID):
+		item.Current, item.Action = &current, SyncOK
+	default:
+		item.Current, item.Action, item.Reason = &current, SyncFix, "drifted"
+	}
+	return item
+}
+
+// ApplySync carries out the pending items of a plan, journals the changes
+// and records the managed entries of config in state, keeping removed ones
+// whose revert failed so the next sync retries them. It stops when ctx is
+// done.
+func ApplySync(ctx context.Context, sys HandlerSystem, config *Config, state *SyncState, items []SyncItem) ([]SyncItem, error) {
+	var changes []JournalEntry
+	failed := make(map[Target]bool)
+	for i := range items {
+		item := &items[i]
+		if !item.Pending() {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err := sys.Set(ctx, item.Target, item.Want.BundleID, item.Role); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			item.Status, item.Error = SyncStatusFailed, err.Error()
+			failed[item.Target] = true
+			continue
+		}
+		item.Status = SyncStatusDone
+		changes = append(changes, item.change())
+	}
+	recordJournal(changes...)
+	if err := ctx.Err(); err != nil {
+		return items, err
+	}
+
+	next := &SyncState{}
+	for _, d := range desiredHandlers(config) {
+		if d.managed {
+			next.Managed = append(next.Managed, ManagedTarget{d.target, d.role, d.fallback})
+		}
+	}
+	for _, m := range state.Managed {
+		if failed[m.Target] && !containsManaged(next.Managed, m.Target) {
+			next.Managed = append(next.Managed, m)
+		}
+	}
+	*state = *next
+	return items, state.Save()
+}
+
+func containsManaged(list []ManagedTarget, t Target) bool {
+	for _, m := range list {
+		if m.Target == t {
+			return true
+		}
+	}
+	return false
+}
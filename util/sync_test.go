@@ -0,0 +1,143 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeSystem is a HandlerSystem over a map; targets missing from it are
+// unknown, and setting a bundle ID in fail fails.
+type fakeSystem struct {
+	handlers map[Target]string
+	fail     map[string]bool
+	sets     []string
+}
+
+func (f *fakeSystem) Current(ctx context.Context, t Target, role Role) (Handler, error) {
+	id, ok := f.handlers[t]
+	if !ok {
+		return Handler{}, ErrHandlerUnknown
+	}
+	return Handler{BundleID: id}, nil
+}
+
+func (f *fakeSystem) Set(ctx context.Context, t Target, bundleID string, role Role) error {
+	f.sets = append(f.sets, t.String()+" "+bundleID+" "+string(role))
+	if f.fail[bundleID] {
+		return errors.New("exit status 1")
+	}
+	f.handlers[t] = bundleID
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	useFakeTools(t, t.TempDir(), nil)
+	writeTestConfig(t, `version: "1.1"
+associations:
+  .md:
+    suffix: .md
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+    managed: true
+    fallback: com.apple.TextEdit
+  .go:
+    suffix: .go
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+    role: editor
+  .rs:
+    suffix: .rs
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+utis:
+  public.html:
+    application: Safari.app
+    bundle_id: com.apple.Safari
+schemes:
+  mailto:
+    application: Mail.app
+    bundle_id: com.apple.mail
+    managed: true
+`)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffix := func(s string) Target { return Target{TargetSuffix, s} }
+	sys := &fakeSystem{
+		handlers: map[Target]string{
+			suffix(".md"):            "dev.zed.Zed",
+			suffix(".go"):            "com.microsoft.VSCode",
+			suffix(".rs"):            "",
+			suffix(".txt"):           "dev.zed.Zed",
+			suffix(".csv"):           "com.example.Sheets",
+			{TargetScheme, "mailto"}: "com.apple.mail",
+		},
+		fail: map[string]bool{"com.apple.Safari": true},
+	}
+	state := &SyncState{Managed: []ManagedTarget{
+		{suffix(".md"), RoleAll, "com.apple.TextEdit"},
+		{suffix(".txt"), RoleAll, "com.apple.TextEdit"},
+		{suffix(".py"), RoleAll, ""},
+		{suffix(".csv"), RoleViewer, "com.example.Broken"},
+	}}
+	sys.fail["com.example.Broken"] = true
+
+	items := PlanSync(context.Background(), sys, config, state)
+	var got []string
+	for _, item := range items {
+		got = append(got, item.String()+" "+item.Action)
+	}
+	want := []string{".go fix", ".md ok", ".rs set", "public.html set", "mailto: ok", ".txt revert", ".py skip", ".csv revert"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PlanSync() = %v, want %v", got, want)
+	}
+	if sys.sets != nil {
+		t.Fatalf("PlanSync changed handlers: %v", sys.sets)
+	}
+
+	items, err = ApplySync(context.Background(), sys, config, state, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSets := []string{
+		".go dev.zed.Zed editor",
+		".rs dev.zed.Zed all",
+		"public.html com.apple.Safari all",
+		".txt com.apple.TextEdit all",
+		".csv com.example.Broken viewer",
+	}
+	if !reflect.DeepEqual(sys.sets, wantSets) {
+		t.Errorf("set %v, want %v", sys.sets, wantSets)
+	}
+	if items[3].Status != SyncStatusFailed || items[0].Status != SyncStatusDone || items[1].Status != "" {
+		t.Errorf("statuses %q %q %q", items[3].Status, items[0].Status, items[1].Status)
+	}
+
+	// The managed entries of the config are remembered, and .csv because
+	// its revert failed; .txt was reverted and .py had no fallback.
+	reloaded, err := LoadSyncState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var managed []string
+	for _, m := range reloaded.Managed {
+		managed = append(managed, m.String())
+	}
+	if !reflect.DeepEqual(managed, []string{".md", "mailto:", ".csv"}) {
+		t.Errorf("managed after sync = %v", managed)
+	}
+
+	entries, err := ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Kind != "" || entries[0].Previous.BundleID != "com.microsoft.VSCode" || entries[2].New.BundleID != "com.apple.TextEdit" {
+		t.Errorf("journal = %+v", entries)
+	}
+	if got := entries[1].Target(); got != suffix(".rs") {
+		t.Errorf("entry target = %v", got)
+	}
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TargetKind is what a default handler is set for.
+type TargetKind string
+
+const (
+	TargetSuffix TargetKind = "suffix"
+	TargetUTI    TargetKind = "uti"
+	TargetScheme TargetKind = "scheme"
+)
+
+// Target is a suffix (".md"), a UTI ("public.html") or a URL scheme
+// ("mailto") whose default handler dutis manages.
+type Target struct {
+	Kind TargetKind `json:"kind" yaml:"kind"`
+	Name string     `json:"name" yaml:"name"`
+}
+
+// String shows schemes with a trailing colon, so "mailto:" is not taken
+// for a UTI.
+func (t Target) String() string {
+	if t.Kind == TargetScheme {
+		return t.Name + ":"
+	}
+	return t.Name
+}
+
+var schemePattern = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// ParseScheme normalizes a URL scheme such as "MailTo:" to "mailto".
+func ParseScheme(s string) (string, error) {
+	scheme := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s), ":"))
+	if !schemePattern.MatchString(scheme) {
+		return "", fmt.Errorf("invalid URL scheme %q", s)
+	}
+	return scheme, nil
+}
+
+// HandlerSystem reads and sets the default handlers of targets.
+// SystemHandlers is the real one; tests use fakes.
+type HandlerSystem interface {
+	// Current returns the default handler of t for role, a zero Handler
+	// when there is none, or ErrHandlerUnknown.
+	Current(ctx context.Context, t Target, role Role) (Handler, error)
+	// Set makes bundleID the default handler of t for role. Schemes have
+	// no roles.
+	Set(ctx context.Context, t Target, bundleID string, role Role) error
+}
+
+// SystemHandlers queries LaunchServices and sets handlers with duti.
+type SystemHandlers struct{}
+
+func (SystemHandlers) Current(ctx context.Context, t Target, role Role) (Handler, error) {
+	switch t.Kind {
+	case TargetSuffix:
+		return CurrentHandler(ctx, Suffix(t.Name), role)
+	case TargetScheme:
+		return CurrentSchemeHandler(ctx, t.Name)
+	}
+	if !HasCapability(ctx, CapLaunchServices) {
+		return Handler{}, ErrHandlerUnknown
+	}
+	handlers, err := LookupHandlers(ctx, t.Name)
+	if err != nil {
+		return Handler{}, err
+	}
+	if handlers.Source == HandlerSourceInfoPlist {
+		return Handler{}, ErrHandlerUnknown
+	}
+	return handlers.Defaults[role], nil
+}
+
+func (SystemHandlers) Set(ctx context.Context, t Target, bundleID string, role Role) error {
+	if t.Kind == TargetScheme {
+		return SetSchemeHandler(ctx, bundleID, t.Name)
+	}
+	return SetDefaultApplication(ctx, bundleID, t.Name, role)
+}
@@ -1,14 +1,16 @@
 package util
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Uti struct {
@@ -20,67 +22,204 @@ type Uti struct {
 var kMDItemCFBundleIdentifierPattern = regexp.MustCompile(`kMDItemCFBundleIdentifier\s+=\s+"(.+)"`)
 var kMDItemContentTypePattern = regexp.MustCompile(`kMDItemContentType\s+=\s+"(.+)"`)
 
-func ListUti(path string) map[string]Uti {
+// ScanWorkers bounds how many mdls processes ListUti runs at once.
+var ScanWorkers = 8
+
+// ListUti reads the bundle ID of every application in path. Entries whose
+// bundle ID cannot be read are skipped; the scan stops when ctx is done.
+func ListUti(ctx context.Context, path string) (map[string]Uti, error) {
+	start := time.Now()
 	files, err := os.ReadDir(path)
-	r := make(map[string]Uti)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
+	jobs := make(chan os.DirEntry)
 	c := make(chan Uti)
 	wg := &sync.WaitGroup{}
-	wg.Add(len(files))
-
-	for _, file := range files {
-		go func(file os.DirEntry, wg *sync.WaitGroup) {
+	for i := 0; i < min(ScanWorkers, len(files)); i++ {
+		wg.Add(1)
+		go func() {
 			defer wg.Done()
-
-			fp := path + "/" + file.Name()
-			cmd := exec.Command("mdls", "-name", "kMDItemCFBundleIdentifier", fp)
-			out, err := cmd.Output()
-			if err != nil {
-				log.Fatal(err)
-			}
-			match := kMDItemCFBundleIdentifierPattern.FindStringSubmatch(string(out))
-			if len(match) > 0 {
-				c <- Uti{file.Name(), fp, match[1]}
+			for file := range jobs {
+				fp := path + "/" + file.Name()
+				id, err := bundleIdentifier(ctx, fp)
+				if err != nil {
+					if ctx.Err() == nil {
+						Log.Warn("skipping application", "path", fp, "error", err)
+					}
+					continue
+				}
+				if id != "" {
+					c <- Uti{file.Name(), fp, id}
+				}
 			}
-		}(file, wg)
+		}()
 	}
 
+	go func() {
+		defer close(jobs)
+		for _, file := range files {
+			select {
+			case jobs <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	go func(group *sync.WaitGroup) {
 		wg.Wait()
 		close(c)
 	}(wg)
 
+	r := make(map[string]Uti)
 	for v := range c {
 		r[v.Name] = v
 	}
-	return r
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	Log.Info("scanned applications", "dir", path, "entries", len(files), "applications", len(r), "duration", time.Since(start))
+	return r, nil
+}
+
+// bundleIdentifier reads the bundle ID of the application at path. It
+// returns "" for paths that are not application bundles. Without mdls the
+// bundle's Info.plist is read instead.
+func bundleIdentifier(ctx context.Context, path string) (string, error) {
+	if !HasCapability(ctx, CapMdls) {
+		noteDegraded("application scan", "read Info.plist files", capabilityReason(CapMdls))
+		return plistBundleIdentifier(path)
+	}
+	out, err := runCommand(ctx, false, "mdls", "-name", "kMDItemCFBundleIdentifier", path)
+	if err != nil {
+		return "", err
+	}
+	match := kMDItemCFBundleIdentifierPattern.FindStringSubmatch(string(out))
+	if len(match) > 0 {
+		return match[1], nil
+	}
+	return "", nil
+}
+
+// ScanRoots are the directories ListApplicationsUti scans, the first one
+// winning when an application is in several. Only the first is required to
+// exist.
+var ScanRoots = append([]string{
+	"/Applications",
+	"/Applications/Utilities",
+	"/System/Applications",
+	"/System/Applications/Utilities",
+}, userApplications()...)
+
+// userApplications returns ~/Applications, where apps installed for one
+// user live.
+func userApplications() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	return []string{filepath.Join(home, "Applications")}
+}
+
+func ListApplicationsUti(ctx context.Context) (map[string]Uti, error) {
+	apps := make(map[string]Uti)
+	for i, root := range ScanRoots {
+		found, err := ListUti(ctx, root)
+		if i > 0 && os.IsNotExist(err) {
+			Log.Debug("skipping missing scan root", "path", root)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for name, app := range found {
+			if _, ok := apps[name]; !ok {
+				apps[name] = app
+			}
+		}
+	}
+	return apps, nil
 }
 
-func ListApplicationsUti() map[string]Uti {
-	return ListUti("/Applications")
+func SetDefaultApplication(ctx context.Context, uti string, suffix string, role Role) error {
+	if !HasCapability(ctx, CapDuti) {
+		return &missingCapabilityError{"setting default applications", capabilityReason(CapDuti)}
+	}
+	output, err := runCommand(ctx, true, "duti", "-s", uti, suffix, string(role))
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("duti error: %w, output: %s", err, string(output))
+	}
+	Log.Info("set default application", "suffix", suffix, "bundle_id", uti, "role", role)
+	return nil
 }
 
-func SetDefaultApplication(uti string, suffix string) error {
-	fmt.Println("Set default application for", suffix, "to", uti)
-	cmd := exec.Command("duti", "-s", uti, suffix, "all")
-	output, err := cmd.CombinedOutput()
+// SetSchemeHandler makes bundleID the default handler of a URL scheme.
+func SetSchemeHandler(ctx context.Context, bundleID, scheme string) error {
+	if !HasCapability(ctx, CapDuti) {
+		return &missingCapabilityError{"setting default applications", capabilityReason(CapDuti)}
+	}
+	output, err := runCommand(ctx, true, "duti", "-s", bundleID, scheme)
 	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
 		return fmt.Errorf("duti error: %w, output: %s", err, string(output))
 	}
+	Log.Info("set default application", "scheme", scheme, "bundle_id", bundleID)
 	return nil
 }
 
-func getFileContentType(path string) string {
-	cmd := exec.Command("mdls", "-name", "kMDItemContentType", path)
-	out, err := cmd.Output()
+func getFileContentType(ctx context.Context, path string) (string, error) {
+	if !HasCapability(ctx, CapMdls) {
+		return "", &missingCapabilityError{"reading content types", capabilityReason(CapMdls)}
+	}
+	out, err := runCommand(ctx, false, "mdls", "-name", "kMDItemContentType", path)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	match := kMDItemContentTypePattern.FindStringSubmatch(string(out))
-	return match[1]
+	if len(match) == 0 {
+		return "", fmt.Errorf("no content type for %s", path)
+	}
+	return match[1], nil
+}
+
+// ContentTypeForSuffix returns the UTI the system assigns to files with
+// the given suffix, e.g. "public.plain-text" for ".txt".
+func ContentTypeForSuffix(ctx context.Context, suf string) (string, error) {
+	contentFile, err := os.CreateTemp("/tmp", "dutis-content.*"+suf)
+	if err != nil {
+		return "", err
+	}
+	contentFile.Close()
+	defer os.Remove(contentFile.Name())
+	return getFileContentType(ctx, contentFile.Name())
+}
+
+// ContentTypeForFile returns the UTI of an existing file.
+func ContentTypeForFile(ctx context.Context, path string) (string, error) {
+	return getFileContentType(ctx, path)
+}
+
+// runSwiftScript runs source with the swift interpreter and returns stdout.
+func runSwiftScript(ctx context.Context, source string, args ...string) ([]byte, error) {
+	scriptFile, err := os.CreateTemp("/tmp", "dutis-script.*.swift")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(scriptFile.Name())
+	if _, err := scriptFile.WriteString(source); err != nil {
+		scriptFile.Close()
+		return nil, err
+	}
+	scriptFile.Close()
+
+	return runCommand(ctx, false, "swift", append([]string{scriptFile.Name()}, args...)...)
 }
 
 func cleanApplicationPath(path string) string {
@@ -135,24 +274,49 @@ func cleanApplicationPath(path string) string {
 	return path
 }
 
-func LSCopyAllRoleHandlersForContentType(suf string) []string {
+// declaredRecommendations is the fallback of
+// LSCopyAllRoleHandlersForContentType: the applications whose Info.plist
+// declares the suffix or content type. It is not cached, so LaunchServices
+// answers are used again once available.
+func declaredRecommendations(ctx context.Context, suf, contentType, reason string) []string {
+	noteDegraded("recommendations", "use Info.plist declarations", reason)
+	handlers, err := declaredHandlers(ctx, suf, contentType)
+	if err != nil {
+		Log.Warn("reading declared handlers", "error", err)
+		return []string{}
+	}
+	names := []string{}
+	for _, h := range handlers {
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+func LSCopyAllRoleHandlersForContentType(ctx context.Context, suf string) []string {
 	// Check cache first
 	if cached, ok := LoadRecommendedAppsCache(suf); ok {
 		return cached
 	}
+	start := time.Now()
 
-	contentFile, _ := os.CreateTemp("/tmp", "dutis-content.*"+suf)
-	defer func(name string) {
-		os.Remove(name)
-	}(contentFile.Name())
-	contentFileContentType := getFileContentType(contentFile.Name())
-
-	scriptFile, _ := os.CreateTemp("/tmp", "dutis-script.*.swift")
-	defer func(name string) {
-		os.Remove(name)
-	}(scriptFile.Name())
+	// Without mdls the fallback can still match on the extension.
+	contentFileContentType, err := ContentTypeForSuffix(ctx, suf)
+	if err != nil && ctx.Err() != nil {
+		return []string{}
+	}
+	if !HasCapability(ctx, CapLaunchServices) || contentFileContentType == "" {
+		reason := capabilityReason(CapLaunchServices)
+		if contentFileContentType == "" {
+			reason = "content type unknown: " + err.Error()
+			var missing *missingCapabilityError
+			if errors.As(err, &missing) {
+				reason = missing.Reason
+			}
+		}
+		return declaredRecommendations(ctx, suf, contentFileContentType, reason)
+	}
 
-	if _, err := scriptFile.Write([]byte(`
+	out, err := runSwiftScript(ctx, `
 import CoreServices
 import Foundation
 
@@ -176,14 +340,13 @@ guard let bundleIds = LSCopyAllRoleHandlersForContentType(fileType as CFString,
     }
     .flatMap { $0 }
     .forEach { print($0) }
-`)); err != nil {
-		return []string{}
-	}
-
-	cmd := exec.Command("swift", scriptFile.Name(), contentFileContentType)
-	out, err := cmd.Output()
+`, contentFileContentType)
 	if err != nil {
-		return []string{}
+		if ctx.Err() != nil {
+			return []string{}
+		}
+		withdrawCapability(CapLaunchServices, fmt.Sprintf("LaunchServices query failed: %v", err))
+		return declaredRecommendations(ctx, suf, contentFileContentType, capabilityReason(CapLaunchServices))
 	}
 	
 	applicationFullPathList := strings.Split(string(out), "\n")
@@ -205,6 +368,8 @@ guard let bundleIds = LSCopyAllRoleHandlersForContentType(fileType as CFString,
 		}
 	}
 	
+	Log.Info("looked up recommended applications", "suffix", suf, "applications", len(cleanedList), "duration", time.Since(start))
+
 	// Save to cache
 	_ = SaveRecommendedAppsCache(suf, cleanedList)
 	
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCleanApplicationPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"file:///Applications/Visual%20Studio%20Code.app/", "Visual Studio Code.app"},
+		{"/Applications/Zed.app", "Zed.app"},
+		{"/Applications/Utilities/Terminal.app/", "Utilities/Terminal.app"},
+		{"/System/Applications/TextEdit.app", "TextEdit.app"},
+		{"file:///System/Volumes/Preboot/Cryptexes/App/System/Applications/Safari.app/", "Safari.app"},
+		{"/Setapp/CleanShot%20X.app", "CleanShot X.app"},
+		{"/Users/me/Applications/Chrome%20Apps.localized/Docs.app", "Docs.app"},
+		{"/System/Library/CoreServices/Applications/Utilities/Directory%20Utility.app", "Utilities/Directory Utility.app"},
+		{"/Library/TeX/Distributions/TeX/TeXShop.app", "TeX/TeXShop.app"},
+		{"/Users/me/.cache/tool/Tool.app/Contents/MacOS/Tool", "Tool.app"},
+		{"Preview.app", "Preview.app"},
+		{"/usr/local/bin/duti", "/usr/local/bin/duti"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := cleanApplicationPath(tt.path); got != tt.want {
+			t.Errorf("cleanApplicationPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestListUtiWithMdls(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"Editor.app", "Broken.app", "Notes.txt"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake := useFakeTools(t, root, func(argv []string) (string, error) {
+		if argv[0] != "mdls" {
+			return "", nil
+		}
+		switch filepath.Base(argv[len(argv)-1]) {
+		case "Editor.app":
+			return `kMDItemCFBundleIdentifier = "com.example.Editor"` + "\n", nil
+		case "Broken.app":
+			return "", errors.New("exit status 1")
+		}
+		return "kMDItemCFBundleIdentifier = (null)\n", nil
+	}, CapMdls)
+
+	apps, err := ListUti(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Uti{"Editor.app": {"Editor.app", root + "/Editor.app", "com.example.Editor"}}
+	if !reflect.DeepEqual(apps, want) {
+		t.Errorf("ListUti() = %v, want %v", apps, want)
+	}
+	if got := fake.commands("mdls"); len(got) != 3 {
+		t.Errorf("ran mdls %d times, want once per entry: %v", len(got), got)
+	}
+	if len(Degradations()) != 0 {
+		t.Errorf("Degradations() = %v, want none with mdls", Degradations())
+	}
+}
+
+func TestListApplicationsUtiSystemApps(t *testing.T) {
+	for _, want := range append([]string{"/System/Applications"}, userApplications()...) {
+		if !slices.Contains(ScanRoots, want) {
+			t.Errorf("ScanRoots = %v, want %s scanned", ScanRoots, want)
+		}
+	}
+
+	root := t.TempDir()
+	apps, system := filepath.Join(root, "Applications"), filepath.Join(root, "System", "Applications")
+	user := filepath.Join(root, "home", "Applications")
+	for _, dir := range []string{filepath.Join(apps, "Editor.app"), filepath.Join(system, "Editor.app"),
+		filepath.Join(system, "TextEdit.app"), filepath.Join(user, "Zed.app")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useFakeTools(t, root, func(argv []string) (string, error) {
+		path := argv[len(argv)-1]
+		id := "com.example." + strings.TrimSuffix(filepath.Base(path), ".app")
+		if strings.HasPrefix(path, system) {
+			id = "com.apple." + strings.TrimSuffix(filepath.Base(path), ".app")
+		}
+		return `kMDItemCFBundleIdentifier = "` + id + `"` + "\n", nil
+	}, CapMdls)
+	ScanRoots = []string{apps, filepath.Join(apps, "Utilities"), system, user}
+
+	found, err := ListApplicationsUti(context.Background())
+	if err != nil {
+		t.Fatalf("ListApplicationsUti() with a missing root: %v", err)
+	}
+	if got := found["Editor.app"].Identifier; got != "com.example.Editor" {
+		t.Errorf("Editor.app = %s, want the first root's copy", got)
+	}
+
+	// The documented `dutis remove .md --restore --fallback TextEdit`.
+	app, err := ResolveApp(context.Background(), "TextEdit", found)
+	if err != nil || app.Identifier != "com.apple.TextEdit" {
+		t.Errorf("ResolveApp(TextEdit) = %v, %v; want com.apple.TextEdit", app, err)
+	}
+	// `dutis set .txt com.example.Zed` for an app in ~/Applications.
+	if app, err := ResolveApp(context.Background(), "com.example.Zed", found); err != nil || app.Path != filepath.Join(user, "Zed.app") {
+		t.Errorf("ResolveApp(com.example.Zed) = %v, %v; want the app in %s", app, err, user)
+	}
+}
+
+func TestSetDefaultApplication(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    Role
+		fail    bool
+		wantCmd string
+		wantErr string
+	}{
+		{"all", RoleAll, false, "duti -s com.example.Editor .md all", ""},
+		{"editor", RoleEditor, false, "duti -s com.example.Editor .md editor", ""},
+		{"failure", RoleAll, true, "duti -s com.example.Editor .md all", "duti error: exit status 1, output: no such bundle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeTools(t, t.TempDir(), func(argv []string) (string, error) {
+				if tt.fail && argv[1] == "-s" {
+					return "no such bundle", errors.New("exit status 1")
+				}
+				return "", nil
+			}, CapDuti)
+
+			err := SetDefaultApplication(context.Background(), "com.example.Editor", ".md", tt.role)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("SetDefaultApplication() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := fake.commands("duti -s"); !reflect.DeepEqual(got, []string{tt.wantCmd}) {
+				t.Errorf("ran %v, want %q", got, tt.wantCmd)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic is a single problem found in config.yaml.
+type Diagnostic struct {
+	Path     string   `json:"path" yaml:"path"`
+	Line     int      `json:"line" yaml:"line"`
+	Column   int      `json:"column" yaml:"column"`
+	Severity Severity `json:"severity" yaml:"severity"`
+	Message  string   `json:"message" yaml:"message"`
+	Fix      string   `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%s:%d:%d: %s: %s", d.Path, d.Line, d.Column, d.Severity, d.Message)
+	if d.Fix != "" {
+		s += "\n    fix: " + d.Fix
+	}
+	return s
+}
+
+var knownConfigKeys = map[string]bool{"version": true, "associations": true, "utis": true, "schemes": true}
+var knownAssociationKeys = map[string]bool{"suffix": true, "application": true, "bundle_id": true, "set_at": true, "role": true, "managed": true, "fallback": true}
+var knownBindingKeys = map[string]bool{"application": true, "bundle_id": true, "role": true, "managed": true, "fallback": true}
+
+// reportFunc records a diagnostic at n.
+type reportFunc func(n *yaml.Node, sev Severity, fix, format string, args ...interface{})
+
+// ValidateConfig checks config.yaml and reports every problem found. When
+// installed is non-nil, bundle IDs missing from it are reported as well.
+// A missing config file is reported as a diagnostic.
+func ValidateConfig(installed map[string]bool) ([]Diagnostic, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return []Diagnostic{{Path: configPath, Severity: SeverityError, Message: "config file does not exist",
+			Fix: "create it with `dutis set <suffix> <app>` or interactive mode, or pass --config"}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return validateConfigData(configPath, data, installed), nil
+}
+
+// HasErrors reports whether any diagnostic is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func validateConfigData(path string, data []byte, installed map[string]bool) []Diagnostic {
+	var diags []Diagnostic
+	var report reportFunc = func(n *yaml.Node, sev Severity, fix, format string, args ...interface{}) {
+		d := Diagnostic{Path: path, Severity: sev, Message: fmt.Sprintf(format, args...), Fix: fix}
+		if n != nil {
+			d.Line, d.Column = n.Line, n.Column
+		}
+		diags = append(diags, d)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		report(nil, SeverityError, "fix the YAML syntax", "%v", err)
+		return diags
+	}
+	if doc.Kind == 0 {
+		return diags
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		report(root, SeverityError, "the file must be a mapping with version and associations keys",
+			"config root is not a mapping")
+		return diags
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i]
+		if seen[key.Value] {
+			report(key, SeverityError, "remove one of the duplicate keys", "duplicate key %q", key.Value)
+		}
+		seen[key.Value] = true
+		if !knownConfigKeys[key.Value] {
+			report(key, SeverityWarning, "remove the key", "unknown key %q", key.Value)
+		}
+	}
+
+	if v := mappingValue(root, "version"); v == nil {
+		report(root, SeverityWarning, "run `dutis config migrate`", "missing version")
+	} else if cmp, err := compareConfigVersions(v.Value, CurrentConfigVersion); err != nil {
+		report(v, SeverityError, fmt.Sprintf("set version: %q", CurrentConfigVersion), "%v", err)
+	} else if cmp > 0 {
+		report(v, SeverityError, "upgrade dutis", "%v", &NewerConfigError{Version: v.Value})
+	} else if cmp < 0 {
+		report(v, SeverityWarning, "run `dutis config migrate`",
+			"version %s is older than the current schema %s", v.Value, CurrentConfigVersion)
+	}
+
+	validateBindings(root, "utis", installed, report)
+	validateBindings(root, "schemes", installed, report)
+
+	assocs := mappingValue(root, "associations")
+	if assocs == nil || (assocs.Kind == yaml.ScalarNode && assocs.Tag == "!!null") {
+		return diags
+	}
+	if assocs.Kind != yaml.MappingNode {
+		report(assocs, SeverityError, "associations must map suffixes to entries", "associations is not a mapping")
+		return diags
+	}
+
+	seenSuffix := make(map[Suffix]bool)
+	for i := 0; i+1 < len(assocs.Content); i += 2 {
+		key, entry := assocs.Content[i], assocs.Content[i+1]
+		suffix := key.Value
+		canonical, err := ParseSuffix(suffix)
+		if err != nil {
+			report(key, SeverityError, "use a suffix like .txt or .tar.gz", "%v", err)
+		} else {
+			if seenSuffix[canonical] {
+				report(key, SeverityError, "remove one of the duplicate entries or run `dutis config migrate`",
+					"duplicate association for %s", canonical)
+			}
+			seenSuffix[canonical] = true
+			if canonical.String() != suffix {
+				report(key, SeverityError, fmt.Sprintf("rename the key to %s or run `dutis config migrate`", canonical),
+					"suffix %q is not canonical", suffix)
+			}
+		}
+		if entry.Kind != yaml.MappingNode {
+			report(entry, SeverityError, "use suffix, application and bundle_id fields",
+				"association %q is not a mapping", suffix)
+			continue
+		}
+
+		for j := 0; j+1 < len(entry.Content); j += 2 {
+			if k := entry.Content[j]; !knownAssociationKeys[k.Value] {
+				report(k, SeverityWarning, "remove the field", "unknown field %q in association %q", k.Value, suffix)
+			}
+		}
+
+		if s := mappingValue(entry, "suffix"); s == nil {
+			report(entry, SeverityWarning, fmt.Sprintf("add suffix: %s", suffix),
+				"association %q has no suffix field", suffix)
+		} else if s.Value != suffix {
+			report(s, SeverityError, fmt.Sprintf("set suffix: %s or rename the key to %s", suffix, s.Value),
+				"suffix %q does not match its key %q", s.Value, suffix)
+		}
+
+		if a := mappingValue(entry, "application"); a == nil || a.Value == "" {
+			report(entry, SeverityWarning, "add the application display name",
+				"association %q has no application", suffix)
+		}
+
+		b := mappingValue(entry, "bundle_id")
+		switch {
+		case b == nil || b.Value == "":
+			n := b
+			if n == nil {
+				n = entry
+			}
+			report(n, SeverityError, "set bundle_id, e.g. from `mdls -name kMDItemCFBundleIdentifier /Applications/<App>.app`",
+				"association %q has an empty bundle_id", suffix)
+		case installed != nil && !installed[b.Value]:
+			reportNotInstalled(b, report)
+		}
+
+		if r := mappingValue(entry, "role"); r != nil {
+			if _, err := ParseRole(r.Value); err != nil {
+				report(r, SeverityError, "use one of all, viewer, editor, shell, none", "%v", err)
+			}
+		}
+
+		validateManaged(entry, suffix, report)
+
+		if t := mappingValue(entry, "set_at"); t != nil {
+			if _, err := time.Parse(time.RFC3339Nano, t.Value); err != nil {
+				report(t, SeverityWarning, "use an RFC 3339 timestamp or remove the field",
+					"set_at %q is not a valid timestamp", t.Value)
+			}
+		}
+	}
+	return diags
+}
+
+// validateBindings checks the utis or schemes section.
+func validateBindings(root *yaml.Node, section string, installed map[string]bool, report reportFunc) {
+	bindings := mappingValue(root, section)
+	if bindings == nil || (bindings.Kind == yaml.ScalarNode && bindings.Tag == "!!null") {
+		return
+	}
+	if bindings.Kind != yaml.MappingNode {
+		report(bindings, SeverityError, section+" must map names to entries", "%s is not a mapping", section)
+		return
+	}
+
+	for i := 0; i+1 < len(bindings.Content); i += 2 {
+		key, entry := bindings.Content[i], bindings.Content[i+1]
+		name := key.Value
+		if section == "schemes" {
+			if scheme, err := ParseScheme(name); err != nil {
+				report(key, SeverityError, "use a scheme like mailto or https", "%v", err)
+			} else if scheme != name {
+				report(key, SeverityError, fmt.Sprintf("rename the key to %s", scheme), "scheme %q is not canonical", name)
+			}
+		}
+		if entry.Kind != yaml.MappingNode {
+			report(entry, SeverityError, "use application and bundle_id fields", "%s entry %q is not a mapping", section, name)
+			continue
+		}
+		for j := 0; j+1 < len(entry.Content); j += 2 {
+			if k := entry.Content[j]; !knownBindingKeys[k.Value] {
+				report(k, SeverityWarning, "remove the field", "unknown field %q in %s entry %q", k.Value, section, name)
+			}
+		}
+
+		b := mappingValue(entry, "bundle_id")
+		switch {
+		case b == nil || b.Value == "":
+			n := b
+			if n == nil {
+				n = entry
+			}
+			report(n, SeverityError, "set bundle_id", "%s entry %q has an empty bundle_id", section, name)
+		case installed != nil && !installed[b.Value]:
+			reportNotInstalled(b, report)
+		}
+
+		if r := mappingValue(entry, "role"); r != nil {
+			if section == "schemes" {
+				report(r, SeverityWarning, "remove the field", "URL schemes have no role, %q is ignored", r.Value)
+			} else if _, err := ParseRole(r.Value); err != nil {
+				report(r, SeverityError, "use one of all, viewer, editor, shell, none", "%v", err)
+			}
+		}
+		validateManaged(entry, name, report)
+	}
+}
+
+// reportNotInstalled warns about a bundle ID missing from the scanned
+// applications.
+func reportNotInstalled(b *yaml.Node, report reportFunc) {
+	report(b, SeverityWarning, "install the application or change bundle_id",
+		"bundle_id %q was not found in %s", b.Value, strings.Join(ScanRoots, ", "))
+}
+
+// validateManaged checks the managed flag of an entry and its fallback,
+// which only a managed entry uses.
+func validateManaged(entry *yaml.Node, name string, report reportFunc) {
+	managed := false
+	if m := mappingValue(entry, "managed"); m != nil {
+		if err := m.Decode(&managed); err != nil {
+			report(m, SeverityError, "use managed: true or false", "managed %q of %q is not a boolean", m.Value, name)
+		}
+	}
+	if f := mappingValue(entry, "fallback"); f != nil {
+		switch {
+		case f.Value == "":
+			report(f, SeverityWarning, "set a bundle ID or remove the field", "%q has an empty fallback", name)
+		case !managed:
+			report(f, SeverityWarning, "add managed: true or remove the field", "the fallback of %q is only used when it is managed", name)
+		}
+	}
+}
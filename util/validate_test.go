@@ -0,0 +1,120 @@
+package util
+
+import (
+	"os"
+	"testing"
+)
+
+func Test_validateConfigData(t *testing.T) {
+	installed := map[string]bool{"com.microsoft.VSCode": true}
+	tests := []struct {
+		name      string
+		input     string
+		wantLines []int
+		wantErr   bool
+	}{
+		{"valid", `version: "1.1"
+associations:
+    .txt:
+        suffix: .txt
+        application: Visual Studio Code.app
+        bundle_id: com.microsoft.VSCode
+`, nil, false},
+		{"missing dot", `version: "1.1"
+associations:
+    txt:
+        suffix: txt
+        application: Visual Studio Code.app
+        bundle_id: com.microsoft.VSCode
+`, []int{3}, true},
+		{"key mismatch and empty bundle", `version: "1.1"
+associations:
+    .md:
+        suffix: .txt
+        application: Typora.app
+        bundle_id: ""
+`, []int{4, 6}, true},
+		{"not installed", `version: "1.1"
+associations:
+    .md:
+        suffix: .md
+        application: Typora.app
+        bundle_id: abnerworks.Typora
+`, []int{6}, false},
+		{"missing version", `associations: {}
+`, []int{1}, false},
+		{"duplicate after normalization", `version: "1.1"
+associations:
+    .txt:
+        suffix: .txt
+        bundle_id: com.microsoft.VSCode
+        application: Visual Studio Code.app
+    .TXT:
+        suffix: .TXT
+        bundle_id: com.microsoft.VSCode
+        application: Visual Studio Code.app
+`, []int{7, 7}, true},
+		{"managed with fallback", `version: "1.1"
+associations:
+    .md:
+        suffix: .md
+        application: Visual Studio Code.app
+        bundle_id: com.microsoft.VSCode
+        managed: true
+        fallback: com.apple.TextEdit
+utis:
+    public.plain-text:
+        application: Visual Studio Code.app
+        bundle_id: com.microsoft.VSCode
+        role: editor
+schemes:
+    vscode:
+        application: Visual Studio Code.app
+        bundle_id: com.microsoft.VSCode
+        managed: true
+`, nil, false},
+		{"bad bindings", `version: "1.1"
+utis:
+    public.html:
+        application: Safari.app
+        bundle_id: ""
+        fallback: com.apple.Safari
+schemes:
+    Mailto:
+        bundle_id: com.microsoft.VSCode
+        role: viewer
+        managed: maybe
+`, []int{5, 6, 8, 10, 11}, true},
+		{"syntax", "associations: [\n", []int{0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := validateConfigData("config.yaml", []byte(tt.input), installed)
+			if len(diags) != len(tt.wantLines) {
+				t.Fatalf("got %d diagnostics, want %d: %v", len(diags), len(tt.wantLines), diags)
+			}
+			for i, d := range diags {
+				if d.Line != tt.wantLines[i] {
+					t.Errorf("diagnostic %d at line %d, want %d: %v", i, d.Line, tt.wantLines[i], d)
+				}
+			}
+			if HasErrors(diags) != tt.wantErr {
+				t.Errorf("HasErrors() = %v, want %v", HasErrors(diags), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfigMissing(t *testing.T) {
+	configPath := writeTestConfig(t, "")
+	if err := os.Remove(configPath); err != nil {
+		t.Fatal(err)
+	}
+	diags, err := ValidateConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 1 || diags[0].Path != configPath || !HasErrors(diags) {
+		t.Errorf("ValidateConfig() = %v, want one error for the missing file", diags)
+	}
+}
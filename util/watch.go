@@ -0,0 +1,255 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Clock is the time source of a Watcher; tests use a fake one.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Defaults of WatchOptions.
+const (
+	DefaultWatchInterval  = 5 * time.Minute
+	DefaultWatchPoll      = 5 * time.Second
+	DefaultWatchCooldown  = 10 * time.Second
+	DefaultWatchMaxFixes  = 3
+	DefaultWatchFixesSpan = time.Hour
+)
+
+// launchServicesPrefs is where LaunchServices keeps the user's handlers,
+// relative to the home directory.
+const launchServicesPrefs = "Library/Preferences/com.apple.LaunchServices/com.apple.launchservices.secure.plist"
+
+// WatchOptions configure a Watcher. Zero values take the defaults.
+type WatchOptions struct {
+	// Interval is how often every entry is checked regardless of changes.
+	Interval time.Duration
+	// Poll is how often Paths are checked for changes, and Cooldown the
+	// least time between two checks triggered by changes.
+	Poll     time.Duration
+	Cooldown time.Duration
+	Paths    []string
+	// A target corrected MaxFixes times within FixesSpan keeps drifting,
+	// and is left alone until the span has passed.
+	MaxFixes  int
+	FixesSpan time.Duration
+
+	Clock  Clock
+	System HandlerSystem
+	// Config loads the config before every check, so edits take effect.
+	Config func() (*Config, error)
+}
+
+// Correction is one drifted handler the watcher re-asserted, or tried to.
+type Correction struct {
+	Time    time.Time `json:"time" yaml:"time"`
+	Target  `yaml:",inline"`
+	Role    Role     `json:"role" yaml:"role"`
+	From    *Handler `json:"from" yaml:"from"`
+	To      *Handler `json:"to" yaml:"to"`
+	Trigger string   `json:"trigger" yaml:"trigger"` // "start", "interval" or "change"
+	Status  string   `json:"status" yaml:"status"`   // "corrected", "failed" or "rate-limited"
+	Error   string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Statuses of a Correction.
+const (
+	CorrectionDone        = "corrected"
+	CorrectionFailed      = "failed"
+	CorrectionRateLimited = "rate-limited"
+)
+
+// Watcher re-asserts the configured handlers when they drift.
+type Watcher struct {
+	opts WatchOptions
+
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+	nextFull  time.Time
+	changed   bool
+	fixes     map[Target][]time.Time
+	limited   map[Target]bool
+}
+
+// NewWatcher returns a Watcher with the defaults filled in.
+func NewWatcher(opts WatchOptions) *Watcher {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if opts.Poll <= 0 {
+		opts.Poll = DefaultWatchPoll
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = DefaultWatchCooldown
+	}
+	if opts.MaxFixes <= 0 {
+		opts.MaxFixes = DefaultWatchMaxFixes
+	}
+	if opts.FixesSpan <= 0 {
+		opts.FixesSpan = DefaultWatchFixesSpan
+	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+	if opts.System == nil {
+		opts.System = SystemHandlers{}
+	}
+	if opts.Config == nil {
+		opts.Config = LoadConfig
+	}
+	return &Watcher{opts: opts, fixes: make(map[Target][]time.Time), limited: make(map[Target]bool)}
+}
+
+// DefaultWatchPaths are where handler changes show up: the scan roots,
+// where installers put applications, the LaunchServices preferences and
+// the config file.
+func DefaultWatchPaths() []string {
+	paths := append([]string{}, ScanRoots...)
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, launchServicesPrefs))
+	}
+	if path, err := getConfigPath(); err == nil {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// Run checks once, then polls until ctx is done, calling report for every
+// correction. It returns ctx's error.
+func (w *Watcher) Run(ctx context.Context, report func(Correction)) error {
+	w.poll()
+	w.check(ctx, "start", report)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.opts.Clock.After(w.opts.Poll):
+			w.Step(ctx, report)
+		}
+	}
+}
+
+// Step is one poll: it notes changed paths and checks when the interval
+// is up or, after the cooldown, when something changed. It reports whether
+// it checked.
+func (w *Watcher) Step(ctx context.Context, report func(Correction)) bool {
+	if w.poll() {
+		w.changed = true
+	}
+	now := w.opts.Clock.Now()
+	switch {
+	case !now.Before(w.nextFull):
+		w.check(ctx, "interval", report)
+	case w.changed && !now.Before(w.lastCheck.Add(w.opts.Cooldown)):
+		w.check(ctx, "change", report)
+	default:
+		return false
+	}
+	return true
+}
+
+// poll records the modification times of the watched paths and reports
+// whether any differ from the last poll. Missing paths count as the zero
+// time, so one appearing is a change too.
+func (w *Watcher) poll() bool {
+	first := w.modTimes == nil
+	if first {
+		w.modTimes = make(map[string]time.Time)
+	}
+	changed := false
+	for _, path := range w.opts.Paths {
+		var mod time.Time
+		if info, err := os.Stat(path); err == nil {
+			mod = info.ModTime()
+		}
+		if old, ok := w.modTimes[path]; !first && (!ok || !old.Equal(mod)) {
+			Log.Debug("watched path changed", "path", path)
+			changed = true
+		}
+		w.modTimes[path] = mod
+	}
+	return changed
+}
+
+// check compares every configured entry with the system and re-asserts
+// the drifted ones. Entries whose current handler is unknown are left
+// alone: re-setting them blindly would never settle. LaunchServices is
+// retried on every check, so one failed query doesn't end the watch.
+func (w *Watcher) check(ctx context.Context, trigger string, report func(Correction)) {
+	now := w.opts.Clock.Now()
+	w.lastCheck, w.nextFull, w.changed = now, now.Add(w.opts.Interval), false
+
+	if !RestoreCapability(ctx, CapLaunchServices) {
+		Log.Warn("watch: LaunchServices unavailable, handlers not checked", "reason", capabilityReason(CapLaunchServices))
+	}
+
+	config, err := w.opts.Config()
+	if err != nil {
+		Log.Warn("watch: loading config", "error", err)
+		return
+	}
+	items := PlanSync(ctx, w.opts.System, config, &SyncState{})
+	Log.Debug("watch: checked", "trigger", trigger, "entries", len(items))
+
+	var changes []JournalEntry
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		if !item.Pending() || item.Current == nil {
+			continue
+		}
+		c := Correction{Time: now, Target: item.Target, Role: item.Role, From: item.Current, To: item.Want, Trigger: trigger}
+		if w.rateLimited(item.Target, now) {
+			if !w.limited[item.Target] {
+				w.limited[item.Target] = true
+				c.Status = CorrectionRateLimited
+				Log.Warn("watch: rate limited, the handler keeps drifting", "target", item.Target.String(),
+					"corrections", w.opts.MaxFixes, "span", w.opts.FixesSpan)
+				report(c)
+			}
+			continue
+		}
+		w.limited[item.Target] = false
+		w.fixes[item.Target] = append(w.fixes[item.Target], now)
+
+		if err := w.opts.System.Set(ctx, item.Target, item.Want.BundleID, item.Role); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			c.Status, c.Error = CorrectionFailed, err.Error()
+			Log.Warn("watch: correcting drift failed", "target", item.Target.String(), "to", item.Want.BundleID, "error", err)
+		} else {
+			c.Status = CorrectionDone
+			Log.Info("watch: corrected drift", "target", item.Target.String(), "from", item.Current.BundleID,
+				"to", item.Want.BundleID, "trigger", trigger)
+			changes = append(changes, item.change())
+		}
+		report(c)
+	}
+	recordJournal(changes...)
+}
+
+// rateLimited reports whether t was corrected MaxFixes times within the
+// last FixesSpan, forgetting older corrections.
+func (w *Watcher) rateLimited(t Target, now time.Time) bool {
+	recent := w.fixes[t][:0]
+	for _, at := range w.fixes[t] {
+		if now.Sub(at) < w.opts.FixesSpan {
+			recent = append(recent, at)
+		}
+	}
+	w.fixes[t] = recent
+	return len(recent) >= w.opts.MaxFixes
+}
@@ -0,0 +1,201 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when After is called or the test sets now.
+type fakeClock struct {
+	now     time.Time
+	onAfter func()
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	if c.onAfter != nil {
+		c.onAfter()
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func watchTestConfig(t *testing.T) string {
+	return writeTestConfig(t, `version: "1.1"
+associations:
+  .md:
+    suffix: .md
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+  .go:
+    suffix: .go
+    application: Zed.app
+    bundle_id: dev.zed.Zed
+schemes:
+  mailto:
+    application: Mail.app
+    bundle_id: com.apple.mail
+`)
+}
+
+func TestWatcher(t *testing.T) {
+	useFakeTools(t, t.TempDir(), nil)
+	configPath := watchTestConfig(t)
+	md := Target{TargetSuffix, ".md"}
+	sys := &fakeSystem{handlers: map[Target]string{
+		md:                       "com.microsoft.VSCode",
+		{TargetScheme, "mailto"}: "com.apple.mail",
+		// .go is unknown and must be left alone.
+	}}
+	clock := &fakeClock{now: time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)}
+	w := NewWatcher(WatchOptions{
+		Interval: time.Hour, Cooldown: time.Minute, Paths: []string{configPath},
+		MaxFixes: 2, FixesSpan: 3 * time.Hour, Clock: clock, System: sys,
+	})
+
+	var got []string
+	report := func(c Correction) { got = append(got, c.Trigger+" "+c.String()+" "+c.Status) }
+	drift := func() { sys.handlers[md] = "com.microsoft.VSCode" }
+	touch := func() {
+		mod := clock.now.Add(time.Second)
+		if err := os.Chtimes(configPath, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	w.poll()
+	w.check(ctx, "start", report)
+	if sys.handlers[md] != "dev.zed.Zed" || len(sys.sets) != 1 {
+		t.Fatalf("after start: handlers %v, sets %v", sys.handlers, sys.sets)
+	}
+
+	// A change is noticed right away, but checked after the cooldown.
+	drift()
+	touch()
+	clock.now = clock.now.Add(30 * time.Second)
+	if w.Step(ctx, report) {
+		t.Error("checked within the cooldown")
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if !w.Step(ctx, report) {
+		t.Error("did not check after a change")
+	}
+
+	// Nothing changed and the interval isn't up.
+	clock.now = clock.now.Add(10 * time.Minute)
+	if w.Step(ctx, report) {
+		t.Error("checked without a change before the interval")
+	}
+
+	// Two corrections within the span hit the limit: the next drift is
+	// reported once as rate limited and then left alone until the span has
+	// passed.
+	drift()
+	clock.now = clock.now.Add(time.Hour)
+	w.Step(ctx, report)
+	clock.now = clock.now.Add(time.Hour)
+	w.Step(ctx, report)
+	if sys.handlers[md] != "com.microsoft.VSCode" {
+		t.Error("corrected a rate-limited target")
+	}
+	clock.now = clock.now.Add(time.Hour)
+	w.Step(ctx, report)
+
+	want := []string{
+		"start .md corrected",
+		"change .md corrected",
+		"interval .md rate-limited",
+		"interval .md corrected",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("corrections %v, want %v", got, want)
+	}
+
+	entries, err := ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Previous.BundleID != "com.microsoft.VSCode" || entries[0].New.BundleID != "dev.zed.Zed" {
+		t.Errorf("journal = %+v", entries)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	useFakeTools(t, t.TempDir(), nil)
+	watchTestConfig(t)
+	sys := &fakeSystem{handlers: map[Target]string{{TargetSuffix, ".md"}: "com.microsoft.VSCode"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	polls := 0
+	clock := &fakeClock{onAfter: func() {
+		if polls++; polls == 3 {
+			cancel()
+		}
+	}}
+	missing := filepath.Join(t.TempDir(), "missing")
+	w := NewWatcher(WatchOptions{Paths: []string{missing}, Clock: clock, System: sys})
+
+	var corrections []Correction
+	if err := w.Run(ctx, func(c Correction) { corrections = append(corrections, c) }); err != context.Canceled {
+		t.Errorf("Run() = %v, want context.Canceled", err)
+	}
+	if len(corrections) != 1 || corrections[0].Trigger != "start" || corrections[0].To.BundleID != "dev.zed.Zed" {
+		t.Errorf("corrections = %+v", corrections)
+	}
+}
+
+func TestWatcherRetriesLaunchServices(t *testing.T) {
+	current, queries := "com.google.Chrome", 0
+	fake := useFakeTools(t, t.TempDir(), func(argv []string) (string, error) {
+		switch {
+		case argv[1] == "--version" || argv[1] == "-V":
+			return "1.0", nil
+		case argv[0] == "swift":
+			if queries++; queries == 1 {
+				return "", errors.New("signal: killed")
+			}
+			return "default\tall\t" + current + "\t\n", nil
+		case argv[0] == "duti":
+			current = argv[2]
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected command %q", argv)
+	}, "swift", "duti")
+	writeTestConfig(t, `version: "1.1"
+schemes:
+  mailto:
+    application: Mail.app
+    bundle_id: com.apple.mail
+`)
+	ctx := context.Background()
+	// LaunchServices needs macOS; pretend the probe found it.
+	ProbeCapabilities(ctx)
+	capabilities.mu.Lock()
+	capabilities.caps[CapLaunchServices].Available = true
+	capabilities.mu.Unlock()
+
+	var got []Correction
+	w := NewWatcher(WatchOptions{Interval: time.Hour, Clock: &fakeClock{}})
+	w.check(ctx, "start", func(c Correction) { got = append(got, c) })
+	if len(got) != 0 || HasCapability(ctx, CapLaunchServices) {
+		t.Fatalf("after a failed query: corrections %+v, LaunchServices available %v", got, HasCapability(ctx, CapLaunchServices))
+	}
+
+	w.check(ctx, "interval", func(c Correction) { got = append(got, c) })
+	if len(got) != 1 || got[0].Status != CorrectionDone || got[0].From.BundleID != "com.google.Chrome" || current != "com.apple.mail" {
+		t.Errorf("after the retry: corrections %+v, handler %s", got, current)
+	}
+	if sets := fake.commands("duti -s"); len(sets) != 1 {
+		t.Errorf("duti calls %v", sets)
+	}
+}